@@ -1,3 +1,7 @@
+-- Full schema of a new database. A database that was created by an older version of this file first gets the missing
+-- migrations of database/migrations in the order of their numbers, they create or alter everything this file expects
+-- to exist. Running this file afterwards only recreates the triggers and grants.
+
 CREATE
     EXTENSION IF NOT EXISTS "uuid-ossp";
 
@@ -8,23 +12,120 @@ CREATE TABLE IF NOT EXISTS users
     username      VARCHAR(100)        NOT NULL,
     email         VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255)        NOT NULL,
+    email_verified_at TIMESTAMPTZ  DEFAULT NULL,     -- NULL until the address got confirmed
+    pending_email VARCHAR(255)     DEFAULT NULL,     -- new address of a change that is not confirmed yet
+    has_password  BOOLEAN     NOT NULL DEFAULT TRUE, -- FALSE for accounts created by an identity provider sign in
     created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at    TIMESTAMPTZ      DEFAULT NULL
 );
 
+-- Every refresh is a new row. Rows of one sign in share a family_id, used rows are kept to detect reuse.
 CREATE TABLE IF NOT EXISTS refresh_tokens
 (
     id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id       UUID         REFERENCES users (user_id) ON DELETE SET NULL,
-    refresh_token VARCHAR(255) NOT NULL,
-    life_time     TIMESTAMPTZ      DEFAULT NULL,
-    last_used     TIMESTAMPTZ      DEFAULT NULL,
+    family_id     UUID        NOT NULL,
+    token_hash    CHAR(64)    NOT NULL UNIQUE,         -- HMAC-SHA256 of the token, the token itself is never stored
+    life_time     TIMESTAMPTZ NOT NULL,                -- token is not accepted after this point
+    last_used     TIMESTAMPTZ      DEFAULT NULL,       -- set when the token got rotated, a used token is retired
+    replaced_by   UUID             DEFAULT NULL REFERENCES refresh_tokens (id) ON DELETE SET NULL,
+    revoked_at    TIMESTAMPTZ      DEFAULT NULL,
+    device_name   VARCHAR(100)     DEFAULT NULL,
+    user_agent    TEXT             DEFAULT NULL,
+    ip_address    VARCHAR(45)      DEFAULT NULL,
     created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at    TIMESTAMPTZ      DEFAULT NULL
 );
 
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Tokens of the verification mails. The email is the address the token confirms, either the current or the pending one.
+CREATE TABLE IF NOT EXISTS email_verification_tokens
+(
+    email_verification_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id                     UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    email                       VARCHAR(255) NOT NULL,
+    token_hash                  CHAR(64)     NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    expires_at                  TIMESTAMPTZ  NOT NULL,
+    used_at                     TIMESTAMPTZ      DEFAULT NULL,
+    created_at                  TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at                  TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single use tokens of the forgot password mail. Requesting a new mail invalidates the older tokens.
+CREATE TABLE IF NOT EXISTS password_reset_tokens
+(
+    password_reset_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id                 UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    token_hash              CHAR(64)    NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    expires_at              TIMESTAMPTZ NOT NULL,
+    used_at                 TIMESTAMPTZ      DEFAULT NULL,
+    created_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+
+-- TOTP secret of a user. The row exists as soon as the enrollment started, it is only active once enabled_at is set.
+CREATE TABLE IF NOT EXISTS user_two_factor
+(
+    user_id          UUID PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    secret_encrypted TEXT        NOT NULL, -- AES-GCM encrypted, the secret is needed in plain text to check codes
+    enabled_at       TIMESTAMPTZ      DEFAULT NULL,
+    last_used_step   BIGINT      NOT NULL DEFAULT 0, -- time step of the last accepted code, older codes can't be replayed
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes
+(
+    recovery_code_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    code_hash        CHAR(64) NOT NULL, -- HMAC-SHA256 of the code
+    used_at          TIMESTAMPTZ      DEFAULT NULL,
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_recovery_code UNIQUE (user_id, code_hash)
+);
+
+-- External accounts of identity providers (OpenID Connect) that can be used to sign in
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    user_identity_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    provider         VARCHAR(50)  NOT NULL,
+    subject          VARCHAR(255) NOT NULL, -- sub claim of the id token, unique per provider
+    email            VARCHAR(255)     DEFAULT NULL,
+    last_login_at    TIMESTAMPTZ      DEFAULT NULL,
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_provider_subject UNIQUE (provider, subject),
+    CONSTRAINT unique_user_provider UNIQUE (user_id, provider)
+);
+
+-- Pending identity provider sign ins, an entry is consumed by the callback
+CREATE TABLE IF NOT EXISTS oidc_login_states
+(
+    state_hash    CHAR(64) PRIMARY KEY,          -- HMAC-SHA256 of the state parameter
+    binding_hash  CHAR(64)    NOT NULL,          -- HMAC-SHA256 of the cookie set in the browser that started the flow
+    provider      VARCHAR(50) NOT NULL,
+    nonce         VARCHAR(100) NOT NULL,
+    code_verifier VARCHAR(100) NOT NULL,
+    link_user_id  UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE CASCADE, -- set when an existing user links a provider
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Failed sign in attempts per account or ip address, used when THROTTLE_STORE is postgres
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    attempt_key     VARCHAR(255) PRIMARY KEY,       -- e.g. signin:account:<username> or signin:ip:<address>
+    failures        INT         NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ      DEFAULT NULL
+);
 
 -- Groups Table
 CREATE TABLE IF NOT EXISTS groups
@@ -32,22 +133,105 @@ CREATE TABLE IF NOT EXISTS groups
     group_id   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     group_name VARCHAR(100) NOT NULL,
     created_by UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    require_verified_email BOOLEAN NOT NULL DEFAULT FALSE, -- only users with a confirmed email can join
+    require_admin_two_factor BOOLEAN NOT NULL DEFAULT FALSE, -- the admin role only applies to users with two-factor authentication
+    require_join_approval BOOLEAN NOT NULL DEFAULT FALSE, -- every invite creates a join request instead of joining directly
     created_at TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMPTZ      DEFAULT NULL
 );
 
+-- Settings of a group that only change how things are shown and prefilled. Groups without a row use the defaults of
+-- group.defaultGroupSettings.
+CREATE TABLE IF NOT EXISTS group_settings
+(
+    group_id           UUID PRIMARY KEY REFERENCES groups (group_id) ON DELETE CASCADE,
+    time_zone          VARCHAR(64) NOT NULL DEFAULT 'UTC',                -- IANA name, e.g. "Europe/Zurich"
+    week_start         SMALLINT    NOT NULL DEFAULT 1 CHECK (week_start BETWEEN 0 AND 6), -- 0 is Sunday, like time.Weekday
+    locale             VARCHAR(35) NOT NULL DEFAULT 'en',                 -- BCP 47 language tag
+    meal_types         TEXT[]      NOT NULL DEFAULT '{}',
+    default_meal_times JSONB       NOT NULL DEFAULT '{}',                 -- meal type => "HH:MM" in the time zone of the group
+    created_at         TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Personal access tokens for scripts and integrations. Scopes are the names of roles.Scope*, group_id limits the token to one group.
+CREATE TABLE IF NOT EXISTS api_tokens
+(
+    api_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    group_id     UUID             DEFAULT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    token_hash   CHAR(64)     NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    token_hint   VARCHAR(20)  NOT NULL,        -- start of the token, so users can recognize it in the list
+    scopes       TEXT[]       NOT NULL,
+    expires_at   TIMESTAMPTZ      DEFAULT NULL, -- NULL for tokens without expiration
+    last_used_at TIMESTAMPTZ      DEFAULT NULL,
+    revoked_at   TIMESTAMPTZ      DEFAULT NULL,
+    created_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+
 -- Group Invites Table
 CREATE TABLE IF NOT EXISTS group_invites
 (
     invite_token UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     group_id     UUID NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    created_by   UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    label        VARCHAR(100)     DEFAULT NULL, -- lets admins tell their links apart, e.g. "flat chat"
+    max_uses     INT              DEFAULT NULL CHECK (max_uses > 0), -- NULL for links without a limit
+    use_count    INT     NOT NULL DEFAULT 0,
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE, -- joining creates a join request, see groups.require_join_approval
     expires_at   TIMESTAMPTZ,
     created_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at   TIMESTAMPTZ      DEFAULT NULL
 );
 
+-- Every join through an invite link, so admins can see who used which link.
+CREATE TABLE IF NOT EXISTS group_invite_redemptions
+(
+    redemption_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invite_token  UUID NOT NULL REFERENCES group_invites (invite_token) ON DELETE CASCADE,
+    user_id       UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    redeemed_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invite_redemptions_invite_token ON group_invite_redemptions (invite_token);
+
+-- Requests to join a group that has to be approved by a member with the can_manage_join_requests permission.
+CREATE TABLE IF NOT EXISTS group_join_requests
+(
+    join_request_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id        UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id         UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    invite_token    UUID             DEFAULT NULL REFERENCES group_invites (invite_token) ON DELETE SET NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    decided_by      UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    decided_at      TIMESTAMPTZ      DEFAULT NULL,
+    created_at      TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a user can only wait for one decision per group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_join_requests_pending ON group_join_requests (group_id, user_id) WHERE status = 'pending';
+
+-- Invitations of a specific user, sent by a member with the can_create_invite_links permission. The user accepts or
+-- declines them in their account.
+CREATE TABLE IF NOT EXISTS group_invitations
+(
+    invitation_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id      UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id       UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    invited_by    UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    decided_at    TIMESTAMPTZ      DEFAULT NULL,
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_invitations_pending ON group_invitations (group_id, user_id) WHERE status = 'pending';
+
 -- User_Groups Table (Many-to-Many Relationship between Users and Groups)
 CREATE TABLE IF NOT EXISTS user_groups
 (
@@ -69,7 +253,10 @@ CREATE TABLE IF NOT EXISTS user_groups_blacklist
     user_group_blacklist_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id                 UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
     group_id                UUID NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    banned_by               UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    reason                  VARCHAR(255)     DEFAULT NULL,
     banned_at               TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    expires_at              TIMESTAMPTZ      DEFAULT NULL, -- NULL for permanent bans, expired bans get removed by a scheduled job
     created_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at              TIMESTAMPTZ      DEFAULT NULL,
@@ -78,18 +265,55 @@ CREATE TABLE IF NOT EXISTS user_groups_blacklist
 
 );
 
+-- Roles a group defines for its members. Permissions are the names of the roles.Can* constants, the default roles
+-- admin, manager and member get seeded when the group is created.
+CREATE TABLE IF NOT EXISTS group_roles
+(
+    group_role_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id      UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    name          VARCHAR(20) NOT NULL,
+    permissions   TEXT[]      NOT NULL DEFAULT '{}',
+    is_default    BOOLEAN     NOT NULL DEFAULT FALSE, -- default roles can't be renamed or deleted
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_group_role_name UNIQUE (group_id, name)
+);
+
 CREATE TABLE IF NOT EXISTS user_group_roles
 (
     user_group_roles_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_groups_id      UUID        NOT NULL REFERENCES user_groups (user_group_id) ON DELETE CASCADE,
     user_id             UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
     group_id            UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
-    role                VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'manager', 'member')),
+    role                VARCHAR(20) NOT NULL,
 
-    CONSTRAINT unique_user_group_roles UNIQUE (user_groups_id, user_id, group_id, role)
+    CONSTRAINT unique_user_group_roles UNIQUE (user_groups_id, user_id, group_id, role),
+    -- renaming or deleting a role of the group changes or removes it for every member
+    CONSTRAINT fk_user_group_roles_group_role FOREIGN KEY (group_id, role)
+        REFERENCES group_roles (group_id, name) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
 
+-- Recurring meals. The occurrences are rows in meals, created ahead of time by meal.GenerateSeriesOccurrencesInDB.
+CREATE TABLE IF NOT EXISTS meal_series
+(
+    series_id       UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    group_id        UUID         NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    title           VARCHAR(100) NOT NULL,
+    meal_type       VARCHAR(50)  NOT NULL,
+    notes           TEXT,
+    rrule           TEXT         NOT NULL,               -- subset of an iCalendar RRULE, see recurrence.Parse
+    starts_at       TIMESTAMPTZ  NOT NULL,               -- first occurrence, its clock time is the time of every occurrence
+    time_zone       VARCHAR(64)  NOT NULL,               -- the rule is expanded in this zone, taken from the group settings
+    exceptions      DATE[]       NOT NULL DEFAULT '{}',  -- dates without an occurrence, like EXDATE
+    generated_until TIMESTAMPTZ  NOT NULL,               -- occurrences before this time are created
+    created_by      UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    deleted_at      TIMESTAMPTZ           DEFAULT NULL
+);
+
 -- Meals Table
 CREATE TABLE IF NOT EXISTS meals
 (
@@ -102,19 +326,37 @@ CREATE TABLE IF NOT EXISTS meals
     closed     BOOLEAN      NOT NULL DEFAULT FALSE, -- Whether the meal is closed for sign-ups
     fulfilled  BOOLEAN      NOT NULL DEFAULT FALSE, -- Fulfillment status of the meal
     created_by UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    series_id     UUID             DEFAULT NULL REFERENCES meal_series (series_id) ON DELETE SET NULL,
+    occurrence_at TIMESTAMPTZ      DEFAULT NULL,     -- time the series planned the meal at, even if it got moved
+    preference_deadline        TIMESTAMPTZ DEFAULT NULL, -- preferences can't be changed after it
+    preference_deadline_offset INTEGER     DEFAULT NULL CHECK (preference_deadline_offset >= 0), -- deadline in minutes before date_time, moves with the meal
+    auto_closed_at             TIMESTAMPTZ DEFAULT NULL, -- set when the deadline closed the meal, a reopened meal is not closed again
+    max_participants           INTEGER     DEFAULT NULL CHECK (max_participants > 0), -- seats including guests, NULL for no limit
     created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
-    deleted_at    TIMESTAMPTZ      DEFAULT NULL
+    deleted_at    TIMESTAMPTZ      DEFAULT NULL,
+    CONSTRAINT one_preference_deadline CHECK (preference_deadline IS NULL OR preference_deadline_offset IS NULL)
 );
 
+-- deleted occurrences keep their row, so cancelled ones are not created again
+CREATE UNIQUE INDEX IF NOT EXISTS idx_meals_series_occurrence ON meals (series_id, occurrence_at) WHERE series_id IS NOT NULL;
+
+-- open meals with a deadline, for the scheduler that closes them
+CREATE INDEX IF NOT EXISTS idx_meals_open_deadlines ON meals (date_time)
+    WHERE closed = FALSE AND auto_closed_at IS NULL AND deleted_at IS NULL
+    AND (preference_deadline IS NOT NULL OR preference_deadline_offset IS NOT NULL);
+
 -- Meal_Preferences Table (User Preferences for Each Meal)
 CREATE TABLE IF NOT EXISTS meal_preferences
 (
     preference_id UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
     meal_id       UUID        NOT NULL REFERENCES meals (meal_id) ON DELETE CASCADE,
     user_id       UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
-    preference    VARCHAR(20) NOT NULL,
+    preference    VARCHAR(20) NOT NULL CHECK (preference IN ('opt-in', 'opt-out', 'maybe', 'undecided')),
     is_cook        BOOLEAN     NOT NULL DEFAULT FALSE,
+    guest_count   SMALLINT    NOT NULL DEFAULT 0 CHECK (guest_count BETWEEN 0 AND 20), -- people the user brings, only kept for opt-in and maybe
+    comment       VARCHAR(500) NOT NULL DEFAULT '',
+    waitlisted_at TIMESTAMPTZ      DEFAULT NULL, -- set for opt-ins that didn't fit, the waitlist is ordered by it
     created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
     deleted_at    TIMESTAMPTZ      DEFAULT NULL,
@@ -122,6 +364,28 @@ CREATE TABLE IF NOT EXISTS meal_preferences
     CONSTRAINT unique_meal_preference UNIQUE (meal_id, user_id)
 );
 
+-- Reusable meals of a group, CreateNewMeal fills the fields the request leaves empty from a template
+CREATE TABLE IF NOT EXISTS meal_templates
+(
+    template_id  UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    group_id     UUID         NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    title        VARCHAR(100) NOT NULL,
+    meal_type    VARCHAR(50)  NOT NULL,
+    notes        TEXT         NOT NULL DEFAULT '',
+    default_time TIME                  DEFAULT NULL, -- clock time in the time zone of the group
+    created_by   UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members that become cooks of every meal created from the template
+CREATE TABLE IF NOT EXISTS meal_template_cooks
+(
+    template_id UUID NOT NULL REFERENCES meal_templates (template_id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    PRIMARY KEY (template_id, user_id)
+);
+
 -- Meal_Cooks Table (Many-to-Many Relationship between Meals and Users)
 
 CREATE OR REPLACE FUNCTION set_updated_at()
@@ -0,0 +1,25 @@
+-- Upgrades an existing refresh_tokens table to token families with rotation.
+-- Every already issued token becomes its own family and gets the regular 14 day lifetime from its creation.
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS family_id   UUID,
+    ADD COLUMN IF NOT EXISTS replaced_by UUID DEFAULT NULL REFERENCES refresh_tokens (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS revoked_at  TIMESTAMPTZ DEFAULT NULL;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN refresh_token TYPE TEXT;
+
+UPDATE refresh_tokens
+SET family_id = id
+WHERE family_id IS NULL;
+
+UPDATE refresh_tokens
+SET life_time = COALESCE(created_at, CURRENT_TIMESTAMP) + INTERVAL '14 days'
+WHERE life_time IS NULL;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN family_id SET NOT NULL,
+    ALTER COLUMN life_time SET NOT NULL,
+    ALTER COLUMN life_time DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
@@ -0,0 +1,33 @@
+-- Replaces the plaintext refresh tokens with their keyed hash.
+-- The key has to be the same TOKEN_HASH_KEY the server runs with:
+--
+--   psql "$DATABASE_URL" -v token_hash_key="$TOKEN_HASH_KEY" -f database/migrations/002_hash_refresh_tokens.sql
+--
+-- The result matches hashing.HashToken: hex(HMAC-SHA256(key, token)).
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+BEGIN;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS token_hash CHAR(64);
+
+UPDATE refresh_tokens
+SET token_hash = encode(hmac(refresh_token, :'token_hash_key', 'sha256'), 'hex')
+WHERE token_hash IS NULL;
+
+-- Tokens issued before rotation had no unique id, two sign ins within the same second produced the same token.
+DELETE
+FROM refresh_tokens a
+    USING refresh_tokens b
+WHERE a.token_hash = b.token_hash
+  AND a.ctid > b.ctid;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN token_hash SET NOT NULL,
+    DROP COLUMN refresh_token;
+
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash);
+
+COMMIT;
@@ -0,0 +1,6 @@
+-- Stores the device a refresh token family was issued to, so users can list and revoke their sessions.
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS device_name VARCHAR(100) DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS user_agent  TEXT         DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS ip_address  VARCHAR(45)  DEFAULT NULL;
@@ -0,0 +1,22 @@
+-- Adds the verification state and tokens of user emails and the group policy to only accept verified members.
+-- Existing users start unverified and can request a new verification mail.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS pending_email     VARCHAR(255) DEFAULT NULL;
+
+ALTER TABLE groups
+    ADD COLUMN IF NOT EXISTS require_verified_email BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Tokens of the verification mails. The email is the address the token confirms, either the current or the pending one.
+CREATE TABLE IF NOT EXISTS email_verification_tokens
+(
+    email_verification_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id                     UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    email                       VARCHAR(255) NOT NULL,
+    token_hash                  CHAR(64)     NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    expires_at                  TIMESTAMPTZ  NOT NULL,
+    used_at                     TIMESTAMPTZ      DEFAULT NULL,
+    created_at                  TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at                  TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,26 @@
+-- Adds the TOTP secrets, the recovery codes and the group policy that admins need two-factor authentication.
+
+-- TOTP secret of a user. The row exists as soon as the enrollment started, it is only active once enabled_at is set.
+CREATE TABLE IF NOT EXISTS user_two_factor
+(
+    user_id          UUID PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    secret_encrypted TEXT        NOT NULL, -- AES-GCM encrypted, the secret is needed in plain text to check codes
+    enabled_at       TIMESTAMPTZ      DEFAULT NULL,
+    last_used_step   BIGINT      NOT NULL DEFAULT 0, -- time step of the last accepted code, older codes can't be replayed
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes
+(
+    recovery_code_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    code_hash        CHAR(64) NOT NULL, -- HMAC-SHA256 of the code
+    used_at          TIMESTAMPTZ      DEFAULT NULL,
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_recovery_code UNIQUE (user_id, code_hash)
+);
+
+ALTER TABLE groups
+    ADD COLUMN IF NOT EXISTS require_admin_two_factor BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,33 @@
+-- Adds the identity provider accounts and marks accounts that were created by an identity provider and never had a
+-- password.
+
+-- External accounts of identity providers (OpenID Connect) that can be used to sign in
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    user_identity_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    provider         VARCHAR(50)  NOT NULL,
+    subject          VARCHAR(255) NOT NULL, -- sub claim of the id token, unique per provider
+    email            VARCHAR(255)     DEFAULT NULL,
+    last_login_at    TIMESTAMPTZ      DEFAULT NULL,
+    created_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_provider_subject UNIQUE (provider, subject),
+    CONSTRAINT unique_user_provider UNIQUE (user_id, provider)
+);
+
+-- Pending identity provider sign ins, an entry is consumed by the callback
+CREATE TABLE IF NOT EXISTS oidc_login_states
+(
+    state_hash    CHAR(64) PRIMARY KEY,          -- HMAC-SHA256 of the state parameter
+    provider      VARCHAR(50) NOT NULL,
+    nonce         VARCHAR(100) NOT NULL,
+    code_verifier VARCHAR(100) NOT NULL,
+    link_user_id  UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE CASCADE, -- set when an existing user links a provider
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS has_password BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,46 @@
+-- Moves the roles into the group_roles table. Every existing group gets the default roles with
+-- the permissions of roles.RolePermissions, the role of user_group_roles has to be one of the roles of its group.
+
+-- Roles a group defines for its members. Permissions are the names of the roles.Can* constants, the default roles
+-- admin, manager and member get seeded when the group is created.
+CREATE TABLE IF NOT EXISTS group_roles
+(
+    group_role_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id      UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    name          VARCHAR(20) NOT NULL,
+    permissions   TEXT[]      NOT NULL DEFAULT '{}',
+    is_default    BOOLEAN     NOT NULL DEFAULT FALSE, -- default roles can't be renamed or deleted
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_group_role_name UNIQUE (group_id, name)
+);
+
+INSERT INTO group_roles (group_id, name, permissions, is_default)
+SELECT g.group_id, d.name, d.permissions, TRUE
+FROM groups g
+CROSS JOIN (VALUES
+    ('admin', ARRAY [
+        'can_ban_users', 'can_change_meal_flags', 'can_create_invite_links', 'can_create_meal', 'can_delete_group',
+        'can_delete_meal', 'can_demote_from_admin', 'can_demote_from_manager', 'can_force_meal_preference_and_cooking',
+        'can_kick_users', 'can_manage_roles', 'can_promote_to_admin', 'can_promote_to_manager',
+        'can_send_notifications', 'can_unban_user', 'can_update_group', 'can_update_group_policies',
+        'can_update_meal', 'can_view_invite_links', 'can_void_invite_links'
+        ]),
+    ('manager', ARRAY [
+        'can_change_meal_flags', 'can_create_meal', 'can_delete_meal', 'can_force_meal_preference_and_cooking',
+        'can_send_notifications', 'can_update_group', 'can_update_meal', 'can_view_invite_links'
+        ]),
+    ('member', ARRAY []::TEXT[])
+) AS d(name, permissions)
+ON CONFLICT (group_id, name) DO NOTHING;
+
+ALTER TABLE user_group_roles
+    DROP CONSTRAINT IF EXISTS user_group_roles_role_check;
+
+ALTER TABLE user_group_roles
+    DROP CONSTRAINT IF EXISTS fk_user_group_roles_group_role;
+
+ALTER TABLE user_group_roles
+    ADD CONSTRAINT fk_user_group_roles_group_role FOREIGN KEY (group_id, role)
+        REFERENCES group_roles (group_id, name) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Records who banned a user, why and until when. Bans without expires_at are permanent.
+
+ALTER TABLE user_groups_blacklist
+    ADD COLUMN IF NOT EXISTS banned_by UUID DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS reason VARCHAR(255) DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ DEFAULT NULL;
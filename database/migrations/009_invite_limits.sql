@@ -0,0 +1,18 @@
+-- Adds labels, usage limits and the recorded redemptions to invite links.
+
+-- Every join through an invite link, so admins can see who used which link.
+CREATE TABLE IF NOT EXISTS group_invite_redemptions
+(
+    redemption_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invite_token  UUID NOT NULL REFERENCES group_invites (invite_token) ON DELETE CASCADE,
+    user_id       UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    redeemed_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invite_redemptions_invite_token ON group_invite_redemptions (invite_token);
+
+ALTER TABLE group_invites
+    ADD COLUMN IF NOT EXISTS created_by UUID DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS label VARCHAR(100) DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS max_uses INT DEFAULT NULL CHECK (max_uses > 0),
+    ADD COLUMN IF NOT EXISTS use_count INT NOT NULL DEFAULT 0;
@@ -0,0 +1,30 @@
+-- Adds join requests and the approval mode for joining groups.
+
+-- Requests to join a group that has to be approved by a member with the can_manage_join_requests permission.
+CREATE TABLE IF NOT EXISTS group_join_requests
+(
+    join_request_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id        UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id         UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    invite_token    UUID             DEFAULT NULL REFERENCES group_invites (invite_token) ON DELETE SET NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    decided_by      UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    decided_at      TIMESTAMPTZ      DEFAULT NULL,
+    created_at      TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a user can only wait for one decision per group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_join_requests_pending ON group_join_requests (group_id, user_id) WHERE status = 'pending';
+
+ALTER TABLE groups
+    ADD COLUMN IF NOT EXISTS require_join_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE group_invites
+    ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- the default admin and manager roles can decide about join requests, like new groups get it from roles.RolePermissions
+UPDATE group_roles
+SET permissions = ARRAY_APPEND(permissions, 'can_manage_join_requests')
+WHERE is_default
+  AND name IN ('admin', 'manager')
+  AND NOT ('can_manage_join_requests' = ANY (permissions));
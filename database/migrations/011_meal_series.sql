@@ -0,0 +1,26 @@
+-- Adds recurring meals.
+
+-- Recurring meals. The occurrences are rows in meals, created ahead of time by meal.GenerateSeriesOccurrencesInDB.
+CREATE TABLE IF NOT EXISTS meal_series
+(
+    series_id       UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    group_id        UUID         NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    title           VARCHAR(100) NOT NULL,
+    meal_type       VARCHAR(50)  NOT NULL,
+    notes           TEXT,
+    rrule           TEXT         NOT NULL,               -- subset of an iCalendar RRULE, see recurrence.Parse
+    starts_at       TIMESTAMPTZ  NOT NULL,               -- first occurrence, its clock time is the time of every occurrence
+    time_zone       VARCHAR(64)  NOT NULL,               -- the rule is expanded in this zone, taken from the group settings
+    exceptions      DATE[]       NOT NULL DEFAULT '{}',  -- dates without an occurrence, like EXDATE
+    generated_until TIMESTAMPTZ  NOT NULL,               -- occurrences before this time are created
+    created_by      UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    deleted_at      TIMESTAMPTZ           DEFAULT NULL
+);
+
+ALTER TABLE meals
+    ADD COLUMN IF NOT EXISTS series_id UUID DEFAULT NULL REFERENCES meal_series (series_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS occurrence_at TIMESTAMPTZ DEFAULT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_meals_series_occurrence ON meals (series_id, occurrence_at) WHERE series_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- Adds preference deadlines that close meals.
+
+ALTER TABLE meals
+    ADD COLUMN IF NOT EXISTS preference_deadline TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS preference_deadline_offset INTEGER DEFAULT NULL CHECK (preference_deadline_offset >= 0),
+    ADD COLUMN IF NOT EXISTS auto_closed_at TIMESTAMPTZ DEFAULT NULL;
+
+ALTER TABLE meals
+    DROP CONSTRAINT IF EXISTS one_preference_deadline;
+ALTER TABLE meals
+    ADD CONSTRAINT one_preference_deadline CHECK (preference_deadline IS NULL OR preference_deadline_offset IS NULL);
+
+CREATE INDEX IF NOT EXISTS idx_meals_open_deadlines ON meals (date_time)
+    WHERE closed = FALSE AND auto_closed_at IS NULL AND deleted_at IS NULL
+    AND (preference_deadline IS NOT NULL OR preference_deadline_offset IS NOT NULL);
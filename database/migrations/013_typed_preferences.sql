@@ -0,0 +1,18 @@
+-- Limits preferences to opt-in, opt-out, maybe and undecided and adds guests and comments.
+
+UPDATE meal_preferences
+SET preference = 'opt-in'
+WHERE preference = 'eat later';
+
+UPDATE meal_preferences
+SET preference = 'undecided'
+WHERE preference NOT IN ('opt-in', 'opt-out', 'maybe', 'undecided');
+
+ALTER TABLE meal_preferences
+    ADD COLUMN IF NOT EXISTS guest_count SMALLINT NOT NULL DEFAULT 0 CHECK (guest_count BETWEEN 0 AND 20),
+    ADD COLUMN IF NOT EXISTS comment VARCHAR(500) NOT NULL DEFAULT '';
+
+ALTER TABLE meal_preferences
+    DROP CONSTRAINT IF EXISTS meal_preferences_preference_check;
+ALTER TABLE meal_preferences
+    ADD CONSTRAINT meal_preferences_preference_check CHECK (preference IN ('opt-in', 'opt-out', 'maybe', 'undecided'));
@@ -0,0 +1,7 @@
+-- Adds a participant limit to meals and a waitlist for the opt-ins that don't fit.
+
+ALTER TABLE meals
+    ADD COLUMN IF NOT EXISTS max_participants INTEGER DEFAULT NULL CHECK (max_participants > 0);
+
+ALTER TABLE meal_preferences
+    ADD COLUMN IF NOT EXISTS waitlisted_at TIMESTAMPTZ DEFAULT NULL;
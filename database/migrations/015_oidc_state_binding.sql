@@ -0,0 +1,7 @@
+-- Binds the login states of identity providers to the browser that started the flow.
+-- Pending states have no binding, those users have to start the sign in again.
+
+DELETE FROM oidc_login_states;
+
+ALTER TABLE oidc_login_states
+    ADD COLUMN IF NOT EXISTS binding_hash CHAR(64) NOT NULL;
@@ -0,0 +1,93 @@
+-- Creates the tables of features that shipped without a migration: password resets, the postgres store of the sign in
+-- limits, personal access tokens, group settings, direct invitations and meal templates.
+
+-- Single use tokens of the forgot password mail. Requesting a new mail invalidates the older tokens.
+CREATE TABLE IF NOT EXISTS password_reset_tokens
+(
+    password_reset_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id                 UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    token_hash              CHAR(64)    NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    expires_at              TIMESTAMPTZ NOT NULL,
+    used_at                 TIMESTAMPTZ      DEFAULT NULL,
+    created_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at              TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Failed sign in attempts per account or ip address, used when THROTTLE_STORE is postgres
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    attempt_key     VARCHAR(255) PRIMARY KEY,       -- e.g. signin:account:<username> or signin:ip:<address>
+    failures        INT         NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ      DEFAULT NULL
+);
+
+-- Settings of a group that only change how things are shown and prefilled. Groups without a row use the defaults of
+-- group.defaultGroupSettings.
+CREATE TABLE IF NOT EXISTS group_settings
+(
+    group_id           UUID PRIMARY KEY REFERENCES groups (group_id) ON DELETE CASCADE,
+    time_zone          VARCHAR(64) NOT NULL DEFAULT 'UTC',                -- IANA name, e.g. "Europe/Zurich"
+    week_start         SMALLINT    NOT NULL DEFAULT 1 CHECK (week_start BETWEEN 0 AND 6), -- 0 is Sunday, like time.Weekday
+    locale             VARCHAR(35) NOT NULL DEFAULT 'en',                 -- BCP 47 language tag
+    meal_types         TEXT[]      NOT NULL DEFAULT '{}',
+    default_meal_times JSONB       NOT NULL DEFAULT '{}',                 -- meal type => "HH:MM" in the time zone of the group
+    created_at         TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Personal access tokens for scripts and integrations. Scopes are the names of roles.Scope*, group_id limits the token to one group.
+CREATE TABLE IF NOT EXISTS api_tokens
+(
+    api_token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    group_id     UUID             DEFAULT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    token_hash   CHAR(64)     NOT NULL UNIQUE, -- HMAC-SHA256 of the token
+    token_hint   VARCHAR(20)  NOT NULL,        -- start of the token, so users can recognize it in the list
+    scopes       TEXT[]       NOT NULL,
+    expires_at   TIMESTAMPTZ      DEFAULT NULL, -- NULL for tokens without expiration
+    last_used_at TIMESTAMPTZ      DEFAULT NULL,
+    revoked_at   TIMESTAMPTZ      DEFAULT NULL,
+    created_at   TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+
+-- Invitations of a specific user, sent by a member with the can_create_invite_links permission. The user accepts or
+-- declines them in their account.
+CREATE TABLE IF NOT EXISTS group_invitations
+(
+    invitation_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id      UUID        NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id       UUID        NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    invited_by    UUID             DEFAULT NULL REFERENCES users (user_id) ON DELETE SET NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    decided_at    TIMESTAMPTZ      DEFAULT NULL,
+    created_at    TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_invitations_pending ON group_invitations (group_id, user_id) WHERE status = 'pending';
+
+-- Reusable meals of a group, CreateNewMeal fills the fields the request leaves empty from a template
+CREATE TABLE IF NOT EXISTS meal_templates
+(
+    template_id  UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    group_id     UUID         NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    title        VARCHAR(100) NOT NULL,
+    meal_type    VARCHAR(50)  NOT NULL,
+    notes        TEXT         NOT NULL DEFAULT '',
+    default_time TIME                  DEFAULT NULL, -- clock time in the time zone of the group
+    created_by   UUID         REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ           DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members that become cooks of every meal created from the template
+CREATE TABLE IF NOT EXISTS meal_template_cooks
+(
+    template_id UUID NOT NULL REFERENCES meal_templates (template_id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    PRIMARY KEY (template_id, user_id)
+);
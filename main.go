@@ -6,10 +6,19 @@ import (
 	"enguete/modules/management"
 	"enguete/modules/meal"
 	"enguete/modules/user"
+	"enguete/util/auth"
 	"enguete/util/db"
+	"enguete/util/hashing"
+	"enguete/util/jwt"
+	"enguete/util/mailer"
+	"enguete/util/oidc"
+	"enguete/util/scheduler"
+	"enguete/util/throttle"
 	"enguete/util/validator"
 	"github.com/joho/godotenv"
 	"os"
+	"strings"
+	"time"
 
 	"log"
 	"net/http"
@@ -33,16 +42,60 @@ func main() {
 	}
 	dbConnection := db.InitDB(dbURL)
 
+	err := jwt.InitKeyRing()
+	if err != nil {
+		log.Fatal("❌ Could not load JWT keys: ", err)
+	}
+
+	err = hashing.InitTokenHashKey()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	err = mailer.InitMailer()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	err = oidc.InitProviders()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	err = throttle.InitThrottle(dbConnection)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
 	validator.InitCustomValidators()
 
+	scheduler.Every("prune sign in throttle", time.Minute*10, throttle.Prune)
+	scheduler.Every("remove expired bans", time.Minute*15, func() error {
+		return management.DeleteExpiredBansInDB(dbConnection)
+	})
+	scheduler.Every("generate meal series occurrences", time.Hour, func() error {
+		return meal.GenerateSeriesOccurrencesInDB(dbConnection)
+	})
+	scheduler.Every("close meals after preference deadline", time.Minute, func() error {
+		return meal.CloseMealsAfterDeadlineInDB(dbConnection)
+	})
+
 	router := gin.Default()
+	err = router.SetTrustedProxies(trustedProxies())
+	if err != nil {
+		log.Fatal("❌ Invalid TRUSTED_PROXIES: ", err)
+	}
 	router.Use(corsMiddleware())
 
-	dev.RegisterDevRoutes(router, dbConnection)
-	user.RegisterUserRoute(router, dbConnection)
-	group.RegisterGroupRoute(router, dbConnection)
-	meal.RegisterMealRoute(router, dbConnection)
-	management.RegisterManagementRoute(router, dbConnection)
+	// every route that needs a signed in user goes into authenticated, so no handler can forget the check
+	public := router.Group("/")
+	authenticated := router.Group("/", auth.Authenticate(dbConnection))
+
+	dev.RegisterDevRoutes(public, dbConnection)
+	user.RegisterUserRoute(public, authenticated, dbConnection)
+	group.RegisterGroupRoute(authenticated, dbConnection)
+	meal.RegisterMealRoute(authenticated, dbConnection)
+	management.RegisterManagementRoute(authenticated, dbConnection)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -53,12 +106,24 @@ func main() {
 	log.Fatal(router.Run(baseUrl))
 }
 
+// trustedProxies reads TRUSTED_PROXIES. Without proxies gin ignores X-Forwarded-For, so clients can't spoof their ip.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // corsMiddleware sets the CORS headers to allow all origins.
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, RefreshToken")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, RefreshToken, DeviceName")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -5,10 +5,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterDevRoutes(router *gin.Engine, db *sql.DB) {
+func RegisterDevRoutes(router *gin.RouterGroup, db *sql.DB) {
 	registerTestRoutes(router, db)
 }
-func registerTestRoutes(router *gin.Engine, db *sql.DB) {
+func registerTestRoutes(router *gin.RouterGroup, db *sql.DB) {
 
 	router.POST("/test/jwtAuth", func(c *gin.Context) {
 		CheckValidJWT(c)
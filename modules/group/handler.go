@@ -2,46 +2,67 @@ package group
 
 import (
 	"database/sql"
+	"enguete/util/roles"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterGroupRoute(router *gin.Engine, db *sql.DB) {
+func RegisterGroupRoute(router *gin.RouterGroup, db *sql.DB) {
 	registerGroupRoutes(router, db)
 	registerInviteTokenRoutes(router, db)
+	registerJoinRequestRoutes(router, db)
+	registerInvitationRoutes(router, db)
 	registerSyncRoutes(router, db)
 }
 
-func registerGroupRoutes(router *gin.Engine, db *sql.DB) {
+func registerGroupRoutes(router *gin.RouterGroup, db *sql.DB) {
 	router.POST("/groups", func(c *gin.Context) {
 		CreateNewGroup(c, db)
 	})
-	router.PUT("/groups/name", func(c *gin.Context) {
+	router.PUT("/groups/name", RequireGroupPermission(db, FromJSON("groupId"), roles.CanUpdateGroup), func(c *gin.Context) {
 		UpdateGroupName(c, db)
 	})
-	router.GET("/groups/members", func(c *gin.Context) {
+	router.GET("/groups/policies", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
+		GetGroupPolicies(c, db)
+	})
+	router.PUT("/groups/policies", RequireGroupPermission(db, FromJSON("groupId"), roles.CanUpdateGroupPolicies), func(c *gin.Context) {
+		UpdateGroupPolicies(c, db)
+	})
+	router.GET("/groups/settings", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
+		GetGroupSettings(c, db)
+	})
+	router.PUT("/groups/settings", RequireGroupPermission(db, FromJSON("groupId"), roles.CanUpdateGroup), func(c *gin.Context) {
+		UpdateGroupSettings(c, db)
+	})
+	router.GET("/groups/members", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		GetGroupMembers(c, db)
 	})
-	router.GET("/groups", func(c *gin.Context) {
+	router.GET("/groups", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		GetGroupById(c, db)
 	})
-	router.GET("/groups/meals", func(c *gin.Context) {
+	router.GET("/groups/meals", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		GetGroupMeals(c, db)
 	})
-	router.DELETE("/groups/", func(c *gin.Context) {
+	router.DELETE("/groups/", RequireGroupPermission(db, FromQuery("groupId"), roles.CanDeleteGroup), func(c *gin.Context) {
 		DeleteGroup(c, db)
 	})
-	router.DELETE("/groups/leave", func(c *gin.Context) {
+	router.DELETE("/groups/leave", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		LeaveGroup(c, db)
 	})
+	router.PUT("/groups/owner", RequireGroupPermission(db, FromJSON("groupId"), roles.CanPromoteToAdmins), func(c *gin.Context) {
+		TransferGroupOwnership(c, db)
+	})
 }
 
-func registerInviteTokenRoutes(router *gin.Engine, db *sql.DB) {
-	router.GET("/groups/invite/", func(c *gin.Context) {
+func registerInviteTokenRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/groups/invite/", RequireGroupPermission(db, FromQuery("groupId"), roles.CanViewInviteLinks), func(c *gin.Context) {
 		GetAllInviteTokensInAGroup(c, db)
 	})
-	router.POST("/groups/invite/", func(c *gin.Context) {
+	router.POST("/groups/invite/", RequireGroupPermission(db, FromJSON("groupId"), roles.CanCreateInviteLinks), func(c *gin.Context) {
 		GenerateInviteLink(c, db)
 	})
+	router.GET("/groups/invite/qr", RequireGroupPermission(db, FromQuery("groupId"), roles.CanViewInviteLinks), func(c *gin.Context) {
+		GetInviteQrCode(c, db)
+	})
 	router.DELETE("/groups/invite/", func(c *gin.Context) {
 		VoidInviteToken(c, db)
 	})
@@ -50,14 +71,55 @@ func registerInviteTokenRoutes(router *gin.Engine, db *sql.DB) {
 	})
 }
 
-func registerSyncRoutes(router *gin.Engine, db *sql.DB) {
+func registerJoinRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/groups/join-requests", RequireGroupPermission(db, FromQuery("groupId"), roles.CanManageJoinRequests), func(c *gin.Context) {
+		GetGroupJoinRequests(c, db)
+	})
+	router.POST("/groups/join-requests/approve", RequireGroupPermission(db, FromJSON("groupId"), roles.CanManageJoinRequests), func(c *gin.Context) {
+		ApproveJoinRequest(c, db)
+	})
+	router.POST("/groups/join-requests/reject", RequireGroupPermission(db, FromJSON("groupId"), roles.CanManageJoinRequests), func(c *gin.Context) {
+		RejectJoinRequest(c, db)
+	})
+	router.GET("/groups/join-requests/own", func(c *gin.Context) {
+		GetOwnJoinRequests(c, db)
+	})
+	router.DELETE("/groups/join-requests/own", func(c *gin.Context) {
+		CancelOwnJoinRequest(c, db)
+	})
+}
+
+func registerInvitationRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/groups/invitations", RequireGroupPermission(db, FromQuery("groupId"), roles.CanViewInviteLinks), func(c *gin.Context) {
+		GetGroupInvitations(c, db)
+	})
+	router.POST("/groups/invitations", RequireGroupPermission(db, FromJSON("groupId"), roles.CanCreateInviteLinks), func(c *gin.Context) {
+		CreateInvitation(c, db)
+	})
+	router.DELETE("/groups/invitations", RequireGroupPermission(db, FromQuery("groupId"), roles.CanVoidInviteLinks), func(c *gin.Context) {
+		RevokeInvitation(c, db)
+	})
+
+	// the invited user answers in their account, the routes live here because the user module can't import groups
+	router.GET("/users/invitations", func(c *gin.Context) {
+		GetOwnInvitations(c, db)
+	})
+	router.POST("/users/invitations/accept", func(c *gin.Context) {
+		AcceptInvitation(c, db)
+	})
+	router.POST("/users/invitations/decline", func(c *gin.Context) {
+		DeclineInvitation(c, db)
+	})
+}
+
+func registerSyncRoutes(router *gin.RouterGroup, db *sql.DB) {
 	router.GET("/sync/groups", func(c *gin.Context) {
 		SyncAllGroups(c, db)
 	})
-	router.GET("/sync/group", func(c *gin.Context) {
+	router.GET("/sync/group", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		SyncSpecificGroup(c, db)
 	})
-	router.GET("/sync/group/members", func(c *gin.Context) {
+	router.GET("/sync/group/members", RequireGroupMember(db, FromQuery("groupId")), func(c *gin.Context) {
 		SyncGroupMembers(c, db)
 	})
 }
@@ -2,10 +2,149 @@ package group
 
 import (
 	"database/sql"
+	"enguete/modules/user"
+	"enguete/util/auth"
+	"enguete/util/dates"
+	"enguete/util/frontendErrors"
+	"enguete/util/jwt"
+	"enguete/util/responses"
 	"enguete/util/roles"
 	"errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
+var ErrInvalidTimeZone = errors.New("invalid time zone")
+var ErrInvalidLocale = errors.New("invalid locale")
+var ErrInvalidMealTime = errors.New("invalid meal time")
+
+// defaultGroupSettings are the settings of groups that never changed them.
+func defaultGroupSettings(groupId string) GroupSettings {
+	return GroupSettings{
+		GroupId:   groupId,
+		TimeZone:  "UTC",
+		WeekStart: int(time.Monday),
+		Locale:    "en",
+		MealTypes: []string{"Breakfast", "Lunch", "Dinner"},
+		DefaultMealTimes: map[string]string{
+			"Breakfast": "08:00",
+			"Lunch":     "12:00",
+			"Dinner":    "18:30",
+		},
+	}
+}
+
+// Location returns the time zone of the group. Only valid zones get saved.
+func (s GroupSettings) Location() (*time.Location, error) {
+	return time.LoadLocation(s.TimeZone)
+}
+
+// applyGroupSettingsUpdate changes the settings that are set in the request and checks the result.
+//
+// return ErrInvalidTimeZone, ErrInvalidLocale or ErrInvalidMealTime => the request contains an invalid value
+func applyGroupSettingsUpdate(settings GroupSettings, update RequestUpdateGroupSettings) (GroupSettings, error) {
+	if update.TimeZone != nil {
+		// time.LoadLocation also accepts "Local", which would be the zone of the server
+		if *update.TimeZone == "" || *update.TimeZone == "Local" {
+			return settings, ErrInvalidTimeZone
+		}
+		if _, err := time.LoadLocation(*update.TimeZone); err != nil {
+			return settings, ErrInvalidTimeZone
+		}
+		settings.TimeZone = *update.TimeZone
+	}
+	if update.WeekStart != nil {
+		settings.WeekStart = *update.WeekStart
+	}
+	if update.Locale != nil {
+		tag, err := language.Parse(*update.Locale)
+		if err != nil {
+			return settings, ErrInvalidLocale
+		}
+		settings.Locale = tag.String()
+	}
+	if update.MealTypes != nil {
+		mealTypes := []string{}
+		for _, mealType := range update.MealTypes {
+			mealType = strings.TrimSpace(mealType)
+			if mealType != "" && !slices.Contains(mealTypes, mealType) {
+				mealTypes = append(mealTypes, mealType)
+			}
+		}
+		settings.MealTypes = mealTypes
+	}
+
+	defaultMealTimes := settings.DefaultMealTimes
+	if update.DefaultMealTimes != nil {
+		defaultMealTimes = update.DefaultMealTimes
+	}
+	settings.DefaultMealTimes = map[string]string{}
+	for mealType, mealTime := range defaultMealTimes {
+		if !slices.Contains(settings.MealTypes, mealType) {
+			if update.DefaultMealTimes != nil {
+				return settings, ErrInvalidMealTime
+			}
+			continue // the meal type got removed with this update
+		}
+		if _, err := time.Parse("15:04", mealTime); err != nil {
+			return settings, ErrInvalidMealTime
+		}
+		settings.DefaultMealTimes[mealType] = mealTime
+	}
+	return settings, nil
+}
+
+func respondWithGroupSettingsError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvalidTimeZone) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidTimeZoneError, "Unknown time zone, use an IANA name like Europe/Zurich")
+		return
+	}
+	if errors.Is(err, ErrInvalidLocale) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidLocaleError, "Invalid locale, use a language tag like de-CH")
+		return
+	}
+	if errors.Is(err, ErrInvalidMealTime) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidMealTimeError, "Default meal times need a listed meal type and the format HH:MM")
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		responses.GenericGroupDoesNotExistError(c.Writer)
+		return
+	}
+	log.Println(err)
+	responses.GenericInternalServerError(c.Writer)
+}
+
+// getWeekOfGroup returns the start and end of the week that contains the date, in the time zone and with the week
+// start of the group. An invalid date falls back to the current week.
+func getWeekOfGroup(groupId string, date string, db *sql.DB) (string, string, error) {
+	settings, err := GetGroupSettingsFromDB(groupId, db)
+	if err != nil {
+		return "", "", err
+	}
+	location, err := settings.Location()
+	if err != nil {
+		return "", "", err
+	}
+
+	weekTime, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		log.Println(err)
+		weekTime = time.Now()
+	}
+
+	startOfWeek, endOfWeek := dates.GetStartAndEndOfWeek(weekTime, location, time.Weekday(settings.WeekStart))
+	return startOfWeek, endOfWeek, nil
+}
+
+// invitationLifeTime is how long an invited user can accept an invitation if the request sets no expiry.
+const invitationLifeTime = time.Hour * 24 * 7
+
 // IsUserInGroupViaMealId Check if the target user is part of the group
 //
 // return true => user is in group
@@ -35,32 +174,125 @@ func IsUserInGroup(groupId string, userId string, db *sql.DB) (bool, error) {
 	return true, nil // User is in group
 }
 
-// CheckIfUserIsAllowedToPerformActionViaMealId Check if the user is able to perform an action in a group via mealId.
-//
-// return true => user is in group and can perform action.
-//
-// return err => internal server error.
-//
-// return false => user is not in group or cant perform action
-func CheckIfUserIsAllowedToPerformActionViaMealId(mealId string, userId string, actionToPerform string, db *sql.DB) (bool, []string, error) {
-	userRoles, err := GetUserRolesInGroupViaMealId(mealId, userId, db)
-	if err != nil {
-		return false, nil, err
+// CanPerformAction Check if the roles of the membership allow the action. Personal access tokens additionally need a
+// scope that allows it.
+func (m Membership) CanPerformAction(jwtPayload jwt.JWTPayload, actionToPerform string) bool {
+	if jwtPayload.IsApiToken() && !roles.ScopesAllowAction(jwtPayload.Scopes, actionToPerform) {
+		return false
 	}
-	return roles.CanPerformAction(userRoles, actionToPerform), userRoles, nil
+	return roles.CanPerformAction(m.Permissions, actionToPerform)
 }
 
-// CheckIfUserIsAllowedToPerformAction Check if the user is able to perform an action in a group.
-//
-// return true => user is in group and can perform action.
-//
-// return err => internal server error.
-//
-// return false => user is not in group or cant perform action
-func CheckIfUserIsAllowedToPerformAction(groupId string, userId string, actionToPerform string, db *sql.DB) (isAllowedToPerformAction bool, userRoles []string, error error) {
-	userRoles, err := GetUserRolesInGroup(groupId, userId, db)
+// CheckIfRequesterCanPerformAction Check if the requester is allowed to perform an action in the group loaded by the
+// group middleware. Used when the needed permission depends on the request, like the role that gets assigned.
+func CheckIfRequesterCanPerformAction(c *gin.Context, actionToPerform string) bool {
+	return GetMembership(c).CanPerformAction(auth.GetJWTPayload(c), actionToPerform)
+}
+
+// filterGroupsForToken removes the groups a personal access token is not limited to.
+func filterGroupsForToken(groups []GroupInfo, jwtPayload jwt.JWTPayload) []GroupInfo {
+	return slices.DeleteFunc(groups, func(group GroupInfo) bool {
+		return !jwtPayload.CanAccessGroup(group.GroupId)
+	})
+}
+
+// filterJoinRequestsForToken removes the requests for groups a personal access token is not limited to.
+func filterJoinRequestsForToken(joinRequests []JoinRequest, jwtPayload jwt.JWTPayload) []JoinRequest {
+	return slices.DeleteFunc(joinRequests, func(joinRequest JoinRequest) bool {
+		return !jwtPayload.CanAccessGroup(joinRequest.GroupId)
+	})
+}
+
+// filterInvitationsForToken removes the invitations to groups a personal access token is not limited to.
+func filterInvitationsForToken(invitations []Invitation, jwtPayload jwt.JWTPayload) []Invitation {
+	return slices.DeleteFunc(invitations, func(invitation Invitation) bool {
+		return !jwtPayload.CanAccessGroup(invitation.GroupId)
+	})
+}
+
+// getInvitedUser looks the user up by username or by email, whichever the request contains.
+func getInvitedUser(invitationData RequestCreateInvitation, db *sql.DB) (user.UserFromDB, error) {
+	if invitationData.Username != "" {
+		return user.GetUserByName(invitationData.Username, db)
+	}
+	return user.GetUserByEmailFromDB(invitationData.Email, db)
+}
+
+// respondToEmailInvitation is the response to every invitation by email, whether the email belongs to a user or not,
+// so the endpoint can't be used to find out which emails are registered.
+func respondToEmailInvitation(c *gin.Context) {
+	c.JSON(http.StatusAccepted, GroupSuccess{Message: "If the email belongs to a user, they got invited"})
+}
+
+// respondWithInvitationRefusal hides the reason for invitations by email, see respondToEmailInvitation.
+func respondWithInvitationRefusal(c *gin.Context, byEmail bool, status int, frontendError string, message string) {
+	if byEmail {
+		respondToEmailInvitation(c)
+		return
+	}
+	responses.HttpErrorResponse(c.Writer, status, frontendError, message)
+}
+
+func respondWithInvitationError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvitationNotFound) {
+		responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.InvitationDoesNotExistError, "Invitation does not exist")
+		return
+	}
+	if errors.Is(err, ErrUserIsBanned) {
+		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.UserIsBannedFromGroupError, "You are banned from this group")
+		return
+	}
+	log.Println(err)
+	responses.GenericInternalServerError(c.Writer)
+}
+
+// requestToJoinGroup creates a join request instead of joining, for invites and groups that require an approval. The
+// request claims a use of the invite. A user that already waits for a decision gets the pending request back.
+func requestToJoinGroup(c *gin.Context, groupId string, inviteToken string, userId string, db *sql.DB) {
+	joinRequestId, err := GetPendingJoinRequestIdFromDB(groupId, userId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if joinRequestId != "" {
+		c.JSON(http.StatusAccepted, ResponseJoinRequest{JoinRequestId: joinRequestId, GroupId: groupId, Status: "pending"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = ClaimInviteTokenWithTransaction(inviteToken, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, ErrNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidInviteTokenError, "Invalid invite token")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	joinRequestId, err = CreateJoinRequestWithTransaction(groupId, userId, inviteToken, tx)
 	if err != nil {
-		return false, userRoles, err
+		_ = tx.Rollback()
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
 	}
-	return roles.CanPerformAction(userRoles, actionToPerform), userRoles, nil
+
+	err = tx.Commit()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, ResponseJoinRequest{JoinRequestId: joinRequestId, GroupId: groupId, Status: "pending"})
 }
@@ -0,0 +1,175 @@
+package group
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"enguete/util/auth"
+	"enguete/util/frontendErrors"
+	"enguete/util/responses"
+	"enguete/util/roles"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+	"io"
+	"log"
+	"net/http"
+)
+
+const membershipContextKey = "groupMembership"
+const membershipCacheContextKey = "groupMembershipCache"
+
+// IdSource reads the group or meal id a request is about.
+type IdSource func(c *gin.Context) string
+
+// FromQuery reads the id from a query parameter.
+func FromQuery(key string) IdSource {
+	return func(c *gin.Context) string {
+		return c.Query(key)
+	}
+}
+
+// FromJSON reads the id from a field of the JSON body. The body is put back, so the handler can still bind it.
+func FromJSON(key string) IdSource {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]any
+		if json.Unmarshal(body, &fields) != nil {
+			return ""
+		}
+		id, _ := fields[key].(string)
+		return id
+	}
+}
+
+// RequireGroupMember only lets members of the group through. The membership is available with GetMembership.
+func RequireGroupMember(db *sql.DB, groupId IdSource) gin.HandlerFunc {
+	return requireMembership(db, groupId, LoadMembership, "")
+}
+
+// RequireGroupPermission only lets members through whose roles allow the permission, a constant of roles.
+func RequireGroupPermission(db *sql.DB, groupId IdSource, permission string) gin.HandlerFunc {
+	return requireMembership(db, groupId, LoadMembership, permission)
+}
+
+// RequireMealMember works like RequireGroupMember for the group of the meal.
+func RequireMealMember(db *sql.DB, mealId IdSource) gin.HandlerFunc {
+	return requireMembership(db, mealId, LoadMembershipViaMealId, "")
+}
+
+// RequireMealPermission works like RequireGroupPermission for the group of the meal.
+func RequireMealPermission(db *sql.DB, mealId IdSource, permission string) gin.HandlerFunc {
+	return requireMembership(db, mealId, LoadMembershipViaMealId, permission)
+}
+
+type membershipLoader func(c *gin.Context, id string, db *sql.DB) (Membership, error)
+
+func requireMembership(db *sql.DB, source IdSource, load membershipLoader, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := source(c)
+		if _, err := uuid.FromString(id); err != nil {
+			responses.GenericBadRequestError(c.Writer)
+			c.Abort()
+			return
+		}
+
+		membership, err := load(c, id, db)
+		if err != nil {
+			if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
+				responses.GenericGroupDoesNotExistError(c.Writer)
+			} else {
+				log.Println(err)
+				responses.GenericInternalServerError(c.Writer)
+			}
+			c.Abort()
+			return
+		}
+
+		jwtPayload := auth.GetJWTPayload(c)
+		if permission != "" && !membership.CanPerformAction(jwtPayload, permission) {
+			respondWithNotAllowed(c, permission, jwtPayload.IsApiToken() && !roles.ScopesAllowAction(jwtPayload.Scopes, permission))
+			c.Abort()
+			return
+		}
+
+		c.Set(membershipContextKey, membership)
+		c.Next()
+	}
+}
+
+func respondWithNotAllowed(c *gin.Context, permission string, missingScope bool) {
+	switch {
+	case missingScope:
+		responses.GenericApiTokenScopeError(c.Writer)
+	case permission == roles.CanDeleteGroup:
+		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.NotAllowedToDeleteGroupError, "You are not allowed to delete this group")
+	case permission == roles.CanUpdateGroup || permission == roles.CanUpdateGroupPolicies:
+		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.NotAllowedToUpdateGroupError, "You are not allowed to update this group")
+	default:
+		responses.GenericNotAllowedToPerformActionError(c.Writer)
+	}
+}
+
+// GetMembership returns the membership loaded by the group middleware.
+func GetMembership(c *gin.Context) Membership {
+	value, _ := c.Get(membershipContextKey)
+	membership, _ := value.(Membership)
+	return membership
+}
+
+// LoadMembership returns the membership of the requester in the group, for handlers that only learn the group id
+// while handling the request. Lookups are cached for the rest of the request.
+//
+// return ErrUserIsNotPartOfThisGroup => requester is not in the group or the token is limited to another group
+func LoadMembership(c *gin.Context, groupId string, db *sql.DB) (Membership, error) {
+	return loadCachedMembership(c, "group:"+groupId, func(userId string) (Membership, error) {
+		return GetMembershipFromDB(groupId, userId, db)
+	})
+}
+
+// LoadMembershipViaMealId works like LoadMembership for the group of the meal.
+func LoadMembershipViaMealId(c *gin.Context, mealId string, db *sql.DB) (Membership, error) {
+	return loadCachedMembership(c, "meal:"+mealId, func(userId string) (Membership, error) {
+		return GetMembershipViaMealIdFromDB(mealId, userId, db)
+	})
+}
+
+func loadCachedMembership(c *gin.Context, key string, query func(userId string) (Membership, error)) (Membership, error) {
+	cache, _ := c.Value(membershipCacheContextKey).(map[string]*Membership)
+	if cache == nil {
+		cache = map[string]*Membership{}
+		c.Set(membershipCacheContextKey, cache)
+	}
+
+	if membership, ok := cache[key]; ok {
+		if membership == nil {
+			return Membership{}, ErrUserIsNotPartOfThisGroup
+		}
+		return *membership, nil
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	membership, err := query(jwtPayload.UserId)
+	if err == nil && !jwtPayload.CanAccessGroup(membership.GroupId) {
+		err = ErrUserIsNotPartOfThisGroup
+	}
+	if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
+		cache[key] = nil
+		return Membership{}, err
+	}
+	if err != nil {
+		return Membership{}, err
+	}
+
+	cache[key] = &membership
+	cache["group:"+membership.GroupId] = &membership
+	return membership, nil
+}
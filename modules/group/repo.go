@@ -2,8 +2,13 @@ package group
 
 import (
 	"database/sql"
+	"encoding/json"
+	"enguete/util/links"
+	"enguete/util/roles"
+	"enguete/util/waitlist"
 	"errors"
 	"github.com/lib/pq"
+	"time"
 )
 
 func CreateNewGroupInDBWithTransaction(groupData RequestNewGroup, userId string, tx *sql.Tx) (string, error) {
@@ -20,24 +25,36 @@ func CreateNewGroupInDBWithTransaction(groupData RequestNewGroup, userId string,
 	return groupId, nil
 }
 
+// AddUserToGroupWithTransaction adds the user to the group or activates the old membership again. The caller
+// commits or rolls back the transaction.
 func AddUserToGroupWithTransaction(groupId string, userId string, tx *sql.Tx) (string, error) {
 	var userGroupId string
 
+	// restored opt-ins lost their seat when the user left, they queue up again at the end of the waitlist
 	activatePreferencesAgainQuery := `
-		UPDATE meal_preferences mp 
-		SET deleted_at = NULL
-		FROM meals m
-		WHERE mp.meal_id = m.meal_id
-		  		AND m.group_id = $1
-		  		AND mp.user_id = $2
-		  		AND mp.deleted_at IS NOT NULL
+		WITH restored AS (
+			UPDATE meal_preferences mp
+			SET deleted_at = NULL,
+			    waitlisted_at = CASE WHEN mp.preference = 'opt-in' THEN clock_timestamp() END
+			FROM meals m
+			WHERE mp.meal_id = m.meal_id
+			AND m.group_id = $1
+			AND mp.user_id = $2
+			AND mp.deleted_at IS NOT NULL
+			RETURNING mp.meal_id, mp.preference
+		)
+		SELECT meal_id FROM restored WHERE preference = 'opt-in'
 	`
-	_, err := tx.Exec(activatePreferencesAgainQuery, groupId, userId)
+	rows, err := tx.Query(activatePreferencesAgainQuery, groupId, userId)
+	if err != nil {
+		return "", err
+	}
+	waitingMealIds, err := waitlist.ScanMealIds(rows)
+	if err != nil {
+		return "", err
+	}
+	err = waitlist.PromoteMealsWithTransaction(waitingMealIds, tx)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return "", transactionErr
-		}
 		return "", err
 	}
 
@@ -49,17 +66,9 @@ func AddUserToGroupWithTransaction(groupId string, userId string, tx *sql.Tx) (s
 	`
 	err = tx.QueryRow(updateQuery, groupId, userId).Scan(&userGroupId)
 	if err == nil {
-		transactionErr := tx.Commit()
-		if transactionErr != nil {
-			return "", transactionErr
-		}
 		return userGroupId, nil
 	}
 	if !errors.Is(err, sql.ErrNoRows) {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return "", transactionErr
-		}
 		return "", err
 	}
 
@@ -70,60 +79,88 @@ func AddUserToGroupWithTransaction(groupId string, userId string, tx *sql.Tx) (s
 	`
 	err = tx.QueryRow(insertQuery, groupId, userId).Scan(&userGroupId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return "", transactionErr
-		}
 		return "", err
 	}
 
-	transactionErr := tx.Commit()
-	if transactionErr != nil {
-		return "", transactionErr
-	}
-
 	return userGroupId, nil
 }
 
+// CreateDefaultRolesInDBWithTransaction seeds the default roles of roles.DefaultRoles for a new group.
+func CreateDefaultRolesInDBWithTransaction(groupId string, tx *sql.Tx) error {
+	query := `INSERT INTO group_roles (group_id, name, permissions, is_default) VALUES ($1, $2, $3, TRUE)`
+	for _, role := range roles.DefaultRoles {
+		_, err := tx.Exec(query, groupId, role, pq.Array(roles.DefaultPermissionsOfRole(role)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func AddRoleToUserInGroupWithTransaction(groupId string, userId string, role string, userGroupId string, tx *sql.Tx) error {
 	query := `INSERT INTO user_group_roles (group_id, user_id, role, user_groups_id) VALUES ($1, $2, $3, $4)`
 	_, err := tx.Exec(query, groupId, userId, role, userGroupId)
 	return err
 }
 
+// AddRoleToUserInGroup returns ErrNothingHappened if the user already has the role or is not a member.
 func AddRoleToUserInGroup(groupId string, userId string, role string, db *sql.DB) error {
-	query := `INSERT INTO user_group_roles (group_id, user_id, role) VALUES ($1, $2, $3)`
-	_, err := db.Exec(query, groupId, userId, role)
+	query := `
+	INSERT INTO user_group_roles (group_id, user_id, role, user_groups_id)
+	SELECT ug.group_id, ug.user_id, $3, ug.user_group_id
+	FROM user_groups ug
+	WHERE ug.group_id = $1 AND ug.user_id = $2 AND ug.deleted_at IS NULL
+	ON CONFLICT ON CONSTRAINT unique_user_group_roles DO NOTHING
+`
+	result, err := db.Exec(query, groupId, userId, role)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNothingHappened
-		}
 		return err
 	}
-	return err
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNothingHappened
+	}
+	return nil
 }
 
 func DeleteGroupInDB(groupId string, db *sql.DB) error {
-
 	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 
+	err = DeleteGroupWithTransaction(groupId, tx)
 	if err != nil {
+		_ = tx.Rollback()
 		return err
 	}
 
+	return tx.Commit()
+}
+
+// DeleteGroupWithTransaction works like DeleteGroupInDB, the caller commits or rolls back the transaction.
+//
+// return ErrNothingHappened => the group doesn't exist or is already deleted
+func DeleteGroupWithTransaction(groupId string, tx *sql.Tx) error {
 	updateGroupQuery := `
 		UPDATE groups
 		SET deleted_at = NOW()
 		WHERE group_id = $1 AND deleted_at IS NULL
 	`
-	_, err = tx.Exec(updateGroupQuery, groupId)
+	result, err := tx.Exec(updateGroupQuery, groupId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
+	if rowsAffected == 0 {
+		return ErrNothingHappened
+	}
 
 	// Delete user <-> group links
 	deleteUserGroupsQuery := `
@@ -132,10 +169,6 @@ func DeleteGroupInDB(groupId string, db *sql.DB) error {
 	`
 	_, err = tx.Exec(deleteUserGroupsQuery, groupId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 
@@ -147,10 +180,6 @@ func DeleteGroupInDB(groupId string, db *sql.DB) error {
 	`
 	_, err = tx.Exec(deleteMealPreferencesQuery, groupId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 	deleteMealsQuery := `
@@ -159,10 +188,6 @@ func DeleteGroupInDB(groupId string, db *sql.DB) error {
 	`
 	_, err = tx.Exec(deleteMealsQuery, groupId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 	deleteRolesQuery := `
@@ -171,10 +196,6 @@ func DeleteGroupInDB(groupId string, db *sql.DB) error {
 	`
 	_, err = tx.Exec(deleteRolesQuery, groupId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 
@@ -183,15 +204,6 @@ func DeleteGroupInDB(groupId string, db *sql.DB) error {
 		WHERE group_id = $1
 	`
 	_, err = tx.Exec(deleteInvitesQuery, groupId)
-	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
-		return err
-	}
-
-	err = tx.Commit()
 	if err != nil {
 		return err
 	}
@@ -219,6 +231,58 @@ func UpdateGroupNameInDB(groupInfo RequestUpdateGroupName, db *sql.Tx) error {
 	return nil
 }
 
+// effectiveRoleCondition filters out the admin role of users without two-factor authentication in groups that
+// require it, the role stays assigned and applies again once the user enables two-factor authentication.
+// alias is the alias of user_group_roles in the query.
+func effectiveRoleCondition(alias string) string {
+	return `
+	AND NOT (
+		` + alias + `.role = 'admin'
+		AND EXISTS (SELECT 1 FROM groups pg WHERE pg.group_id = ` + alias + `.group_id AND pg.require_admin_two_factor)
+		AND NOT EXISTS (SELECT 1 FROM user_two_factor utf WHERE utf.user_id = ` + alias + `.user_id AND utf.enabled_at IS NOT NULL)
+	)`
+}
+
+func GetGroupPoliciesFromDB(groupId string, db *sql.DB) (GroupPolicies, error) {
+	query := `
+		SELECT group_id, require_verified_email, require_admin_two_factor, require_join_approval
+		FROM groups
+		WHERE group_id = $1
+		AND deleted_at IS NULL
+	`
+	var policies GroupPolicies
+	err := db.QueryRow(query, groupId).Scan(&policies.GroupId, &policies.RequireVerifiedEmail, &policies.RequireAdminTwoFactor, &policies.RequireJoinApproval)
+	if errors.Is(err, sql.ErrNoRows) {
+		return policies, ErrNotFound
+	}
+	return policies, err
+}
+
+// UpdateGroupPoliciesInDB only changes the policies that are set in the request.
+func UpdateGroupPoliciesInDB(policies RequestUpdateGroupPolicies, db *sql.DB) error {
+	query := `
+		UPDATE groups
+		SET require_verified_email = COALESCE($2, require_verified_email),
+		    require_admin_two_factor = COALESCE($3, require_admin_two_factor),
+		    require_join_approval = COALESCE($4, require_join_approval)
+		WHERE group_id = $1
+		AND deleted_at IS NULL
+	`
+	result, err := db.Exec(query, policies.GroupId, policies.RequireVerifiedEmail, policies.RequireAdminTwoFactor, policies.RequireJoinApproval)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNothingHappened
+	}
+	return nil
+}
+
 func GetGroupInformationFromDb(groupId string, userId string, db *sql.DB) (GroupInfo, error) {
 	query := `
 	SELECT
@@ -228,7 +292,7 @@ func GetGroupInformationFromDb(groupId string, userId string, db *sql.DB) (Group
 	    ARRAY_AGG(ur.role) AS user_roles
 	FROM groups g 
 	LEFT JOIN user_groups ug ON ug.group_id = g.group_id
-	LEFT JOIN user_group_roles ur ON ur.group_id = g.group_id AND ur.user_id = $2
+	LEFT JOIN user_group_roles ur ON ur.group_id = g.group_id AND ur.user_id = $2` + effectiveRoleCondition("ur") + `
 	WHERE g.group_id = $1
 	AND g.deleted_at IS NULL
 	AND ug.deleted_at IS NULL
@@ -336,17 +400,30 @@ func GetMealsInGroupDB(filters FilterGroupRequest, userId string, db *sql.DB) ([
             m.date_time,
             m.meal_type,
             m.notes,
-            COUNT(CASE WHEN mp.preference != 'undecided' THEN 1 END) AS participant_count,
+            COALESCE(SUM(CASE WHEN mp.preference = 'opt-in' AND mp.waitlisted_at IS NULL THEN 1 + mp.guest_count END), 0) AS participant_count,
+            COALESCE(SUM(CASE WHEN mp.preference = 'maybe' THEN 1 + mp.guest_count END), 0) AS maybe_count,
             COALESCE(user_pref.preference, 'undecided') AS user_preference,
-            COALESCE(user_pref.is_cook, FALSE) AS is_cook
+            COALESCE(user_pref.is_cook, FALSE) AS is_cook,
+            m.series_id,
+            COALESCE(m.preference_deadline, m.date_time - make_interval(mins => m.preference_deadline_offset)) AS preference_deadline,
+            COUNT(CASE WHEN mp.waitlisted_at IS NOT NULL THEN 1 END) AS waitlist_count,
+            m.max_participants,
+            CASE WHEN user_pref.waitlisted_at IS NOT NULL THEN (
+                SELECT COUNT(*)
+                FROM meal_preferences w
+                WHERE w.meal_id = m.meal_id
+                AND w.deleted_at IS NULL
+                AND w.waitlisted_at IS NOT NULL
+                AND (w.waitlisted_at, w.preference_id) <= (user_pref.waitlisted_at, user_pref.preference_id)
+            ) END AS user_waitlist_position
         FROM meals m
         LEFT JOIN meal_preferences mp ON mp.meal_id = m.meal_id AND mp.deleted_at IS NULL
         LEFT JOIN meal_preferences user_pref ON user_pref.meal_id = m.meal_id AND user_pref.user_id = $2 AND user_pref.deleted_at IS NULL
         WHERE m.group_id = $1
     	AND m.deleted_at IS NULL
-        AND ($3::timestamp IS NULL OR $4::timestamp IS NULL OR m.date_time BETWEEN $3 AND $4)
+        AND ($3::timestamptz IS NULL OR $4::timestamptz IS NULL OR m.date_time BETWEEN $3 AND $4)
 	
-        GROUP BY m.meal_id, user_pref.preference, m.date_time
+        GROUP BY m.meal_id, user_pref.preference_id, user_pref.preference, user_pref.is_cook, user_pref.waitlisted_at, m.date_time
         ORDER BY m.date_time desc 
 `
 	rows, err := db.Query(query, filters.GroupId, userId, filters.StartDateFilter, filters.EndDateFilter)
@@ -372,8 +449,14 @@ func GetMealsInGroupDB(filters FilterGroupRequest, userId string, db *sql.DB) ([
 			&mealCard.MealType,
 			&mealCard.Notes,
 			&mealCard.ParticipantCount,
+			&mealCard.MaybeCount,
 			&mealCard.UserPreference,
 			&mealCard.IsCook,
+			&mealCard.SeriesId,
+			&mealCard.PreferenceDeadline,
+			&mealCard.WaitlistCount,
+			&mealCard.MaxParticipants,
+			&mealCard.UserWaitlistPosition,
 		)
 		if err != nil {
 			return mealCards, err
@@ -387,16 +470,248 @@ func GetMealsInGroupDB(filters FilterGroupRequest, userId string, db *sql.DB) ([
 
 var ErrNothingHappened = errors.New("nothing happened")
 
+var ErrLastAdmin = errors.New("the group needs at least one admin")
+
+// RemoveRoleFromUserInGroup returns ErrLastAdmin instead of removing the admin role from the last admin of the group.
 func RemoveRoleFromUserInGroup(groupId string, userId string, role string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = removeRoleFromUserWithTransaction(groupId, userId, role, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func removeRoleFromUserWithTransaction(groupId string, userId string, role string, tx *sql.Tx) error {
+	err := lockGroupWithTransaction(groupId, tx)
+	if err != nil {
+		return err
+	}
+
 	query := `DELETE FROM user_group_roles WHERE group_id = $1 AND user_id = $2 AND role = $3 RETURNING group_id`
 	var groupIdTmp string
-	err := db.QueryRow(query, groupId, userId, role).Scan(&groupIdTmp)
+	err = tx.QueryRow(query, groupId, userId, role).Scan(&groupIdTmp)
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNothingHappened
 	}
+	if err != nil {
+		return err
+	}
+
+	if role == roles.AdminRole {
+		adminCount, err := countAdminsWithTransaction(groupId, tx)
+		if err != nil {
+			return err
+		}
+		if adminCount == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	return nil
+}
+
+// lockGroupWithTransaction makes changes to the members and admins of a group wait for the transaction, so two
+// admins leaving at the same time can't both see the other one as remaining admin.
+func lockGroupWithTransaction(groupId string, tx *sql.Tx) error {
+	query := `SELECT group_id FROM groups WHERE group_id = $1 AND deleted_at IS NULL FOR UPDATE`
+	var groupIdTmp string
+	err := tx.QueryRow(query, groupId).Scan(&groupIdTmp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
 	return err
 }
 
+// countAdminsWithTransaction counts the members that have the admin role assigned, even if the two-factor policy
+// currently suspends it.
+func countAdminsWithTransaction(groupId string, tx *sql.Tx) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM user_group_roles ugr
+		INNER JOIN user_groups ug ON ug.user_group_id = ugr.user_groups_id
+		WHERE ugr.group_id = $1
+		AND ugr.role = $2
+		AND ug.deleted_at IS NULL
+	`
+	var adminCount int
+	err := tx.QueryRow(query, groupId, roles.AdminRole).Scan(&adminCount)
+	return adminCount, err
+}
+
+// LeaveGroupInDB removes the user from the group. If they were the last member the group gets deleted, if they were
+// the last admin the member that joined first becomes admin. Ownership moves to the admin that joined first.
+//
+// return ErrNoMatchingGroupOrUser => the user is not a member of the group
+func LeaveGroupInDB(userId string, groupId string, db *sql.DB) (LeaveResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return LeaveResult{}, err
+	}
+
+	result, err := leaveGroupWithTransaction(userId, groupId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return result, err
+	}
+
+	return result, tx.Commit()
+}
+
+func leaveGroupWithTransaction(userId string, groupId string, tx *sql.Tx) (LeaveResult, error) {
+	var result LeaveResult
+
+	err := lockGroupWithTransaction(groupId, tx)
+	if errors.Is(err, ErrNotFound) {
+		return result, ErrNoMatchingGroupOrUser
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = RemoveUserFromGroupWithTransaction(userId, groupId, tx)
+	if err != nil {
+		return result, err
+	}
+
+	countMembersQuery := `SELECT COUNT(*) FROM user_groups WHERE group_id = $1 AND deleted_at IS NULL`
+	var memberCount int
+	err = tx.QueryRow(countMembersQuery, groupId).Scan(&memberCount)
+	if err != nil {
+		return result, err
+	}
+	if memberCount == 0 {
+		err = DeleteGroupWithTransaction(groupId, tx)
+		if err != nil {
+			return result, err
+		}
+		result.GroupDeleted = true
+		return result, nil
+	}
+
+	adminCount, err := countAdminsWithTransaction(groupId, tx)
+	if err != nil {
+		return result, err
+	}
+	if adminCount == 0 {
+		promoteQuery := `
+			INSERT INTO user_group_roles (group_id, user_id, role, user_groups_id)
+			SELECT ug.group_id, ug.user_id, $2, ug.user_group_id
+			FROM user_groups ug
+			WHERE ug.group_id = $1
+			AND ug.deleted_at IS NULL
+			ORDER BY ug.joined_at, ug.user_group_id
+			LIMIT 1
+			RETURNING user_id
+		`
+		err = tx.QueryRow(promoteQuery, groupId, roles.AdminRole).Scan(&result.NewAdminId)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	transferOwnershipQuery := `
+		UPDATE groups
+		SET created_by = (
+			SELECT ug.user_id
+			FROM user_groups ug
+			INNER JOIN user_group_roles ugr ON ugr.user_groups_id = ug.user_group_id AND ugr.role = $3
+			WHERE ug.group_id = $1
+			AND ug.deleted_at IS NULL
+			ORDER BY ug.joined_at, ug.user_group_id
+			LIMIT 1
+		), updated_at = NOW()
+		WHERE group_id = $1
+		AND created_by = $2
+	`
+	_, err = tx.Exec(transferOwnershipQuery, groupId, userId, roles.AdminRole)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+var ErrNotTheOwner = errors.New("the user doesn't own the group")
+
+// TransferGroupOwnershipInDB makes the new owner an admin and owner of the group. Unless keepAdminRole is set the old
+// owner loses the admin role and stays a normal member.
+//
+// return ErrNotTheOwner => oldOwnerId doesn't own the group
+//
+// return ErrUserIsNotPartOfThisGroup => the new owner is not a member of the group
+func TransferGroupOwnershipInDB(groupId string, oldOwnerId string, newOwnerId string, keepAdminRole bool, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = transferGroupOwnershipWithTransaction(groupId, oldOwnerId, newOwnerId, keepAdminRole, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func transferGroupOwnershipWithTransaction(groupId string, oldOwnerId string, newOwnerId string, keepAdminRole bool, tx *sql.Tx) error {
+	err := lockGroupWithTransaction(groupId, tx)
+	if err != nil {
+		return err
+	}
+
+	var isOwner bool
+	err = tx.QueryRow(`SELECT COALESCE(created_by = $2, FALSE) FROM groups WHERE group_id = $1`, groupId, oldOwnerId).Scan(&isOwner)
+	if err != nil {
+		return err
+	}
+	if !isOwner {
+		return ErrNotTheOwner
+	}
+
+	promoteQuery := `
+		INSERT INTO user_group_roles (group_id, user_id, role, user_groups_id)
+		SELECT ug.group_id, ug.user_id, $3, ug.user_group_id
+		FROM user_groups ug
+		WHERE ug.group_id = $1
+		AND ug.user_id = $2
+		AND ug.deleted_at IS NULL
+		ON CONFLICT ON CONSTRAINT unique_user_group_roles DO UPDATE SET role = EXCLUDED.role
+		RETURNING user_id
+	`
+	var newOwnerIdTmp string
+	err = tx.QueryRow(promoteQuery, groupId, newOwnerId, roles.AdminRole).Scan(&newOwnerIdTmp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserIsNotPartOfThisGroup
+	}
+	if err != nil {
+		return err
+	}
+
+	if !keepAdminRole {
+		demoteQuery := `DELETE FROM user_group_roles WHERE group_id = $1 AND user_id = $2 AND role = $3`
+		_, err = tx.Exec(demoteQuery, groupId, oldOwnerId, roles.AdminRole)
+		if err != nil {
+			return err
+		}
+	}
+
+	ownerQuery := `UPDATE groups SET created_by = $2, updated_at = NOW() WHERE group_id = $1`
+	_, err = tx.Exec(ownerQuery, groupId, newOwnerId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 var ErrUserIsNotPartOfThisGroup = errors.New("user is not part of this group")
 
 func IsUserMemberOfGroupViaMealId(mealId string, userId string, db *sql.DB) (string, error) {
@@ -444,90 +759,61 @@ func IsUserMemberOfGroupInDB(groupId string, userId string, db *sql.DB) (int, er
 	return exists, err
 }
 
-func GetUserRolesInGroup(groupId string, userId string, db *sql.DB) ([]string, error) {
-	query := `
-	SELECT role
-	FROM user_group_roles
-	WHERE user_id = $1
-	AND group_id = $2
-`
-	rows, err := db.Query(query, userId, groupId)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrUserIsNotPartOfThisGroup
-		}
-		return nil, err
-	}
-
-	var userRoles []string
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-
-		}
-	}(rows)
-
-	for rows.Next() {
-		var userRole string
-		err := rows.Scan(&userRole)
-		if err != nil {
-			return userRoles, err
-		}
-		userRoles = append(userRoles, userRole)
-	}
-
-	return userRoles, nil
-}
-
-func GetUserRolesInGroupViaMealId(mealId string, userId string, db *sql.DB) ([]string, error) {
-	query := `
-	SELECT ugr.role
-	FROM user_group_roles ugr
-	LEFT JOIN meals m ON m.group_id = ugr.group_id
-	LEFT JOIN user_groups ug ON ug.group_id = ugr.group_id
-	WHERE m.meal_id = $2
-	AND ugr.user_id = $1
+// membershipQuery loads membership, effective roles and the permissions of these roles of a user in one query. The
+// role condition is part of the join, so members without an effective role are still found. join and where narrow
+// the query down to one group, $1 is the user.
+func membershipQuery(join string, where string) string {
+	return `
+	SELECT ug.group_id,
+	       COALESCE(ARRAY_AGG(DISTINCT ugr.role) FILTER (WHERE ugr.role IS NOT NULL), '{}'),
+	       COALESCE(ARRAY_AGG(DISTINCT rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+	FROM user_groups ug
+	INNER JOIN groups g ON g.group_id = ug.group_id` + join + `
+	LEFT JOIN user_group_roles ugr ON ugr.user_groups_id = ug.user_group_id` + effectiveRoleCondition("ugr") + `
+	LEFT JOIN group_roles gr ON gr.group_id = ugr.group_id AND gr.name = ugr.role
+	LEFT JOIN LATERAL UNNEST(gr.permissions) AS rp(permission) ON TRUE
+	WHERE ug.user_id = $1` + where + `
 	AND ug.deleted_at IS NULL
-	AND m.deleted_at IS NULL
+	AND g.deleted_at IS NULL
+	GROUP BY ug.group_id
 `
-	rows, err := db.Query(query, userId, mealId)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrUserIsNotPartOfThisGroup
-		}
-		return nil, err
-	}
+}
 
-	var userRoles []string
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
+// GetMembershipFromDB returns the roles of the user in the group, ErrUserIsNotPartOfThisGroup if the user is not a member.
+func GetMembershipFromDB(groupId string, userId string, db *sql.DB) (Membership, error) {
+	query := membershipQuery("", `
+	AND ug.group_id = $2`)
+	return scanMembership(db.QueryRow(query, userId, groupId))
+}
 
-		}
-	}(rows)
+// GetMembershipViaMealIdFromDB works like GetMembershipFromDB for the group of the meal.
+func GetMembershipViaMealIdFromDB(mealId string, userId string, db *sql.DB) (Membership, error) {
+	query := membershipQuery(`
+	INNER JOIN meals m ON m.group_id = ug.group_id`, `
+	AND m.meal_id = $2
+	AND m.deleted_at IS NULL`)
+	return scanMembership(db.QueryRow(query, userId, mealId))
+}
 
-	for rows.Next() {
-		var userRole string
-		err := rows.Scan(&userRole)
-		if err != nil {
-			return userRoles, err
-		}
-		userRoles = append(userRoles, userRole)
+func scanMembership(row *sql.Row) (Membership, error) {
+	var membership Membership
+	err := row.Scan(&membership.GroupId, pq.Array(&membership.Roles), pq.Array(&membership.Permissions))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Membership{}, ErrUserIsNotPartOfThisGroup
 	}
-	return userRoles, nil
+	return membership, err
 }
 
-func CreateNewInviteInDBWithTransaction(inviteData InviteLinkGenerationRequest, tx *sql.Tx) (string, error) {
+func CreateNewInviteInDBWithTransaction(inviteData InviteLinkGenerationRequest, createdBy string, tx *sql.Tx) (string, error) {
 	query := `
 		INSERT INTO group_invites 
-		    (group_id, expires_at)
+		    (group_id, expires_at, created_by, label, max_uses, requires_approval)
 		VALUES 
-		    ($1, $2)
+		    ($1, $2, $3, $4, $5, $6)
 		RETURNING invite_token`
 	var inviteToken string
 
-	err := tx.QueryRow(query, inviteData.GroupId, inviteData.ExpirationDateTime).Scan(&inviteToken)
+	err := tx.QueryRow(query, inviteData.GroupId, inviteData.ExpirationDateTime, createdBy, inviteData.Label, inviteData.MaxUses, inviteData.RequiresApproval).Scan(&inviteToken)
 	if err != nil {
 		return "", err
 	}
@@ -536,30 +822,126 @@ func CreateNewInviteInDBWithTransaction(inviteData InviteLinkGenerationRequest,
 
 var ErrNotFound = errors.New("not found")
 
-func ValidateInviteTokenInDB(inviteToken string, db *sql.DB) (string, error) {
+// inviteIsUsableCondition is true for invites that are not voided, expired or used up. The alias of group_invites is gi.
+const inviteIsUsableCondition = `
+		AND gi.deleted_at IS NULL
+		AND (gi.expires_at IS NULL OR gi.expires_at > NOW())
+		AND (gi.max_uses IS NULL OR gi.use_count < gi.max_uses)`
+
+// ValidateInviteTokenInDB returns the group of an invite that can still be used to join and whether joining through
+// it needs an approval.
+//
+// return ErrNotFound => the invite doesn't exist, was voided, is expired or used up
+func ValidateInviteTokenInDB(inviteToken string, db *sql.DB) (string, bool, error) {
 	query := `
-
-		SELECT group_id FROM group_invites
-		WHERE invite_token = $1
-	`
+		SELECT gi.group_id, gi.requires_approval OR g.require_join_approval
+		FROM group_invites gi
+		INNER JOIN groups g ON g.group_id = gi.group_id
+		WHERE gi.invite_token = $1` + inviteIsUsableCondition
 
 	var groupId string
-	err := db.QueryRow(query, inviteToken).Scan(&groupId)
+	var requiresApproval bool
+	err := db.QueryRow(query, inviteToken).Scan(&groupId, &requiresApproval)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrNotFound
+			return "", false, ErrNotFound
 		}
-		return "", err
+		return "", false, err
+	}
+	return groupId, requiresApproval, err
+}
+
+// GetGroupIdOfInviteTokenFromDB also finds invites that can't be used anymore.
+func GetGroupIdOfInviteTokenFromDB(inviteToken string, db *sql.DB) (string, error) {
+	query := `SELECT group_id FROM group_invites WHERE invite_token = $1`
+
+	var groupId string
+	err := db.QueryRow(query, inviteToken).Scan(&groupId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
 	}
 	return groupId, err
 }
 
-func GetAllInviteTokensInAGroupFromDB(groupId string, db *sql.DB) ([]InviteToken, error) {
+// GetInviteStateFromDB returns the group of the invite and whether it can still be used to join, with the same
+// condition as joining.
+//
+// return ErrNotFound => the invite doesn't exist
+func GetInviteStateFromDB(inviteToken string, db *sql.DB) (string, bool, error) {
 	query := `
-		SELECT invite_token, expires_at
-		FROM group_invites
-		WHERE group_id = $1
-		AND (expires_at IS NULL OR expires_at > NOW())
+		SELECT gi.group_id, (TRUE` + inviteIsUsableCondition + `)
+		FROM group_invites gi
+		WHERE gi.invite_token = $1`
+
+	var groupId string
+	var isUsable bool
+	err := db.QueryRow(query, inviteToken).Scan(&groupId, &isUsable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrNotFound
+	}
+	return groupId, isUsable, err
+}
+
+// RedeemInviteTokenWithTransaction counts the use of the invite and records who joined.
+//
+// return ErrNotFound => the invite can't be used anymore
+func RedeemInviteTokenWithTransaction(inviteToken string, userId string, tx *sql.Tx) error {
+	err := ClaimInviteTokenWithTransaction(inviteToken, tx)
+	if err != nil {
+		return err
+	}
+	return RecordInviteRedemptionWithTransaction(inviteToken, userId, tx)
+}
+
+// ClaimInviteTokenWithTransaction counts a use of the invite. The update locks the invite, so parallel joins can't go
+// past max_uses. A join request claims its use when it is created and gives it back if it gets rejected or cancelled.
+//
+// return ErrNotFound => the invite can't be used anymore
+func ClaimInviteTokenWithTransaction(inviteToken string, tx *sql.Tx) error {
+	query := `
+		UPDATE group_invites gi
+		SET use_count = gi.use_count + 1, updated_at = NOW()
+		WHERE gi.invite_token = $1` + inviteIsUsableCondition + `
+		RETURNING gi.invite_token
+	`
+	var inviteTokenTmp string
+	err := tx.QueryRow(query, inviteToken).Scan(&inviteTokenTmp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// releaseInviteUseWithTransaction gives back the use a join request claimed when it didn't lead to a join. Nothing
+// happens for an empty token, which means the invite got deleted.
+func releaseInviteUseWithTransaction(inviteToken string, tx *sql.Tx) error {
+	if inviteToken == "" {
+		return nil
+	}
+	query := `
+		UPDATE group_invites
+		SET use_count = GREATEST(use_count - 1, 0), updated_at = NOW()
+		WHERE invite_token = $1
+	`
+	_, err := tx.Exec(query, inviteToken)
+	return err
+}
+
+// RecordInviteRedemptionWithTransaction records that the user joined through the invite.
+func RecordInviteRedemptionWithTransaction(inviteToken string, userId string, tx *sql.Tx) error {
+	query := `INSERT INTO group_invite_redemptions (invite_token, user_id) VALUES ($1, $2)`
+	_, err := tx.Exec(query, inviteToken, userId)
+	return err
+}
+
+// GetAllInviteTokensInAGroupFromDB returns the invites that are not voided or expired, used up invites included, with
+// the members that joined through them.
+func GetAllInviteTokensInAGroupFromDB(groupId string, db *sql.DB) ([]InviteToken, error) {
+	query := `
+		SELECT invite_token, expires_at, label, max_uses, use_count, requires_approval
+		FROM group_invites
+		WHERE group_id = $1
+		AND (expires_at IS NULL OR expires_at > NOW())
 		AND deleted_at IS NULL
 		ORDER BY expires_at;
 	`
@@ -570,17 +952,56 @@ func GetAllInviteTokensInAGroupFromDB(groupId string, db *sql.DB) ([]InviteToken
 	}
 	defer rows.Close()
 
-	var inviteTokens []InviteToken
+	inviteTokens := []InviteToken{}
+	tokenIndex := map[string]int{}
 	for rows.Next() {
 		var inviteToken InviteToken
-		err := rows.Scan(&inviteToken.InviteToken, &inviteToken.ExpiresAt)
+		err := rows.Scan(&inviteToken.InviteToken, &inviteToken.ExpiresAt, &inviteToken.Label, &inviteToken.MaxUses, &inviteToken.UseCount, &inviteToken.RequiresApproval)
 		if err != nil {
 			return nil, err
 		}
+		if inviteToken.MaxUses != nil {
+			remainingUses := max(*inviteToken.MaxUses-inviteToken.UseCount, 0)
+			inviteToken.RemainingUses = &remainingUses
+		}
+		inviteToken.InviteLink = links.InviteLink(inviteToken.InviteToken)
+		inviteToken.Redemptions = []InviteRedemption{}
+		tokenIndex[inviteToken.InviteToken] = len(inviteTokens)
 		inviteTokens = append(inviteTokens, inviteToken)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return inviteTokens, nil
+	redemptionsQuery := `
+		SELECT r.invite_token, r.user_id, u.username, r.redeemed_at
+		FROM group_invite_redemptions r
+		INNER JOIN group_invites gi ON gi.invite_token = r.invite_token
+		INNER JOIN users u ON u.user_id = r.user_id
+		WHERE gi.group_id = $1
+		ORDER BY r.redeemed_at
+	`
+	redemptionRows, err := db.Query(redemptionsQuery, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer redemptionRows.Close()
+
+	for redemptionRows.Next() {
+		var inviteToken string
+		var redemption InviteRedemption
+		err := redemptionRows.Scan(&inviteToken, &redemption.UserId, &redemption.Username, &redemption.RedeemedAt)
+		if err != nil {
+			return nil, err
+		}
+		index, ok := tokenIndex[inviteToken]
+		if !ok {
+			continue // redemption of an expired or voided invite
+		}
+		inviteTokens[index].Redemptions = append(inviteTokens[index].Redemptions, redemption)
+	}
+
+	return inviteTokens, redemptionRows.Err()
 }
 
 func VoidInviteTokenInDB(inviteToken string, db *sql.DB) error {
@@ -618,7 +1039,7 @@ func GetAllGroupsForUser(userId string, db *sql.DB) ([]GroupInfo, error) {
     		ARRAY_AGG(DISTINCT ur.role) AS user_roles
 		FROM groups g 
 		INNER JOIN user_groups ug ON ug.group_id = g.group_id AND ug.user_id = $1
-		LEFT JOIN user_group_roles ur ON ur.group_id = g.group_id AND ur.user_id = $1
+		LEFT JOIN user_group_roles ur ON ur.group_id = g.group_id AND ur.user_id = $1` + effectiveRoleCondition("ur") + `
 		LEFT JOIN user_groups ugAll ON ugAll.group_id = g.group_id
 		WHERE g.deleted_at IS NULL
 		AND ug.deleted_at IS NULL 
@@ -691,43 +1112,115 @@ func GetAllDeletedGroupsForUser(userId string, lastRequestDatetime *string, db *
 	return groupIds, nil
 }
 
-func RemoveUserFromGroup(userId string, groupId string, db *sql.DB) error {
-
+var ErrCantRemoveOwner = errors.New("the owner of the group can't be removed")
+
+// RemoveMemberFromGroup removes another member from the group, e.g. on a kick. Unlike leaving, nobody gets promoted:
+// the owner and the last admin can't be removed until the ownership is transferred.
+//
+// return ErrNoMatchingGroupOrUser => the user is not a member of the group
+//
+// return ErrCantRemoveOwner => the user owns the group
+//
+// return ErrLastAdmin => the user is the last admin of the group
+func RemoveMemberFromGroup(userId string, groupId string, db *sql.DB) error {
 	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = RemoveMemberFromGroupWithTransaction(userId, groupId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMemberFromGroupWithTransaction works like RemoveMemberFromGroup, the caller commits or rolls back the
+// transaction.
+func RemoveMemberFromGroupWithTransaction(userId string, groupId string, tx *sql.Tx) error {
+	err := lockGroupWithTransaction(groupId, tx)
+	if errors.Is(err, ErrNotFound) {
+		return ErrNoMatchingGroupOrUser
+	}
+	if err != nil {
+		return err
+	}
+
+	var isOwner bool
+	err = tx.QueryRow(`SELECT COALESCE(created_by = $2, FALSE) FROM groups WHERE group_id = $1`, groupId, userId).Scan(&isOwner)
+	if err != nil {
+		return err
+	}
+	if isOwner {
+		return ErrCantRemoveOwner
+	}
+
+	err = RemoveUserFromGroupWithTransaction(userId, groupId, tx)
+	if err != nil {
+		return err
+	}
 
+	adminCount, err := countAdminsWithTransaction(groupId, tx)
 	if err != nil {
 		return err
 	}
+	if adminCount == 0 {
+		return ErrLastAdmin
+	}
 
+	return nil
+}
+
+// RemoveUserFromGroupWithTransaction removes the membership, preferences and roles of the user without any checks,
+// the caller commits or rolls back the transaction.
+//
+// return ErrNoMatchingGroupOrUser => the user is not a member of the group
+func RemoveUserFromGroupWithTransaction(userId string, groupId string, tx *sql.Tx) error {
 	removeUserGroupsQuery := `
 		UPDATE user_groups
 		SET deleted_at = NOW()
 		WHERE group_id = $1
-		AND user_id = $2;
+		AND user_id = $2
+		AND deleted_at IS NULL;
 	`
-	_, err = db.Exec(removeUserGroupsQuery, groupId, userId)
+	result, err := tx.Exec(removeUserGroupsQuery, groupId, userId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
+	if rowsAffected == 0 {
+		return ErrNoMatchingGroupOrUser
+	}
 
+	// the seats of confirmed opt-ins go to the waitlist
 	removePreferencesQuery := `
-		UPDATE meal_preferences mp
-		SET deleted_at = NOW()
-		FROM meals m
-		WHERE mp.meal_id = m.meal_id
-  		AND m.group_id = $1
-  		AND mp.user_id = $2;
+		WITH removed AS (
+			UPDATE meal_preferences mp
+			SET deleted_at = NOW()
+			FROM meals m
+			WHERE mp.meal_id = m.meal_id
+			AND m.group_id = $1
+			AND mp.user_id = $2
+			AND mp.deleted_at IS NULL
+			RETURNING mp.meal_id, mp.preference, mp.waitlisted_at
+		)
+		SELECT meal_id FROM removed WHERE preference = 'opt-in' AND waitlisted_at IS NULL
 	`
-	_, err = db.Exec(removePreferencesQuery, groupId, userId)
+	rows, err := tx.Query(removePreferencesQuery, groupId, userId)
+	if err != nil {
+		return err
+	}
+	freedMealIds, err := waitlist.ScanMealIds(rows)
+	if err != nil {
+		return err
+	}
+	err = waitlist.PromoteMealsWithTransaction(freedMealIds, tx)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 
@@ -736,16 +1229,622 @@ func RemoveUserFromGroup(userId string, groupId string, db *sql.DB) error {
 		WHERE group_id = $1
 		AND user_id = $2;
 	`
+	_, err = tx.Exec(deleteRolesQuery, groupId, userId)
+	return err
+}
+
+// IsUserBannedFromGroupInDB ignores bans that are expired but not removed yet.
+func IsUserBannedFromGroupInDB(groupId string, userId string, db *sql.DB) (bool, error) {
+	var isBanned bool
+	err := db.QueryRow(isUserBannedQuery, groupId, userId).Scan(&isBanned)
+	return isBanned, err
+}
+
+const isUserBannedQuery = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_groups_blacklist
+			WHERE group_id = $1
+			AND user_id = $2
+			AND (expires_at IS NULL OR expires_at > NOW())
+		)
+	`
 
-	_, err = db.Exec(deleteRolesQuery, groupId, userId)
+const isMemberQuery = `SELECT EXISTS (SELECT 1 FROM user_groups WHERE group_id = $1 AND user_id = $2 AND deleted_at IS NULL)`
+
+var ErrJoinRequestNotFound = errors.New("join request not found")
+var ErrUserIsBanned = errors.New("user is banned from the group")
+
+// GetPendingJoinRequestIdFromDB returns an empty id if the user doesn't wait for a decision about the group.
+func GetPendingJoinRequestIdFromDB(groupId string, userId string, db *sql.DB) (string, error) {
+	query := `
+		SELECT join_request_id
+		FROM group_join_requests
+		WHERE group_id = $1 AND user_id = $2 AND status = 'pending'
+	`
+	var joinRequestId string
+	err := db.QueryRow(query, groupId, userId).Scan(&joinRequestId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return joinRequestId, err
+}
+
+func CreateJoinRequestWithTransaction(groupId string, userId string, inviteToken string, tx *sql.Tx) (string, error) {
+	query := `
+		INSERT INTO group_join_requests (group_id, user_id, invite_token)
+		VALUES ($1, $2, $3)
+		RETURNING join_request_id
+	`
+	var joinRequestId string
+	err := tx.QueryRow(query, groupId, userId, inviteToken).Scan(&joinRequestId)
+	return joinRequestId, err
+}
+
+// joinRequestColumns needs the aliases jr for group_join_requests, g for groups, u for users and gi for group_invites.
+const joinRequestColumns = `
+		jr.join_request_id, jr.group_id, g.group_name, jr.user_id, u.username, jr.invite_token, gi.label, jr.status, jr.created_at`
+
+const joinRequestJoins = `
+		FROM group_join_requests jr
+		INNER JOIN groups g ON g.group_id = jr.group_id
+		INNER JOIN users u ON u.user_id = jr.user_id
+		LEFT JOIN group_invites gi ON gi.invite_token = jr.invite_token`
+
+func scanJoinRequests(rows *sql.Rows) ([]JoinRequest, error) {
+	defer rows.Close()
+
+	joinRequests := []JoinRequest{}
+	for rows.Next() {
+		var joinRequest JoinRequest
+		err := rows.Scan(&joinRequest.JoinRequestId, &joinRequest.GroupId, &joinRequest.GroupName, &joinRequest.UserId,
+			&joinRequest.Username, &joinRequest.InviteToken, &joinRequest.InviteLabel, &joinRequest.Status, &joinRequest.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		joinRequests = append(joinRequests, joinRequest)
+	}
+	return joinRequests, rows.Err()
+}
+
+// GetPendingJoinRequestsOfGroupFromDB returns the requests that wait for a decision, oldest first.
+func GetPendingJoinRequestsOfGroupFromDB(groupId string, db *sql.DB) ([]JoinRequest, error) {
+	query := `
+		SELECT` + joinRequestColumns + joinRequestJoins + `
+		WHERE jr.group_id = $1
+		AND jr.status = 'pending'
+		ORDER BY jr.created_at
+	`
+	rows, err := db.Query(query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return scanJoinRequests(rows)
+}
+
+// GetPendingJoinRequestsOfUserFromDB returns the requests of the user that wait for a decision, newest first.
+func GetPendingJoinRequestsOfUserFromDB(userId string, db *sql.DB) ([]JoinRequest, error) {
+	query := `
+		SELECT` + joinRequestColumns + joinRequestJoins + `
+		WHERE jr.user_id = $1
+		AND jr.status = 'pending'
+		AND g.deleted_at IS NULL
+		ORDER BY jr.created_at DESC
+	`
+	rows, err := db.Query(query, userId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
+		return nil, err
+	}
+	return scanJoinRequests(rows)
+}
+
+// decideJoinRequestWithTransaction moves a pending request of the group to the status and returns the requester and
+// the invite the request was made with, which is empty if the invite got deleted.
+//
+// return ErrJoinRequestNotFound => there is no pending request with this id in the group
+func decideJoinRequestWithTransaction(groupId string, joinRequestId string, status string, decidedBy string, tx *sql.Tx) (string, string, error) {
+	query := `
+		UPDATE group_join_requests
+		SET status = $3, decided_by = $4, decided_at = NOW()
+		WHERE join_request_id = $1
+		AND group_id = $2
+		AND status = 'pending'
+		RETURNING user_id, COALESCE(invite_token::TEXT, '')
+	`
+	var userId string
+	var inviteToken string
+	err := tx.QueryRow(query, joinRequestId, groupId, status, decidedBy).Scan(&userId, &inviteToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrJoinRequestNotFound
+	}
+	return userId, inviteToken, err
+}
+
+// ApproveJoinRequestInDB adds the requester to the group as member and returns their id.
+//
+// return ErrJoinRequestNotFound => there is no pending request with this id in the group
+//
+// return ErrUserIsBanned => the requester got banned while the request was pending, the request is rejected
+func ApproveJoinRequestInDB(groupId string, joinRequestId string, decidedBy string, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	userId, err := approveJoinRequestWithTransaction(groupId, joinRequestId, decidedBy, tx)
+	if errors.Is(err, ErrUserIsBanned) {
+		// the rejection has to be kept, otherwise the request stays pending and keeps its invite use
+		err = tx.Commit()
+		if err != nil {
+			return "", err
+		}
+		return "", ErrUserIsBanned
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return userId, tx.Commit()
+}
+
+func approveJoinRequestWithTransaction(groupId string, joinRequestId string, decidedBy string, tx *sql.Tx) (string, error) {
+	userId, inviteToken, err := decideJoinRequestWithTransaction(groupId, joinRequestId, "approved", decidedBy, tx)
+	if err != nil {
+		return "", err
+	}
+
+	var isBanned bool
+	err = tx.QueryRow(isUserBannedQuery, groupId, userId).Scan(&isBanned)
+	if err != nil {
+		return "", err
+	}
+	if isBanned {
+		query := `UPDATE group_join_requests SET status = 'rejected' WHERE join_request_id = $1`
+		_, err = tx.Exec(query, joinRequestId)
+		if err != nil {
+			return "", err
+		}
+		err = releaseInviteUseWithTransaction(inviteToken, tx)
+		if err != nil {
+			return "", err
 		}
+		return "", ErrUserIsBanned
+	}
+
+	var isMember bool
+	err = tx.QueryRow(isMemberQuery, groupId, userId).Scan(&isMember)
+	if err != nil {
+		return "", err
+	}
+	if isMember {
+		return userId, nil
+	}
+
+	userGroupId, err := AddUserToGroupWithTransaction(groupId, userId, tx)
+	if err != nil {
+		return "", err
+	}
+	err = AddRoleToUserInGroupWithTransaction(groupId, userId, roles.MemberRole, userGroupId, tx)
+	if err != nil {
+		return "", err
+	}
+
+	if inviteToken != "" {
+		err = RecordInviteRedemptionWithTransaction(inviteToken, userId, tx)
+		if err != nil {
+			return "", err
+		}
+	}
+	return userId, nil
+}
+
+// RejectJoinRequestInDB gives back the invite use of the request.
+//
+// return ErrJoinRequestNotFound => there is no pending request with this id in the group
+func RejectJoinRequestInDB(groupId string, joinRequestId string, decidedBy string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
-	return err
+	_, inviteToken, err := decideJoinRequestWithTransaction(groupId, joinRequestId, "rejected", decidedBy, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = releaseInviteUseWithTransaction(inviteToken, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelJoinRequestInDB gives back the invite use of the request.
+//
+// return ErrJoinRequestNotFound => the user has no pending request with this id
+func CancelJoinRequestInDB(userId string, joinRequestId string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = cancelJoinRequestWithTransaction(userId, joinRequestId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func cancelJoinRequestWithTransaction(userId string, joinRequestId string, tx *sql.Tx) error {
+	query := `
+		UPDATE group_join_requests
+		SET status = 'cancelled', decided_by = $2, decided_at = NOW()
+		WHERE join_request_id = $1
+		AND user_id = $2
+		AND status = 'pending'
+		RETURNING COALESCE(invite_token::TEXT, '')
+	`
+	var inviteToken string
+	err := tx.QueryRow(query, joinRequestId, userId).Scan(&inviteToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return releaseInviteUseWithTransaction(inviteToken, tx)
+}
+
+var ErrInvitationNotFound = errors.New("invitation not found")
+var ErrInvitationAlreadyPending = errors.New("invitation already pending")
+
+// CreateInvitationInDB replaces a pending invitation that is expired.
+//
+// return ErrInvitationAlreadyPending => the user already has a pending invitation to the group
+func CreateInvitationInDB(groupId string, userId string, invitedBy string, expiresAt time.Time, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	invitationId, err := createInvitationWithTransaction(groupId, userId, invitedBy, expiresAt, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return invitationId, tx.Commit()
+}
+
+func createInvitationWithTransaction(groupId string, userId string, invitedBy string, expiresAt time.Time, tx *sql.Tx) (string, error) {
+	revokeExpiredQuery := `
+		UPDATE group_invitations
+		SET status = 'revoked', decided_at = NOW()
+		WHERE group_id = $1
+		AND user_id = $2
+		AND status = 'pending'
+		AND expires_at <= NOW()
+	`
+	_, err := tx.Exec(revokeExpiredQuery, groupId, userId)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO group_invitations (group_id, user_id, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING invitation_id
+	`
+	var invitationId string
+	err = tx.QueryRow(query, groupId, userId, invitedBy, expiresAt).Scan(&invitationId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return "", ErrInvitationAlreadyPending
+	}
+	return invitationId, err
+}
+
+// invitationColumns needs the aliases gin for group_invitations, g for groups, u for the invited user and ib for
+// the user that sent the invitation.
+const invitationColumns = `
+		gin.invitation_id, gin.group_id, g.group_name, gin.user_id, u.username, gin.invited_by, ib.username, gin.expires_at, gin.created_at`
+
+const invitationJoins = `
+		FROM group_invitations gin
+		INNER JOIN groups g ON g.group_id = gin.group_id
+		INNER JOIN users u ON u.user_id = gin.user_id
+		LEFT JOIN users ib ON ib.user_id = gin.invited_by`
+
+func scanInvitations(rows *sql.Rows) ([]Invitation, error) {
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(&invitation.InvitationId, &invitation.GroupId, &invitation.GroupName, &invitation.UserId, &invitation.Username,
+			&invitation.InvitedBy, &invitation.InvitedByUsername, &invitation.ExpiresAt, &invitation.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// GetPendingInvitationsOfGroupFromDB returns the invitations of the group that are neither answered nor expired.
+func GetPendingInvitationsOfGroupFromDB(groupId string, db *sql.DB) ([]Invitation, error) {
+	query := `
+		SELECT` + invitationColumns + invitationJoins + `
+		WHERE gin.group_id = $1
+		AND gin.status = 'pending'
+		AND gin.expires_at > NOW()
+		ORDER BY gin.created_at DESC
+	`
+	rows, err := db.Query(query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// GetPendingInvitationsOfUserFromDB returns the invitations the user can still accept.
+func GetPendingInvitationsOfUserFromDB(userId string, db *sql.DB) ([]Invitation, error) {
+	query := `
+		SELECT` + invitationColumns + invitationJoins + `
+		WHERE gin.user_id = $1
+		AND gin.status = 'pending'
+		AND gin.expires_at > NOW()
+		AND g.deleted_at IS NULL
+		ORDER BY gin.created_at DESC
+	`
+	rows, err := db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// RevokeInvitationInDB returns ErrInvitationNotFound if the group has no pending invitation with this id.
+func RevokeInvitationInDB(groupId string, invitationId string, db *sql.DB) error {
+	query := `
+		UPDATE group_invitations
+		SET status = 'revoked', decided_at = NOW()
+		WHERE invitation_id = $1
+		AND group_id = $2
+		AND status = 'pending'
+	`
+	result, err := db.Exec(query, invitationId, groupId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// GetGroupIdOfPendingInvitationFromDB returns the group of an invitation the user can still accept.
+//
+// return ErrInvitationNotFound => the user has no pending invitation with this id or it is expired
+func GetGroupIdOfPendingInvitationFromDB(userId string, invitationId string, db *sql.DB) (string, error) {
+	query := `
+		SELECT group_id
+		FROM group_invitations
+		WHERE invitation_id = $1
+		AND user_id = $2
+		AND status = 'pending'
+		AND expires_at > NOW()
+	`
+	var groupId string
+	err := db.QueryRow(query, invitationId, userId).Scan(&groupId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvitationNotFound
+	}
+	return groupId, err
+}
+
+// AcceptInvitationInDB adds the user to the group of the invitation as member and returns the group.
+//
+// return ErrInvitationNotFound => the user has no pending invitation with this id or it is expired
+//
+// return ErrUserIsBanned => the user got banned after being invited
+func AcceptInvitationInDB(userId string, invitationId string, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	groupId, err := acceptInvitationWithTransaction(userId, invitationId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return groupId, tx.Commit()
+}
+
+func acceptInvitationWithTransaction(userId string, invitationId string, tx *sql.Tx) (string, error) {
+	query := `
+		UPDATE group_invitations
+		SET status = 'accepted', decided_at = NOW()
+		WHERE invitation_id = $1
+		AND user_id = $2
+		AND status = 'pending'
+		AND expires_at > NOW()
+		RETURNING group_id
+	`
+	var groupId string
+	err := tx.QueryRow(query, invitationId, userId).Scan(&groupId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvitationNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var isBanned bool
+	err = tx.QueryRow(isUserBannedQuery, groupId, userId).Scan(&isBanned)
+	if err != nil {
+		return "", err
+	}
+	if isBanned {
+		return "", ErrUserIsBanned
+	}
+
+	var isMember bool
+	err = tx.QueryRow(isMemberQuery, groupId, userId).Scan(&isMember)
+	if err != nil {
+		return "", err
+	}
+	if isMember {
+		return groupId, nil
+	}
+
+	userGroupId, err := AddUserToGroupWithTransaction(groupId, userId, tx)
+	if err != nil {
+		return "", err
+	}
+	err = AddRoleToUserInGroupWithTransaction(groupId, userId, roles.MemberRole, userGroupId, tx)
+	if err != nil {
+		return "", err
+	}
+	return groupId, nil
+}
+
+// DeclineInvitationInDB returns ErrInvitationNotFound if the user has no pending invitation with this id.
+func DeclineInvitationInDB(userId string, invitationId string, db *sql.DB) error {
+	query := `
+		UPDATE group_invitations
+		SET status = 'declined', decided_at = NOW()
+		WHERE invitation_id = $1
+		AND user_id = $2
+		AND status = 'pending'
+	`
+	result, err := db.Exec(query, invitationId, userId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+const groupSettingsQuery = `
+		SELECT gs.time_zone, gs.week_start, gs.locale, gs.meal_types, gs.default_meal_times
+		FROM groups g
+		LEFT JOIN group_settings gs ON gs.group_id = g.group_id
+		WHERE g.group_id = $1
+		AND g.deleted_at IS NULL
+	`
+
+// scanGroupSettings reads a row of groupSettingsQuery and falls back to the defaults for groups that never saved their
+// settings.
+//
+// return ErrNotFound => the group does not exist
+func scanGroupSettings(groupId string, row *sql.Row) (GroupSettings, error) {
+	var timeZone, locale *string
+	var weekStart *int
+	var mealTypes pq.StringArray
+	var defaultMealTimes []byte
+	err := row.Scan(&timeZone, &weekStart, &locale, &mealTypes, &defaultMealTimes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GroupSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return GroupSettings{}, err
+	}
+	if timeZone == nil {
+		return defaultGroupSettings(groupId), nil
+	}
+
+	settings := GroupSettings{
+		GroupId:          groupId,
+		TimeZone:         *timeZone,
+		WeekStart:        *weekStart,
+		Locale:           *locale,
+		MealTypes:        mealTypes,
+		DefaultMealTimes: map[string]string{},
+	}
+	err = json.Unmarshal(defaultMealTimes, &settings.DefaultMealTimes)
+	return settings, err
+}
+
+// GetGroupSettingsFromDB returns the defaults for groups that never saved their settings.
+//
+// return ErrNotFound => the group does not exist
+func GetGroupSettingsFromDB(groupId string, db *sql.DB) (GroupSettings, error) {
+	return scanGroupSettings(groupId, db.QueryRow(groupSettingsQuery, groupId))
+}
+
+// UpdateGroupSettingsInDB applies the update to the current settings and saves the result. The group stays locked
+// until the update is saved, so concurrent updates of different settings don't undo each other.
+//
+// return ErrNotFound => the group does not exist
+//
+// return ErrInvalidTimeZone, ErrInvalidLocale or ErrInvalidMealTime => the request contains an invalid value
+func UpdateGroupSettingsInDB(update RequestUpdateGroupSettings, db *sql.DB) (GroupSettings, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return GroupSettings{}, err
+	}
+
+	settings, err := updateGroupSettingsWithTransaction(update, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return GroupSettings{}, err
+	}
+
+	return settings, tx.Commit()
+}
+
+func updateGroupSettingsWithTransaction(update RequestUpdateGroupSettings, tx *sql.Tx) (GroupSettings, error) {
+	// the settings row might not exist yet, so the group is locked instead
+	err := lockGroupWithTransaction(update.GroupId, tx)
+	if err != nil {
+		return GroupSettings{}, err
+	}
+
+	settings, err := scanGroupSettings(update.GroupId, tx.QueryRow(groupSettingsQuery, update.GroupId))
+	if err != nil {
+		return GroupSettings{}, err
+	}
+
+	settings, err = applyGroupSettingsUpdate(settings, update)
+	if err != nil {
+		return GroupSettings{}, err
+	}
+
+	defaultMealTimes, err := json.Marshal(settings.DefaultMealTimes)
+	if err != nil {
+		return GroupSettings{}, err
+	}
+
+	query := `
+		INSERT INTO group_settings (group_id, time_zone, week_start, locale, meal_types, default_meal_times)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (group_id) DO UPDATE
+		SET time_zone = EXCLUDED.time_zone,
+		    week_start = EXCLUDED.week_start,
+		    locale = EXCLUDED.locale,
+		    meal_types = EXCLUDED.meal_types,
+		    default_meal_times = EXCLUDED.default_meal_times
+	`
+	_, err = tx.Exec(query, settings.GroupId, settings.TimeZone, settings.WeekStart, settings.Locale, pq.Array(settings.MealTypes), defaultMealTimes)
+	return settings, err
 }
@@ -5,14 +5,16 @@ import (
 	"enguete/modules/user"
 	"enguete/util/GenericTypes"
 	"enguete/util/auth"
-	"enguete/util/dates"
 	"enguete/util/frontendErrors"
+	"enguete/util/links"
+	"enguete/util/qr"
 	"enguete/util/responses"
 	"enguete/util/roles"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -37,10 +39,9 @@ func CreateNewGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		c.AbortWithStatusJSON(http.StatusUnauthorized, GroupError{Error: "Authorisation is not valid"})
+	jwtPayload := auth.GetJWTPayload(c)
+	if !jwtPayload.HasScope(roles.ScopeGroups) || jwtPayload.LimitedToGroupId != "" {
+		responses.GenericApiTokenScopeError(c.Writer)
 		return
 	}
 
@@ -58,6 +59,14 @@ func CreateNewGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	err = CreateDefaultRolesInDBWithTransaction(newGroupId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Println(err)
+		responses.HttpErrorResponse(c.Writer, http.StatusInternalServerError, frontendErrors.CreateGroupError, "Error creating group")
+		return
+	}
+
 	userGroupId, err := AddUserToGroupWithTransaction(newGroupId, jwtPayload.UserId, tx)
 	if err != nil {
 		_ = tx.Rollback()
@@ -97,93 +106,199 @@ func DeleteGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	err := DeleteGroupInDB(groupData.GroupId, db)
+	if err != nil {
+		if errors.Is(err, ErrNothingHappened) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Group deleted successfully"})
+}
+
+func UpdateGroupName(c *gin.Context, db *sql.DB) {
+	var groupData RequestUpdateGroupName
+	if err := c.ShouldBindJSON(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	canPerformAction, _, err := CheckIfUserIsAllowedToPerformAction(groupData.GroupId, jwtPayload.UserId, roles.CanDeleteGroup, db)
+	err = UpdateGroupNameInDB(groupData, tx)
 	if err != nil {
-		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
+		_ = tx.Rollback()
+
+		if errors.Is(err, ErrNothingHappened) {
 			responses.GenericGroupDoesNotExistError(c.Writer)
 			return
 		}
+
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
-		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.NotAllowedToDeleteGroupError, "You are not allowed to delete this group")
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Group name updated successfully"})
+}
+
+// GetGroupPolicies godoc
+// @Summary Get the policies of a group
+// @Description Returns the rules new and existing members of the group have to follow.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {object} GroupPolicies
+// @Failure 400 {object} GroupError "Bad request - invalid group ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 404 {object} GroupError "Not Found - group not found"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/policies [get]
+func GetGroupPolicies(c *gin.Context, db *sql.DB) {
+	var groupData RequestIdGroup
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	err = DeleteGroupInDB(groupData.GroupId, db)
+	policies, err := GetGroupPoliciesFromDB(groupData.GroupId, db)
 	if err != nil {
-		if errors.Is(err, ErrNothingHappened) {
+		if errors.Is(err, ErrNotFound) {
 			responses.GenericGroupDoesNotExistError(c.Writer)
 			return
 		}
-
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	c.JSON(http.StatusOK, GroupSuccess{Message: "Group deleted successfully"})
+	c.JSON(http.StatusOK, policies)
 }
 
-func UpdateGroupName(c *gin.Context, db *sql.DB) {
-	var groupData RequestUpdateGroupName
-	if err := c.ShouldBindJSON(&groupData); err != nil {
+// GetGroupSettings godoc
+// @Summary Get the settings of a group
+// @Description Returns the time zone, week start, locale and default meal types and times of the group. Groups that never changed them get the defaults.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {object} GroupSettings
+// @Failure 400 {object} GroupError "Bad request - invalid group ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 404 {object} GroupError "Not Found - group not found"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/settings [get]
+func GetGroupSettings(c *gin.Context, db *sql.DB) {
+	var groupData RequestIdGroup
+	if err := c.ShouldBindQuery(&groupData); err != nil {
 		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	settings, err := GetGroupSettingsFromDB(groupData.GroupId, db)
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		respondWithGroupSettingsError(c, err)
 		return
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
-		responses.GenericInternalServerError(c.Writer)
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateGroupSettings godoc
+// @Summary Update the settings of a group
+// @Description Changes the settings that are set in the request, the others stay as they are. Default meal times of removed meal types are dropped.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param settings body RequestUpdateGroupSettings true "Settings to change"
+// @Success 200 {object} GroupSettings "Settings after the update"
+// @Failure 400 {object} GroupError "Bad request - error decoding request or invalid time zone, locale or meal time"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to update the group"
+// @Failure 404 {object} GroupError "Not Found - group not found"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/settings [put]
+func UpdateGroupSettings(c *gin.Context, db *sql.DB) {
+	var settingsData RequestUpdateGroupSettings
+	if err := c.ShouldBindJSON(&settingsData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	canPerformAction, _, err := CheckIfUserIsAllowedToPerformAction(groupData.GroupId, jwtPayload.UserId, roles.CanUpdateGroup, db)
+	settings, err := UpdateGroupSettingsInDB(settingsData, db)
 	if err != nil {
-		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
+		respondWithGroupSettingsError(c, err)
 		return
 	}
-	if !canPerformAction {
-		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.NotAllowedToUpdateGroupError, "You are not allowed to update this group")
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateGroupPolicies godoc
+// @Summary Update the policies of a group
+// @Description Changes the policies that are set in the request, the others stay as they are.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param policies body RequestUpdateGroupPolicies true "Policies to change"
+// @Success 200 {object} GroupSuccess "Policies updated"
+// @Failure 400 {object} GroupError "Bad request - error decoding request or requiring two-factor authentication without having it enabled"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to update the policies"
+// @Failure 404 {object} GroupError "Not Found - group not found"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/policies [put]
+func UpdateGroupPolicies(c *gin.Context, db *sql.DB) {
+	var policiesData RequestUpdateGroupPolicies
+	if err := c.ShouldBindJSON(&policiesData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	err = UpdateGroupNameInDB(groupData, tx)
-	if err != nil {
-		_ = tx.Rollback()
+	jwtPayload := auth.GetJWTPayload(c)
 
-		if errors.Is(err, ErrNothingHappened) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+	if policiesData.RequireAdminTwoFactor != nil && *policiesData.RequireAdminTwoFactor {
+		// without two-factor authentication the requester would lose the admin role with this change
+		twoFactorEnabled, err := user.IsTwoFactorEnabled(jwtPayload.UserId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if !twoFactorEnabled {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorRequiredForAdminError, "Enable two-factor authentication before requiring it for admins")
 			return
 		}
-
-		responses.GenericInternalServerError(c.Writer)
-		return
 	}
 
-	err = tx.Commit()
+	err := UpdateGroupPoliciesInDB(policiesData, db)
 	if err != nil {
+		if errors.Is(err, ErrNothingHappened) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	c.JSON(http.StatusOK, GroupSuccess{Message: "Group name updated successfully"})
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Group policies updated successfully"})
 }
 
 // GetGroupById godoc
@@ -209,22 +324,7 @@ func GetGroupById(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	inDB, err := IsUserInGroup(filterRequest.GroupId, jwtPayload.UserId, db)
-	if err != nil {
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !inDB {
-		responses.GenericForbiddenError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	groupInformation, err := GetGroupInformationFromDb(filterRequest.GroupId, jwtPayload.UserId, db)
 	if err != nil {
@@ -233,19 +333,16 @@ func GetGroupById(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	groupInformation.UserRoleRights = roles.GetAllAllowedActionsForRoles(groupInformation.UserRoles)
+	groupInformation.UserRoleRights = GetMembership(c).Permissions
 
 	if filterRequest.WeekFilter != nil {
-
-		weekTime, err := time.Parse(time.RFC3339, *filterRequest.WeekFilter)
+		startOfWeek, endOfWeek, err := getWeekOfGroup(filterRequest.GroupId, *filterRequest.WeekFilter, db)
 		if err != nil {
 			log.Println(err)
-			weekTime = time.Now()
-
+			responses.GenericInternalServerError(c.Writer)
+			return
 		}
 
-		startOfWeek, endOfWeek := dates.GetStartAndEndOfWeek(weekTime)
-
 		filterRequest.StartDateFilter = &startOfWeek
 		filterRequest.EndDateFilter = &endOfWeek
 	}
@@ -287,25 +384,6 @@ func GetGroupMembers(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	inGroup, err := IsUserInGroup(groupData.GroupId, jwtPayload.UserId, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericInternalServerError(c.Writer)
-
-		return
-	}
-	if !inGroup {
-		responses.GenericGroupDoesNotExistError(c.Writer)
-		return
-	}
-
 	members, err := GetGroupMembersFromDb(groupData.GroupId, db)
 	if err != nil {
 		log.Println(err)
@@ -324,37 +402,20 @@ func GetGroupMeals(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
-	inGroup, err := IsUserInGroup(groupData.GroupId, jwtPayload.UserId, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !inGroup {
-		responses.GenericGroupDoesNotExistError(c.Writer)
-		return
-	}
 	var filterRequest FilterGroupRequest
 
 	filterRequest.GroupId = groupData.GroupId
 
 	if groupData.FilterDate != nil {
-		weekTime, err := time.Parse(time.RFC3339, *groupData.FilterDate)
-
+		startOfWeek, endOfWeek, err := getWeekOfGroup(groupData.GroupId, *groupData.FilterDate, db)
 		if err != nil {
 			log.Println(err)
-			weekTime = time.Now()
+			responses.GenericInternalServerError(c.Writer)
+			return
 		}
 
-		startOfWeek, endOfWeek := dates.GetStartAndEndOfWeek(weekTime)
-
 		filterRequest.StartDateFilter = &startOfWeek
 		filterRequest.EndDateFilter = &endOfWeek
 	}
@@ -370,7 +431,7 @@ func GetGroupMeals(c *gin.Context, db *sql.DB) {
 
 // GenerateInviteLink godoc
 // @Summary Generate an invite link for a group
-// @Description Generates a unique invite link for a specified group. Only users with admin or owner roles can generate an invitation link.
+// @Description Generates a unique invite link for a specified group. The link can have a label and a limit of uses, it stops working once the limit is reached.
 // @Tags Groups
 // @Accept json
 // @Produce json
@@ -388,62 +449,117 @@ func GenerateInviteLink(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	tx, err := db.Begin()
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	canPerformAction, _, err := CheckIfUserIsAllowedToPerformAction(inviteRequest.GroupId, jwtPayload.UserId, roles.CanCreateInviteLinks, db)
+	token, err := CreateNewInviteInDBWithTransaction(inviteRequest, auth.GetJWTPayload(c).UserId, tx)
 	if err != nil {
-		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
+		_ = tx.Rollback()
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
 
-	tx, err := db.Begin()
+	err = tx.Commit()
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	token, err := CreateNewInviteInDBWithTransaction(inviteRequest, tx)
-	if err != nil {
-		_ = tx.Rollback()
+	c.JSON(http.StatusCreated, InviteToken{
+		ExpiresAt:        inviteRequest.ExpirationDateTime,
+		InviteToken:      token,
+		InviteLink:       links.InviteLink(token),
+		Label:            inviteRequest.Label,
+		MaxUses:          inviteRequest.MaxUses,
+		RemainingUses:    inviteRequest.MaxUses,
+		RequiresApproval: inviteRequest.RequiresApproval,
+		Redemptions:      []InviteRedemption{},
+	})
+}
+
+// GetInviteQrCode godoc
+// @Summary Get the QR code of an invite link
+// @Description Returns a QR code of the invite link as PNG or SVG, to print it or show it on another device. Needs the can_view_invite_links permission.
+// @Tags Groups
+// @Produce png
+// @Produce image/svg+xml
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Param inviteToken query string true "Invite token"
+// @Param format query string false "png (default) or svg"
+// @Param size query int false "Width and height of the png in pixels, 128 to 2048"
+// @Success 200 {file} file "QR code of the invite link"
+// @Failure 400 {object} GroupError "Bad request - invalid parameters"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to view invite links"
+// @Failure 404 {object} GroupError "Not Found - the invite doesn't exist or belongs to another group"
+// @Failure 410 {object} GroupError "Gone - the invite is voided, expired or used up"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/invite/qr [get]
+func GetInviteQrCode(c *gin.Context, db *sql.DB) {
+	var qrCodeData RequestInviteQrCode
+	if err := c.ShouldBindQuery(&qrCodeData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	groupId, isUsable, err := GetInviteStateFromDB(qrCodeData.InviteToken, db)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
+	if groupId != qrCodeData.GroupId {
+		responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.InvalidInviteTokenError, "Invalid invite token")
+		return
+	}
+	if !isUsable {
+		responses.HttpErrorResponse(c.Writer, http.StatusGone, frontendErrors.InviteTokenIsNotUsableError, "The invite is voided, expired or used up")
+		return
+	}
 
-	err = tx.Commit()
+	inviteLink := links.InviteLink(qrCodeData.InviteToken)
+	if qrCodeData.Format == "svg" {
+		svg, err := qr.SVG(inviteLink)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svg)
+		return
+	}
+
+	size := qr.DefaultSize
+	if qrCodeData.Size != 0 {
+		size = qrCodeData.Size
+	}
+	png, err := qr.PNG(inviteLink, size)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-
-	c.JSON(http.StatusCreated, InviteToken{
-		ExpiresAt:   inviteRequest.ExpirationDateTime,
-		InviteToken: token,
-	})
+	c.Data(http.StatusOK, "image/png", png)
 }
 
 // JoinGroupWithInviteToken godoc
 // @Summary Join a group using an invite token
-// @Description Allows a user to join a specified group by validating an invite token. The user must have a valid token and necessary permissions.
+// @Description Allows a user to join a specified group by validating an invite token. If the invite or the group requires an approval, a join request is created instead and 202 is returned.
 // @Tags Groups
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token for authorization"
 // @Param inviteToken path string true "Invite token for joining the group"
-// @Success 200 {object} GroupSuccess "User successfully added to group"
+// @Success 200 {object} ResponseGroupId "User successfully added to group"
+// @Success 202 {object} ResponseJoinRequest "Join request created, an admin has to approve it"
 // @Failure 400 {object} GroupError "Bad request - error decoding request"
 // @Failure 401 {object} GroupError "Unauthorized - invalid invite token or lack of permissions"
+// @Failure 403 {object} GroupError "Forbidden - user is banned from the group"
 // @Failure 404 {object} GroupError "Not Found - user not found"
 // @Failure 500 {object} GroupError "Internal server error - error adding user to group"
 // @Router /groups/invite/join/{inviteToken} [post]
@@ -454,20 +570,21 @@ func JoinGroupWithInviteToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+	jwtPayload := auth.GetJWTPayload(c)
+
+	if !jwtPayload.HasScope(roles.ScopeGroups) || jwtPayload.LimitedToGroupId != "" {
+		responses.GenericApiTokenScopeError(c.Writer)
 		return
 	}
 
-	groupId, err := ValidateInviteTokenInDB(inviteData.InviteToken, db)
+	groupId, requiresApproval, err := ValidateInviteTokenInDB(inviteData.InviteToken, db)
 	if err != nil {
 		log.Println(err)
 		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidInviteTokenError, "Invalid invite token")
 		return
 	}
 
-	_, err = user.GetUserByIdFromDB(jwtPayload.UserId, db)
+	userData, err := user.GetUserByIdFromDB(jwtPayload.UserId, db)
 	if err != nil {
 		log.Println(err)
 		responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User not found")
@@ -487,6 +604,37 @@ func JoinGroupWithInviteToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	isBanned, err := IsUserBannedFromGroupInDB(groupId, jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if isBanned {
+		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.UserIsBannedFromGroupError, "You are banned from this group")
+		return
+	}
+
+	policies, err := GetGroupPoliciesFromDB(groupId, db)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if policies.RequireVerifiedEmail && !userData.EmailVerified {
+		responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.EmailIsNotVerifiedError, "This group only accepts members with a verified email")
+		return
+	}
+
+	if requiresApproval {
+		requestToJoinGroup(c, groupId, inviteData.InviteToken, jwtPayload.UserId, db)
+		return
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		log.Println(err)
@@ -495,6 +643,18 @@ func JoinGroupWithInviteToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	err = RedeemInviteTokenWithTransaction(inviteData.InviteToken, jwtPayload.UserId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, ErrNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidInviteTokenError, "Invalid invite token")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
 	userGroupId, err := AddUserToGroupWithTransaction(groupId, jwtPayload.UserId, tx)
 	if err != nil {
 		_ = tx.Rollback()
@@ -531,28 +691,9 @@ func GetAllInviteTokensInAGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := CheckIfUserIsAllowedToPerformAction(groupData.GroupId, jwtPayload.UserId, roles.CanViewInviteLinks, db)
-	if err != nil {
-		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
 	inviteTokens, err := GetAllInviteTokensInAGroupFromDB(groupData.GroupId, db)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
@@ -580,13 +721,9 @@ func VoidInviteToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	groupId, err := ValidateInviteTokenInDB(inviteData.InviteToken, db)
+	jwtPayload := auth.GetJWTPayload(c)
+
+	groupId, err := GetGroupIdOfInviteTokenFromDB(inviteData.InviteToken, db)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
 			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidInviteTokenError, "Invalid invite token")
@@ -596,7 +733,7 @@ func VoidInviteToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	canPerformAction, _, err := CheckIfUserIsAllowedToPerformAction(groupId, jwtPayload.UserId, roles.CanVoidInviteLinks, db)
+	membership, err := LoadMembership(c, groupId, db)
 	if err != nil {
 		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
 			responses.GenericGroupDoesNotExistError(c.Writer)
@@ -605,7 +742,7 @@ func VoidInviteToken(c *gin.Context, db *sql.DB) {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
+	if !membership.CanPerformAction(jwtPayload, roles.CanVoidInviteLinks) {
 		responses.GenericNotAllowedToPerformActionError(c.Writer)
 		return
 	}
@@ -626,7 +763,7 @@ func VoidInviteToken(c *gin.Context, db *sql.DB) {
 
 // LeaveGroup godoc
 // @Summary Leave a group
-// @Description Allows a user to leave a specified group. If the user is the last member or the last admin, additional handling is performed (e.g., delete the group or assign a new admin).
+// @Description Allows a user to leave a specified group. If the user is the last member the group gets deleted, if they are the last admin the member that joined first becomes admin.
 // @Tags Groups
 // @Accept json
 // @Produce json
@@ -645,32 +782,98 @@ func LeaveGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+	jwtPayload := auth.GetJWTPayload(c)
+	if !jwtPayload.HasScope(roles.ScopeGroups) {
+		responses.GenericApiTokenScopeError(c.Writer)
 		return
 	}
 
-	err = RemoveUserFromGroup(jwtPayload.UserId, groupData.GroupId, db) //TODO: some check for if a user was eiter the last user in a group or if there are no admins left. If he was the last one delete the group and if he was the last admin pick a new one by join-date
+	result, err := LeaveGroupInDB(jwtPayload.UserId, groupData.GroupId, db)
 	if err != nil {
 		if errors.Is(err, ErrNoMatchingGroupOrUser) {
 			responses.GenericGroupDoesNotExistError(c.Writer)
 			return
 		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
+	if result.GroupDeleted {
+		c.JSON(http.StatusOK, GroupSuccess{Message: "User left group, the group was deleted as nobody is left"})
+		return
+	}
 	c.JSON(http.StatusOK, GroupSuccess{Message: "User left group"})
 }
 
-func SyncAllGroups(c *gin.Context, db *sql.DB) {
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+// TransferGroupOwnership godoc
+// @Summary Transfer the ownership of a group
+// @Description Makes another member admin and owner of the group. Only the owner can transfer the ownership and loses the admin role unless keepAdminRole is set.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param transfer body RequestTransferOwnership true "Group and the member that becomes the new owner"
+// @Success 200 {object} GroupSuccess "Ownership transferred"
+// @Failure 400 {object} GroupError "Bad request - the new owner is the requester or needs two-factor authentication"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - the requester is not the owner"
+// @Failure 404 {object} GroupError "Not Found - the new owner is not a member of the group"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/owner [put]
+func TransferGroupOwnership(c *gin.Context, db *sql.DB) {
+	var transferData RequestTransferOwnership
+	if err := c.ShouldBindJSON(&transferData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	if transferData.UserId == jwtPayload.UserId {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	policies, err := GetGroupPoliciesFromDB(transferData.GroupId, db)
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if policies.RequireAdminTwoFactor {
+		twoFactorEnabled, err := user.IsTwoFactorEnabled(transferData.UserId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if !twoFactorEnabled {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorRequiredForAdminError, "This group requires admins to use two-factor authentication")
+			return
+		}
+	}
+
+	err = TransferGroupOwnershipInDB(transferData.GroupId, jwtPayload.UserId, transferData.UserId, transferData.KeepAdminRole, db)
+	if err != nil {
+		if errors.Is(err, ErrNotTheOwner) {
+			responses.GenericNotAllowedToPerformActionError(c.Writer)
+			return
+		}
+		if errors.Is(err, ErrUserIsNotPartOfThisGroup) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist in this group")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Ownership transferred"})
+}
+
+func SyncAllGroups(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
 	var request GenericTypes.LastUpdatedRequest
 	if err := c.ShouldBindQuery(&request); err != nil {
 		responses.GenericBadRequestError(c.Writer)
@@ -691,6 +894,13 @@ func SyncAllGroups(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if jwtPayload.LimitedToGroupId != "" {
+		groups = filterGroupsForToken(groups, jwtPayload)
+		deleteGroupIds = slices.DeleteFunc(deleteGroupIds, func(groupId string) bool {
+			return !jwtPayload.CanAccessGroup(groupId)
+		})
+	}
+
 	response := AllGroupsSyncResponse{
 		Groups:     groups,
 		DeletedIds: deleteGroupIds,
@@ -705,22 +915,7 @@ func SyncSpecificGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	inGroup, err := IsUserInGroup(request.GroupId, jwtPayload.UserId, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !inGroup {
-		responses.GenericForbiddenError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	groupInformation, err := GetGroupInformationFromDb(request.GroupId, jwtPayload.UserId, db)
 	if err != nil {
@@ -764,28 +959,458 @@ func SyncGroupMembers(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	memberSyncResponse, err := getSyncGroupMembersResponse(request.GroupId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	log.Println(memberSyncResponse)
+	c.JSON(http.StatusOK, memberSyncResponse)
+}
+
+// GetGroupJoinRequests godoc
+// @Summary List the pending join requests of a group
+// @Description Returns the join requests that wait for a decision, oldest first. Needs the can_manage_join_requests permission.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} JoinRequest "Pending join requests"
+// @Failure 400 {object} GroupError "Bad request - invalid group ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to manage join requests"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/join-requests [get]
+func GetGroupJoinRequests(c *gin.Context, db *sql.DB) {
+	var groupData RequestIdGroup
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	joinRequests, err := GetPendingJoinRequestsOfGroupFromDB(groupData.GroupId, db)
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	inGroup, err := IsUserInGroup(request.GroupId, jwtPayload.UserId, db)
+	c.JSON(http.StatusOK, joinRequests)
+}
+
+// ApproveJoinRequest godoc
+// @Summary Approve a join request
+// @Description Adds the requester to the group as member. Needs the can_manage_join_requests permission.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param decision body RequestJoinRequestDecision true "Group and join request"
+// @Success 200 {object} GroupSuccess "Join request approved"
+// @Failure 400 {object} GroupError "Bad request - error decoding request"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to manage join requests or the requester is banned, the request is rejected"
+// @Failure 404 {object} GroupError "Not Found - no pending join request with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/join-requests/approve [post]
+func ApproveJoinRequest(c *gin.Context, db *sql.DB) {
+	var decisionData RequestJoinRequestDecision
+	if err := c.ShouldBindJSON(&decisionData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	_, err := ApproveJoinRequestInDB(decisionData.GroupId, decisionData.JoinRequestId, jwtPayload.UserId, db)
 	if err != nil {
+		if errors.Is(err, ErrJoinRequestNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.JoinRequestDoesNotExistError, "Join request does not exist")
+			return
+		}
+		if errors.Is(err, ErrUserIsBanned) {
+			responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.UserIsBannedFromGroupError, "The user is banned from this group")
+			return
+		}
 		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !inGroup {
-		responses.GenericForbiddenError(c.Writer)
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Join request approved"})
+}
+
+// RejectJoinRequest godoc
+// @Summary Reject a join request
+// @Description Rejects a pending join request. Needs the can_manage_join_requests permission.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param decision body RequestJoinRequestDecision true "Group and join request"
+// @Success 200 {object} GroupSuccess "Join request rejected"
+// @Failure 400 {object} GroupError "Bad request - error decoding request"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to manage join requests"
+// @Failure 404 {object} GroupError "Not Found - no pending join request with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/join-requests/reject [post]
+func RejectJoinRequest(c *gin.Context, db *sql.DB) {
+	var decisionData RequestJoinRequestDecision
+	if err := c.ShouldBindJSON(&decisionData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
-	memberSyncResponse, err := getSyncGroupMembersResponse(request.GroupId, db)
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	err := RejectJoinRequestInDB(decisionData.GroupId, decisionData.JoinRequestId, jwtPayload.UserId, db)
 	if err != nil {
+		if errors.Is(err, ErrJoinRequestNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.JoinRequestDoesNotExistError, "Join request does not exist")
+			return
+		}
 		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	log.Println(memberSyncResponse)
-	c.JSON(http.StatusOK, memberSyncResponse)
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Join request rejected"})
+}
+
+// GetOwnJoinRequests godoc
+// @Summary List the own pending join requests
+// @Description Returns the join requests of the requester that wait for a decision, newest first.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Success 200 {array} JoinRequest "Pending join requests of the requester"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/join-requests/own [get]
+func GetOwnJoinRequests(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	joinRequests, err := GetPendingJoinRequestsOfUserFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, filterJoinRequestsForToken(joinRequests, jwtPayload))
+}
+
+// CancelOwnJoinRequest godoc
+// @Summary Cancel an own join request
+// @Description Withdraws a join request of the requester that is still pending.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param joinRequestId query string true "Join request ID"
+// @Success 200 {object} GroupSuccess "Join request cancelled"
+// @Failure 400 {object} GroupError "Bad request - invalid join request ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 404 {object} GroupError "Not Found - no pending join request with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/join-requests/own [delete]
+func CancelOwnJoinRequest(c *gin.Context, db *sql.DB) {
+	var joinRequestData RequestJoinRequestId
+	if err := c.ShouldBindQuery(&joinRequestData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	if !jwtPayload.HasScope(roles.ScopeGroups) || jwtPayload.LimitedToGroupId != "" {
+		responses.GenericApiTokenScopeError(c.Writer)
+		return
+	}
+
+	err := CancelJoinRequestInDB(jwtPayload.UserId, joinRequestData.JoinRequestId, db)
+	if err != nil {
+		if errors.Is(err, ErrJoinRequestNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.JoinRequestDoesNotExistError, "Join request does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Join request cancelled"})
+}
+
+// CreateInvitation godoc
+// @Summary Invite a user to a group
+// @Description Creates a pending invitation for the user with the username or email. The user accepts or declines it in their account. Needs the can_create_invite_links permission. Invitations by email always get the same 202 response, so nobody can find out which emails are registered.
+// @Tags Groups
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param invitation body RequestCreateInvitation true "Group and invited user"
+// @Success 201 {object} ResponseInvitationId "Invitation created"
+// @Success 202 {object} GroupSuccess "Invitation by email handled"
+// @Failure 400 {object} GroupError "Bad request - error decoding request or inviting yourself"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to invite, or the user is banned (username only)"
+// @Failure 404 {object} GroupError "Not Found - user does not exist (username only)"
+// @Failure 409 {object} GroupError "Conflict - user is already a member or already invited (username only)"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/invitations [post]
+func CreateInvitation(c *gin.Context, db *sql.DB) {
+	var invitationData RequestCreateInvitation
+	if err := c.ShouldBindJSON(&invitationData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	byEmail := invitationData.Username == ""
+
+	invitedUser, err := getInvitedUser(invitationData, db)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			respondWithInvitationRefusal(c, byEmail, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if invitedUser.UserId == jwtPayload.UserId {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	isMember, err := IsUserInGroup(invitationData.GroupId, invitedUser.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if isMember {
+		respondWithInvitationRefusal(c, byEmail, http.StatusConflict, frontendErrors.UserIsAlreadyMemberError, "The user is already a member of this group")
+		return
+	}
+
+	isBanned, err := IsUserBannedFromGroupInDB(invitationData.GroupId, invitedUser.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if isBanned {
+		respondWithInvitationRefusal(c, byEmail, http.StatusForbidden, frontendErrors.UserIsBannedFromGroupError, "The user is banned from this group")
+		return
+	}
+
+	lifeTime := invitationLifeTime
+	if invitationData.ExpiresInDays > 0 {
+		lifeTime = time.Hour * 24 * time.Duration(invitationData.ExpiresInDays)
+	}
+
+	invitationId, err := CreateInvitationInDB(invitationData.GroupId, invitedUser.UserId, jwtPayload.UserId, time.Now().Add(lifeTime), db)
+	if err != nil {
+		if errors.Is(err, ErrInvitationAlreadyPending) {
+			respondWithInvitationRefusal(c, byEmail, http.StatusConflict, frontendErrors.InvitationAlreadyPendingError, "The user already has a pending invitation to this group")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	if byEmail {
+		respondToEmailInvitation(c)
+		return
+	}
+	c.JSON(http.StatusCreated, ResponseInvitationId{InvitationId: invitationId})
+}
+
+// GetGroupInvitations godoc
+// @Summary List the pending invitations of a group
+// @Description Returns the invitations that are neither answered nor expired, newest first. Needs the can_view_invite_links permission.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} Invitation "Pending invitations"
+// @Failure 400 {object} GroupError "Bad request - invalid group ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to view invitations"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/invitations [get]
+func GetGroupInvitations(c *gin.Context, db *sql.DB) {
+	var groupData RequestIdGroup
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	invitations, err := GetPendingInvitationsOfGroupFromDB(groupData.GroupId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Description Revokes a pending invitation, so the user can't accept it anymore. Needs the can_void_invite_links permission.
+// @Tags Groups
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Param invitationId query string true "Invitation ID"
+// @Success 200 {object} GroupSuccess "Invitation revoked"
+// @Failure 400 {object} GroupError "Bad request - invalid group or invitation ID"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - not allowed to revoke invitations"
+// @Failure 404 {object} GroupError "Not Found - no pending invitation with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /groups/invitations [delete]
+func RevokeInvitation(c *gin.Context, db *sql.DB) {
+	var invitationData RequestGroupInvitationId
+	if err := c.ShouldBindQuery(&invitationData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := RevokeInvitationInDB(invitationData.GroupId, invitationData.InvitationId, db)
+	if err != nil {
+		respondWithInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Invitation revoked"})
+}
+
+// GetOwnInvitations godoc
+// @Summary List the own pending invitations
+// @Description Returns the invitations of the requester that can still be accepted, newest first.
+// @Tags Users
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Success 200 {array} Invitation "Pending invitations of the requester"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /users/invitations [get]
+func GetOwnInvitations(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	invitations, err := GetPendingInvitationsOfUserFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, filterInvitationsForToken(invitations, jwtPayload))
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Joins the group of a pending invitation as member.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param invitation body RequestInvitationId true "Invitation"
+// @Success 200 {object} ResponseGroupId "Joined the group"
+// @Failure 400 {object} GroupError "Bad request - error decoding request"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 403 {object} GroupError "Forbidden - banned from the group or the email is not verified"
+// @Failure 404 {object} GroupError "Not Found - no pending invitation with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /users/invitations/accept [post]
+func AcceptInvitation(c *gin.Context, db *sql.DB) {
+	var invitationData RequestInvitationId
+	if err := c.ShouldBindJSON(&invitationData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	if !jwtPayload.HasScope(roles.ScopeGroups) || jwtPayload.LimitedToGroupId != "" {
+		responses.GenericApiTokenScopeError(c.Writer)
+		return
+	}
+
+	groupId, err := GetGroupIdOfPendingInvitationFromDB(jwtPayload.UserId, invitationData.InvitationId, db)
+	if err != nil {
+		respondWithInvitationError(c, err)
+		return
+	}
+
+	policies, err := GetGroupPoliciesFromDB(groupId, db)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if policies.RequireVerifiedEmail {
+		userData, err := user.GetUserByIdFromDB(jwtPayload.UserId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if !userData.EmailVerified {
+			responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.EmailIsNotVerifiedError, "This group only accepts members with a verified email")
+			return
+		}
+	}
+
+	groupId, err = AcceptInvitationInDB(jwtPayload.UserId, invitationData.InvitationId, db)
+	if err != nil {
+		respondWithInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseGroupId{GroupId: groupId})
+}
+
+// DeclineInvitation godoc
+// @Summary Decline an invitation
+// @Description Declines a pending invitation of the requester.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param invitation body RequestInvitationId true "Invitation"
+// @Success 200 {object} GroupSuccess "Invitation declined"
+// @Failure 400 {object} GroupError "Bad request - error decoding request"
+// @Failure 401 {object} GroupError "Unauthorized - invalid authorization token"
+// @Failure 404 {object} GroupError "Not Found - no pending invitation with this id"
+// @Failure 500 {object} GroupError "Internal server error"
+// @Router /users/invitations/decline [post]
+func DeclineInvitation(c *gin.Context, db *sql.DB) {
+	var invitationData RequestInvitationId
+	if err := c.ShouldBindJSON(&invitationData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	if !jwtPayload.HasScope(roles.ScopeGroups) || jwtPayload.LimitedToGroupId != "" {
+		responses.GenericApiTokenScopeError(c.Writer)
+		return
+	}
+
+	err := DeclineInvitationInDB(jwtPayload.UserId, invitationData.InvitationId, db)
+	if err != nil {
+		respondWithInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GroupSuccess{Message: "Invitation declined"})
 }
@@ -1,5 +1,7 @@
 package group
 
+import "time"
+
 type GroupError struct {
 	Error string `json:"error"`
 }
@@ -24,19 +26,135 @@ type RequestInviteToken struct {
 	InviteToken string `form:"inviteToken" binding:"required,uuid"`
 }
 
+type RequestInviteQrCode struct {
+	GroupId     string `form:"groupId" binding:"required,uuid"`
+	InviteToken string `form:"inviteToken" binding:"required,uuid"`
+	Format      string `form:"format" binding:"omitempty,oneof=png svg"`  // defaults to png
+	Size        int    `form:"size" binding:"omitempty,min=128,max=2048"` // width of the png in pixels, defaults to qr.DefaultSize
+}
+
 type RequestUpdateGroupName struct {
 	GroupId   string `json:"groupId" binding:"required,uuid"`
 	GroupName string `json:"groupName" binding:"required"`
 }
 
+type RequestUpdateGroupPolicies struct {
+	GroupId               string `json:"groupId" binding:"required,uuid"`
+	RequireVerifiedEmail  *bool  `json:"requireVerifiedEmail"`
+	RequireAdminTwoFactor *bool  `json:"requireAdminTwoFactor"`
+	RequireJoinApproval   *bool  `json:"requireJoinApproval"`
+}
+
+type GroupPolicies struct {
+	GroupId               string `json:"groupId"`
+	RequireVerifiedEmail  bool   `json:"requireVerifiedEmail"`
+	RequireAdminTwoFactor bool   `json:"requireAdminTwoFactor"`
+	RequireJoinApproval   bool   `json:"requireJoinApproval"`
+}
+
+type GroupSettings struct {
+	GroupId          string            `json:"groupId"`
+	TimeZone         string            `json:"timeZone"`         // IANA name, e.g. "Europe/Zurich"
+	WeekStart        int               `json:"weekStart"`        // 0 is Sunday, like time.Weekday
+	Locale           string            `json:"locale"`           // BCP 47 language tag
+	MealTypes        []string          `json:"mealTypes"`        // offered when creating a meal, in this order
+	DefaultMealTimes map[string]string `json:"defaultMealTimes"` // meal type => "HH:MM" in the time zone of the group
+}
+
+// RequestUpdateGroupSettings changes the settings that are set, the others stay as they are.
+type RequestUpdateGroupSettings struct {
+	GroupId          string            `json:"groupId" binding:"required,uuid"`
+	TimeZone         *string           `json:"timeZone" binding:"omitempty,max=64"`
+	WeekStart        *int              `json:"weekStart" binding:"omitempty,min=0,max=6"`
+	Locale           *string           `json:"locale" binding:"omitempty,max=35"`
+	MealTypes        []string          `json:"mealTypes" binding:"omitempty,max=20,dive,required,max=50"`
+	DefaultMealTimes map[string]string `json:"defaultMealTimes"`
+}
+
 type InviteLinkGenerationRequest struct {
-	GroupId            string `json:"groupId" binding:"required,uuid"`
-	ExpirationDateTime string `json:"expiresAt" binding:"required,dateTime"`
+	GroupId            string  `json:"groupId" binding:"required,uuid"`
+	ExpirationDateTime string  `json:"expiresAt" binding:"required,dateTime"`
+	Label              *string `json:"label" binding:"omitempty,max=100"`
+	MaxUses            *int    `json:"maxUses" binding:"omitempty,min=1"` // unlimited if empty
+	RequiresApproval   bool    `json:"requiresApproval"`
 }
 
 type InviteToken struct {
-	InviteToken string `json:"inviteToken"`
-	ExpiresAt   string `json:"expiresAt"`
+	InviteToken      string             `json:"inviteToken"`
+	InviteLink       string             `json:"inviteLink"`
+	ExpiresAt        string             `json:"expiresAt"`
+	Label            *string            `json:"label"`
+	MaxUses          *int               `json:"maxUses"`
+	UseCount         int                `json:"useCount"`
+	RemainingUses    *int               `json:"remainingUses"` // nil for invites without a limit
+	RequiresApproval bool               `json:"requiresApproval"`
+	Redemptions      []InviteRedemption `json:"redemptions"`
+}
+
+type JoinRequest struct {
+	JoinRequestId string    `json:"joinRequestId"`
+	GroupId       string    `json:"groupId"`
+	GroupName     string    `json:"groupName"`
+	UserId        string    `json:"userId"`
+	Username      string    `json:"username"`
+	InviteToken   *string   `json:"inviteToken"`
+	InviteLabel   *string   `json:"inviteLabel"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type RequestJoinRequestDecision struct {
+	GroupId       string `json:"groupId" binding:"required,uuid"`
+	JoinRequestId string `json:"joinRequestId" binding:"required,uuid"`
+}
+
+type RequestJoinRequestId struct {
+	JoinRequestId string `form:"joinRequestId" binding:"required,uuid"`
+}
+
+type ResponseJoinRequest struct {
+	JoinRequestId string `json:"joinRequestId"`
+	GroupId       string `json:"groupId"`
+	Status        string `json:"status"`
+}
+
+type Invitation struct {
+	InvitationId      string    `json:"invitationId"`
+	GroupId           string    `json:"groupId"`
+	GroupName         string    `json:"groupName"`
+	UserId            string    `json:"userId"`
+	Username          string    `json:"username"`
+	InvitedBy         *string   `json:"invitedBy"`
+	InvitedByUsername *string   `json:"invitedByUsername"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// RequestCreateInvitation needs either the username or the email of the invited user.
+type RequestCreateInvitation struct {
+	GroupId       string `json:"groupId" binding:"required,uuid"`
+	Username      string `json:"username" binding:"required_without=Email"`
+	Email         string `json:"email" binding:"required_without=Username,omitempty,email"`
+	ExpiresInDays int    `json:"expiresInDays" binding:"omitempty,min=1,max=30"` // defaults to invitationLifeTime
+}
+
+type RequestGroupInvitationId struct {
+	GroupId      string `form:"groupId" binding:"required,uuid"`
+	InvitationId string `form:"invitationId" binding:"required,uuid"`
+}
+
+type RequestInvitationId struct {
+	InvitationId string `json:"invitationId" binding:"required,uuid"`
+}
+
+type ResponseInvitationId struct {
+	InvitationId string `json:"invitationId"`
+}
+
+type InviteRedemption struct {
+	UserId     string    `json:"userId"`
+	Username   string    `json:"username"`
+	RedeemedAt time.Time `json:"redeemedAt"`
 }
 
 type InviteLinkGenerationResponse struct {
@@ -62,17 +180,25 @@ type Group struct {
 }
 
 type MealCard struct {
-	MealId           string `json:"mealId"`
-	GroupId          string `json:"groupId"`
-	Title            string `json:"title"`
-	Closed           bool   `json:"closed"`
-	Fulfilled        bool   `json:"fulfilled"`
-	DateTime         string `json:"dateTime"`
-	MealType         string `json:"mealType"`
-	Notes            string `json:"notes"`
-	ParticipantCount int    `json:"participantCount"`
-	UserPreference   string `json:"userPreference"`
-	IsCook           bool   `json:"isCook"`
+	MealId           string  `json:"mealId"`
+	GroupId          string  `json:"groupId"`
+	Title            string  `json:"title"`
+	Closed           bool    `json:"closed"`
+	Fulfilled        bool    `json:"fulfilled"`
+	DateTime         string  `json:"dateTime"`
+	MealType         string  `json:"mealType"`
+	Notes            string  `json:"notes"`
+	ParticipantCount int     `json:"participantCount"` // opt-ins and their guests
+	MaybeCount       int     `json:"maybeCount"`       // maybes and their guests
+	UserPreference   string  `json:"userPreference"`
+	IsCook           bool    `json:"isCook"`
+	SeriesId         *string `json:"seriesId"` // set for occurrences of a recurring meal
+
+	PreferenceDeadline *string `json:"preferenceDeadline"` // preferences can't be changed after it
+
+	MaxParticipants      *int `json:"maxParticipants"` // seats including guests, nil for no limit
+	WaitlistCount        int  `json:"waitlistCount"`
+	UserWaitlistPosition *int `json:"userWaitlistPosition"` // starts at 1, nil when the user is not waiting
 }
 
 type Member struct {
@@ -110,3 +236,22 @@ type AllGroupsSyncResponse struct {
 	Groups     []GroupInfo `json:"groups"`
 	DeletedIds []string    `json:"deletedIds"`
 }
+
+// LeaveResult tells what else changed in the group when a member left.
+type LeaveResult struct {
+	GroupDeleted bool
+	NewAdminId   string // set if the leaving user was the last admin
+}
+
+type RequestTransferOwnership struct {
+	GroupId       string `json:"groupId" binding:"required,uuid"`
+	UserId        string `json:"userId" binding:"required,uuid"`
+	KeepAdminRole bool   `json:"keepAdminRole"` // the old owner loses the admin role unless this is set
+}
+
+// Membership is the membership of the requesting user in a group with the roles that currently apply.
+type Membership struct {
+	GroupId     string
+	Roles       []string
+	Permissions []string // permissions of the roles, read from group_roles
+}
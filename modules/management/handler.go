@@ -2,31 +2,51 @@ package management
 
 import (
 	"database/sql"
+	"enguete/modules/group"
+	"enguete/util/roles"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterManagementRoute(router *gin.Engine, db *sql.DB) {
+func RegisterManagementRoute(router *gin.RouterGroup, db *sql.DB) {
 	registerUserManagementRoutes(router, db)
 	registerRoleManagementRoutes(router, db)
 }
 
-func registerUserManagementRoutes(router *gin.Engine, db *sql.DB) {
-	router.DELETE("management/user/kick", func(c *gin.Context) {
+func registerUserManagementRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.DELETE("management/user/kick", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanKickUsers), func(c *gin.Context) {
 		KickUserFromGroup(c, db)
 	})
-	router.DELETE("management/user/ban", func(c *gin.Context) {
+	router.DELETE("management/user/ban", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanBanUsers), func(c *gin.Context) {
 		BanUserFromGroup(c, db)
 	})
-	router.DELETE("management/user/unban", func(c *gin.Context) {
+	router.DELETE("management/user/unban", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanUnbanUser), func(c *gin.Context) {
 		UnbanUserFromGroup(c, db)
 	})
+	router.GET("management/user/bans", group.RequireGroupPermission(db, group.FromQuery("groupId"), roles.CanBanUsers), func(c *gin.Context) {
+		GetGroupBans(c, db)
+	})
 }
 
-func registerRoleManagementRoutes(router *gin.Engine, db *sql.DB) {
-	router.POST("management/roles/add", func(c *gin.Context) {
+func registerRoleManagementRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("management/roles/permissions", func(c *gin.Context) {
+		GetPermissions(c)
+	})
+	router.GET("management/roles", group.RequireGroupMember(db, group.FromQuery("groupId")), func(c *gin.Context) {
+		GetGroupRoles(c, db)
+	})
+	router.POST("management/roles", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanManageRoles), func(c *gin.Context) {
+		CreateGroupRole(c, db)
+	})
+	router.PUT("management/roles", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanManageRoles), func(c *gin.Context) {
+		UpdateGroupRole(c, db)
+	})
+	router.DELETE("management/roles", group.RequireGroupPermission(db, group.FromQuery("groupId"), roles.CanManageRoles), func(c *gin.Context) {
+		DeleteGroupRole(c, db)
+	})
+	router.POST("management/roles/add", group.RequireGroupMember(db, group.FromJSON("groupId")), func(c *gin.Context) {
 		AddRoleToUser(c, db)
 	})
-	router.POST("management/roles/remove", func(c *gin.Context) {
+	router.POST("management/roles/remove", group.RequireGroupMember(db, group.FromJSON("groupId")), func(c *gin.Context) {
 		RemoveRoleFromUser(c, db)
 	})
 }
@@ -0,0 +1,104 @@
+package management
+
+import (
+	"database/sql"
+	"enguete/modules/group"
+	"enguete/util/frontendErrors"
+	"enguete/util/responses"
+	"enguete/util/roles"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// normalizePermissions validates the permissions of a role and removes duplicates. A requester can only grant
+// permissions their own roles have, otherwise managing roles would allow anyone to become an admin.
+//
+// return false => the error response was written
+func normalizePermissions(c *gin.Context, permissions []string) ([]string, bool) {
+	for _, permission := range permissions {
+		if !roles.IsValidPermission(permission) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidPermissionError, "Unknown permission: "+permission)
+			return nil, false
+		}
+	}
+	if !canGrantPermissions(c, permissions) {
+		return nil, false
+	}
+
+	permissions = slices.Clone(permissions)
+	slices.Sort(permissions)
+	return slices.Compact(permissions), true
+}
+
+// canGrantPermissions writes the error response if the requester doesn't have one of the permissions.
+func canGrantPermissions(c *gin.Context, permissions []string) bool {
+	membership := group.GetMembership(c)
+	for _, permission := range permissions {
+		if !roles.CanPerformAction(membership.Permissions, permission) {
+			responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.CantGrantMissingPermissionError, "You can't grant a permission you don't have yourself")
+			return false
+		}
+	}
+	return true
+}
+
+// canActOnMember writes the error response if the member has a permission the requester doesn't have, otherwise a
+// moderator could kick or ban the admins. Users that are not a member can always be acted on.
+func canActOnMember(c *gin.Context, groupId string, userId string, db *sql.DB) bool {
+	target, err := group.GetMembershipFromDB(groupId, userId, db)
+	if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
+		return true
+	}
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return false
+	}
+
+	membership := group.GetMembership(c)
+	for _, permission := range target.Permissions {
+		if !roles.CanPerformAction(membership.Permissions, permission) {
+			responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.MemberOutranksYouError, "The member has permissions you don't have")
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithRemoveMemberError writes the response for the errors of group.RemoveMemberFromGroup.
+//
+// return false => err is not one of them
+func respondWithRemoveMemberError(c *gin.Context, err error) bool {
+	if errors.Is(err, group.ErrCantRemoveOwner) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.CantRemoveOwnerError, "The owner can't be removed from the group")
+		return true
+	}
+	if errors.Is(err, group.ErrLastAdmin) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.LastAdminError, "The group needs at least one admin, transfer the ownership first")
+		return true
+	}
+	return false
+}
+
+func normalizeRoleName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// respondWithRoleError writes the response for the errors of the role queries.
+//
+// return false => err is not one of them
+func respondWithRoleError(c *gin.Context, err error) bool {
+	if errors.Is(err, ErrRoleNotFound) {
+		responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.RoleDoesNotExistError, "Role does not exist")
+		return true
+	}
+	if errors.Is(err, ErrRoleAlreadyExists) {
+		responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.RoleAlreadyExistsError, "The group already has a role with this name")
+		return true
+	}
+	return false
+}
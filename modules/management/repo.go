@@ -1,12 +1,217 @@
 package management
 
-import "database/sql"
+import (
+	"database/sql"
+	"enguete/modules/group"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+var ErrBanNotFound = errors.New("ban not found")
+
+// BanUserFromGroupInDB removes the user from the group, if they are still a member, and puts them on the blacklist.
+// Banning a user again replaces the old ban. Returns the errors of group.RemoveMemberFromGroup for the owner and the
+// last admin.
+func BanUserFromGroupInDB(groupId string, userId string, bannedBy string, reason string, expiresAt *time.Time, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = group.RemoveMemberFromGroupWithTransaction(userId, groupId, tx)
+	if err != nil && !errors.Is(err, group.ErrNoMatchingGroupOrUser) {
+		_ = tx.Rollback()
+		return err
+	}
 
-func UnBanUserFromGroupInDB(userId string, groupId string, db *sql.DB) error {
+	query := `
+	INSERT INTO user_groups_blacklist (user_id, group_id, banned_by, reason, expires_at)
+	VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	ON CONFLICT (user_id, group_id) DO UPDATE
+	SET banned_by = EXCLUDED.banned_by,
+	    reason = EXCLUDED.reason,
+	    expires_at = EXCLUDED.expires_at,
+	    banned_at = NOW(),
+	    updated_at = NOW()
+`
+	_, err = tx.Exec(query, userId, groupId, bannedBy, reason, expiresAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnBanUserFromGroupInDB returns ErrBanNotFound if the user is not banned from the group.
+func UnBanUserFromGroupInDB(groupId string, userId string, db *sql.DB) error {
 	query := `
 	DELETE FROM user_groups_blacklist
-	WHERE user_id = $1 AND group_id = $2
+	WHERE group_id = $1 AND user_id = $2
 `
-	_, err := db.Exec(query, userId, groupId)
+	result, err := db.Exec(query, groupId, userId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrBanNotFound
+	}
+	return nil
+}
+
+// GetActiveBansFromDB returns the bans of the group that are not expired, newest first.
+func GetActiveBansFromDB(groupId string, db *sql.DB) ([]Ban, error) {
+	query := `
+	SELECT b.user_id, u.username, b.banned_by, bu.username, b.reason, b.banned_at, b.expires_at
+	FROM user_groups_blacklist b
+	INNER JOIN users u ON u.user_id = b.user_id
+	LEFT JOIN users bu ON bu.user_id = b.banned_by
+	WHERE b.group_id = $1
+	AND (b.expires_at IS NULL OR b.expires_at > NOW())
+	ORDER BY b.banned_at DESC
+`
+	rows, err := db.Query(query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var ban Ban
+		err := rows.Scan(&ban.UserId, &ban.Username, &ban.BannedBy, &ban.BannedByUsername, &ban.Reason, &ban.BannedAt, &ban.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+// DeleteExpiredBansInDB runs as a scheduled job, see main.go.
+func DeleteExpiredBansInDB(db *sql.DB) error {
+	query := `DELETE FROM user_groups_blacklist WHERE expires_at <= NOW()`
+	_, err := db.Exec(query)
 	return err
 }
+
+var ErrRoleNotFound = errors.New("role not found")
+var ErrRoleAlreadyExists = errors.New("role already exists")
+
+const groupRoleColumns = `group_role_id, group_id, name, permissions, is_default`
+
+func scanGroupRole(row interface{ Scan(...any) error }) (GroupRole, error) {
+	var role GroupRole
+	err := row.Scan(&role.RoleId, &role.GroupId, &role.Name, pq.Array(&role.Permissions), &role.IsDefault)
+	return role, err
+}
+
+func GetGroupRolesFromDB(groupId string, db *sql.DB) ([]GroupRole, error) {
+	query := `
+	SELECT ` + groupRoleColumns + `
+	FROM group_roles
+	WHERE group_id = $1
+	ORDER BY is_default DESC, created_at, name
+`
+	rows, err := db.Query(query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groupRoles := []GroupRole{}
+	for rows.Next() {
+		role, err := scanGroupRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		groupRoles = append(groupRoles, role)
+	}
+	return groupRoles, rows.Err()
+}
+
+// GetGroupRoleByNameFromDB returns ErrRoleNotFound if the group has no role with this name.
+func GetGroupRoleByNameFromDB(groupId string, name string, db *sql.DB) (GroupRole, error) {
+	query := `
+	SELECT ` + groupRoleColumns + `
+	FROM group_roles
+	WHERE group_id = $1 AND name = $2
+`
+	role, err := scanGroupRole(db.QueryRow(query, groupId, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return role, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// GetGroupRoleFromDB returns ErrRoleNotFound if the role doesn't exist or belongs to another group.
+func GetGroupRoleFromDB(groupId string, roleId string, db *sql.DB) (GroupRole, error) {
+	query := `
+	SELECT ` + groupRoleColumns + `
+	FROM group_roles
+	WHERE group_id = $1 AND group_role_id = $2
+`
+	role, err := scanGroupRole(db.QueryRow(query, groupId, roleId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return role, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// CreateGroupRoleInDB returns ErrRoleAlreadyExists if the group already has a role with this name.
+func CreateGroupRoleInDB(groupId string, name string, permissions []string, db *sql.DB) (GroupRole, error) {
+	query := `
+	INSERT INTO group_roles (group_id, name, permissions)
+	VALUES ($1, $2, $3)
+	RETURNING ` + groupRoleColumns
+	role, err := scanGroupRole(db.QueryRow(query, groupId, name, pq.Array(permissions)))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return role, ErrRoleAlreadyExists
+	}
+	return role, err
+}
+
+// UpdateGroupRoleInDB renames the role and replaces its permissions. Members keep the role, the new name is
+// cascaded to user_group_roles.
+func UpdateGroupRoleInDB(groupId string, roleId string, name string, permissions []string, db *sql.DB) (GroupRole, error) {
+	query := `
+	UPDATE group_roles
+	SET name = $3, permissions = $4, updated_at = NOW()
+	WHERE group_id = $1 AND group_role_id = $2
+	RETURNING ` + groupRoleColumns
+	role, err := scanGroupRole(db.QueryRow(query, groupId, roleId, name, pq.Array(permissions)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return role, ErrRoleNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return role, ErrRoleAlreadyExists
+	}
+	return role, err
+}
+
+// DeleteGroupRoleInDB deletes a role that is not a default role, members lose it through the foreign key.
+func DeleteGroupRoleInDB(groupId string, roleId string, db *sql.DB) error {
+	query := `
+	DELETE FROM group_roles
+	WHERE group_id = $1 AND group_role_id = $2 AND NOT is_default
+`
+	result, err := db.Exec(query, groupId, roleId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package management
 import (
 	"database/sql"
 	"enguete/modules/group"
+	"enguete/modules/user"
 	"enguete/util/auth"
 	"enguete/util/frontendErrors"
 	"enguete/util/responses"
@@ -11,6 +12,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // KickUserFromGroup godoc
@@ -22,8 +25,9 @@ import (
 // @Param Authorization header string true "Bearer token for authorization"
 // @Param kickUserData body RequestKickUser true "Payload to kick user from group"
 // @Success 200 {object} ManagementSuccess "User successfully kicked from group"
-// @Failure 400 {object} ManagementError "Error decoding request" or "You can't kick yourself"
+// @Failure 400 {object} ManagementError "Error decoding request", "You can't kick yourself" or the user is the owner or last admin
 // @Failure 401 {object} ManagementError "Unauthorized" or "You are not allowed to perform this action"
+// @Failure 403 {object} ManagementError "The member has permissions you don't have"
 // @Failure 500 {object} ManagementError "Internal server error"
 // @Router /management/user/kick [post]
 func KickUserFromGroup(c *gin.Context, db *sql.DB) {
@@ -33,32 +37,25 @@ func KickUserFromGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 	if jwtPayload.UserId == kickUserData.UserId {
 		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.YouCantKickOrBanYourselfError, "You can't kick yourself. You need To leave the group")
 		return
 	}
 
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(kickUserData.GroupId, jwtPayload.UserId, roles.CanKickUsers, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+	if !canActOnMember(c, kickUserData.GroupId, kickUserData.UserId, db) {
 		return
 	}
 
-	err = group.RemoveUserFromGroup(kickUserData.UserId, kickUserData.GroupId, db)
+	err := group.RemoveMemberFromGroup(kickUserData.UserId, kickUserData.GroupId, db)
 	if err != nil {
+		if errors.Is(err, group.ErrNoMatchingGroupOrUser) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist in this group")
+			return
+		}
+		if respondWithRemoveMemberError(c, err) {
+			return
+		}
 		log.Println("error kicking user from group:", err)
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -71,59 +68,55 @@ func KickUserFromGroup(c *gin.Context, db *sql.DB) {
 
 // BanUserFromGroup godoc
 // @Summary Ban a user from a group
-// @Description Allows a user to ban another user within a group, adding them to the banned list. The requesting user must be a group member with the appropriate permissions to perform this action.
+// @Description Removes a user from a group and puts them on the blacklist of the group, so they can't join again until the ban expires or gets lifted. Banning a user again replaces the old ban.
 // @Tags Management
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token for authorization"
-// @Param requestKickUser body RequestKickUser true "Payload to ban user from group"
+// @Param banUserData body RequestBanUser true "User, group, an optional reason and an optional duration in days"
 // @Success 200 {object} ManagementSuccess "User successfully banned from group"
-// @Failure 400 {object} ManagementError "Invalid request body or user tries to ban themselves"
+// @Failure 400 {object} ManagementError "Invalid request body, user tries to ban themselves or the user is the owner or last admin"
 // @Failure 401 {object} ManagementError "Unauthorized user or insufficient permissions"
+// @Failure 403 {object} ManagementError "The member has permissions you don't have"
 // @Failure 500 {object} ManagementError "Internal server error"
-// @Router /management/user/ban [post]
+// @Router /management/user/ban [delete]
 func BanUserFromGroup(c *gin.Context, db *sql.DB) {
-	var kickUserData RequestKickUser
-	if err := c.ShouldBind(&kickUserData); err != nil {
+	var banUserData RequestBanUser
+	if err := c.ShouldBind(&banUserData); err != nil {
 		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
-	if jwtPayload.UserId == kickUserData.UserId {
+	if jwtPayload.UserId == banUserData.UserId {
 		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.YouCantKickOrBanYourselfError, "You can't kick/ban yourself. You need To leave the group")
 		return
 	}
 
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(kickUserData.GroupId, jwtPayload.UserId, roles.CanBanUsers, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
+	var expiresAt *time.Time
+	if banUserData.ExpiresInDays > 0 {
+		expirationDate := time.Now().AddDate(0, 0, banUserData.ExpiresInDays)
+		expiresAt = &expirationDate
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+
+	if !canActOnMember(c, banUserData.GroupId, banUserData.UserId, db) {
 		return
 	}
 
-	//TODO: either have a seperate function or a follow up, which adds the userId in a blacklist for this specific group
-	err = group.RemoveUserFromGroup(kickUserData.UserId, kickUserData.GroupId, db)
+	err := BanUserFromGroupInDB(banUserData.GroupId, banUserData.UserId, jwtPayload.UserId, strings.TrimSpace(banUserData.Reason), expiresAt, db)
 	if err != nil {
+		if respondWithRemoveMemberError(c, err) {
+			return
+		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	//TODO: send notification to kicked user
+	//TODO: send notification to banned user
 	//TODO: update userData for the frontend
-	c.JSON(http.StatusOK, ManagementSuccess{Message: "user successfully kicked"})
+	c.JSON(http.StatusOK, ManagementSuccess{Message: "user successfully banned"})
 }
 
 // UnbanUserFromGroup godoc
@@ -137,8 +130,9 @@ func BanUserFromGroup(c *gin.Context, db *sql.DB) {
 // @Success 200 {object} ManagementSuccess "User successfully unbanned from group"
 // @Failure 400 {object} ManagementError "Invalid request body"
 // @Failure 401 {object} ManagementError "Unauthorized user or insufficient permissions"
+// @Failure 404 {object} ManagementError "User is not banned from this group"
 // @Failure 500 {object} ManagementError "Internal server error"
-// @Router /management/user/unban [post]
+// @Router /management/user/unban [delete]
 func UnbanUserFromGroup(c *gin.Context, db *sql.DB) {
 	var kickUserData RequestKickUser
 	if err := c.ShouldBind(&kickUserData); err != nil {
@@ -146,32 +140,47 @@ func UnbanUserFromGroup(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(kickUserData.GroupId, jwtPayload.UserId, roles.CanUnbanUser, db)
+	err := UnBanUserFromGroupInDB(kickUserData.GroupId, kickUserData.UserId, db)
 	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+		if errors.Is(err, ErrBanNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserIsNotBannedError, "User is not banned from this group")
 			return
 		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+
+	c.JSON(http.StatusOK, ManagementSuccess{Message: "user successfully unbanned"})
+}
+
+// GetGroupBans godoc
+// @Summary List the bans of a group
+// @Description Returns the users that are currently banned from the group, with who banned them, why and until when. Expired bans are not listed.
+// @Tags Management
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} Ban "Current bans of the group"
+// @Failure 400 {object} ManagementError "Invalid group id"
+// @Failure 401 {object} ManagementError "Unauthorized user or insufficient permissions"
+// @Failure 500 {object} ManagementError "Internal server error"
+// @Router /management/user/bans [get]
+func GetGroupBans(c *gin.Context, db *sql.DB) {
+	var groupData RequestGroupId
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
 	}
 
-	err = UnBanUserFromGroupInDB(kickUserData.GroupId, kickUserData.UserId, db)
+	bans, err := GetActiveBansFromDB(groupData.GroupId, db)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	c.JSON(http.StatusOK, ManagementSuccess{Message: "user successfully unbanned"})
+	c.JSON(http.StatusOK, bans)
 }
 
 // AddRoleToUser godoc
@@ -194,31 +203,26 @@ func AddRoleToUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	role := roles.GetConstViaString(roleData.Role)
-	if role == "" {
-		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRoleError, "Invalid role")
-		return
-	}
-
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	action := "can_promote_to_" + role
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(roleData.GroupId, jwtPayload.UserId, action, db)
+	groupRole, err := GetGroupRoleByNameFromDB(roleData.GroupId, normalizeRoleName(roleData.Role), db)
 	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			c.JSON(http.StatusForbidden, ManagementError{Error: "Group does not exist"})
+		if errors.Is(err, ErrRoleNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRoleError, "Invalid role")
 			return
 		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
+	role := groupRole.Name
+
+	action := roles.PromotePermission(role)
+	if !group.CheckIfRequesterCanPerformAction(c, action) {
 		responses.GenericNotAllowedToPerformActionError(c.Writer)
 		return
 	}
+	if action == roles.CanManageRoles && !canGrantPermissions(c, groupRole.Permissions) {
+		return
+	}
 
 	inGroup, err := group.IsUserInGroup(roleData.GroupId, roleData.UserId, db)
 	if err != nil {
@@ -230,6 +234,27 @@ func AddRoleToUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if role == roles.AdminRole {
+		policies, err := group.GetGroupPoliciesFromDB(roleData.GroupId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if policies.RequireAdminTwoFactor {
+			twoFactorEnabled, err := user.IsTwoFactorEnabled(roleData.UserId, db)
+			if err != nil {
+				log.Println(err)
+				responses.GenericInternalServerError(c.Writer)
+				return
+			}
+			if !twoFactorEnabled {
+				responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorRequiredForAdminError, "This group requires admins to use two-factor authentication")
+				return
+			}
+		}
+	}
+
 	err = group.AddRoleToUserInGroup(roleData.GroupId, roleData.UserId, role, db)
 	if err != nil {
 		if errors.Is(err, group.ErrNothingHappened) {
@@ -252,7 +277,7 @@ func AddRoleToUser(c *gin.Context, db *sql.DB) {
 // @Param Authorization header string true "Bearer token"
 // @Param roleData body RequestRoleData true "Role data containing groupId, userId, and role"
 // @Success 200 {object} ManagementSuccess "Role successfully removed"
-// @Failure 400 {object} ManagementError "Error decoding request" or "Invalid role" or "User did not have this role"
+// @Failure 400 {object} ManagementError "Error decoding request" or "Invalid role" or "The group needs at least one admin"
 // @Failure 401 {object} ManagementError "Unauthorized" or "You are not allowed to perform this action"
 // @Failure 500 {object} ManagementError "Internal server error"
 // @Router management/roles/remove [delete]
@@ -263,43 +288,239 @@ func RemoveRoleFromUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	role := roles.GetConstViaString(roleData.Role)
-	if role == "" {
+	groupRole, err := GetGroupRoleByNameFromDB(roleData.GroupId, normalizeRoleName(roleData.Role), db)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRoleError, "Invalid role")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	role := groupRole.Name
+
+	if !group.CheckIfRequesterCanPerformAction(c, roles.DemotePermission(role)) {
+		responses.GenericNotAllowedToPerformActionError(c.Writer)
+		return
+	}
+
+	err = group.RemoveRoleFromUserInGroup(roleData.GroupId, roleData.UserId, role, db)
+	if err != nil {
+		if errors.Is(err, group.ErrNothingHappened) {
+			c.JSON(http.StatusOK, ManagementSuccess{Message: "Role successfully removed"})
+			return
+		}
+		if errors.Is(err, group.ErrLastAdmin) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.LastAdminError, "The group needs at least one admin, transfer the ownership first")
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ManagementError{Error: "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ManagementSuccess{Message: "Role successfully removed"})
+}
+
+// GetPermissions godoc
+// @Summary List the permissions a role can grant
+// @Description Returns every permission that can be part of a group role.
+// @Tags Roles
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} ResponsePermissions "All permissions"
+// @Failure 401 {object} ManagementError "Unauthorized"
+// @Router /management/roles/permissions [get]
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, ResponsePermissions{Permissions: roles.AllPermissions()})
+}
+
+// GetGroupRoles godoc
+// @Summary List the roles of a group
+// @Description Returns the default and custom roles of a group with their permissions. Every member can see them.
+// @Tags Roles
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} GroupRole "Roles of the group"
+// @Failure 400 {object} ManagementError "Invalid group id"
+// @Failure 401 {object} ManagementError "Unauthorized"
+// @Failure 404 {object} ManagementError "Group does not exist"
+// @Failure 500 {object} ManagementError "Internal server error"
+// @Router /management/roles [get]
+func GetGroupRoles(c *gin.Context, db *sql.DB) {
+	var groupData RequestGroupId
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	groupRoles, err := GetGroupRolesFromDB(groupData.GroupId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, groupRoles)
+}
+
+// CreateGroupRole godoc
+// @Summary Create a role in a group
+// @Description Creates a custom role with the given permissions. The requester needs the can_manage_roles permission and can only grant permissions they have themselves.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param roleData body RequestCreateGroupRole true "Group, name and permissions of the role"
+// @Success 201 {object} GroupRole "Role created"
+// @Failure 400 {object} ManagementError "Error decoding request" or "Unknown permission"
+// @Failure 401 {object} ManagementError "Unauthorized"
+// @Failure 403 {object} ManagementError "You are not allowed to perform this action" or "You can't grant a permission you don't have yourself"
+// @Failure 409 {object} ManagementError "The group already has a role with this name"
+// @Failure 500 {object} ManagementError "Internal server error"
+// @Router /management/roles [post]
+func CreateGroupRole(c *gin.Context, db *sql.DB) {
+	var roleData RequestCreateGroupRole
+	if err := c.ShouldBindJSON(&roleData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	name := normalizeRoleName(roleData.Name)
+	if name == "" {
 		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRoleError, "Invalid role")
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	permissions, ok := normalizePermissions(c, roleData.Permissions)
+	if !ok {
+		return
+	}
+
+	groupRole, err := CreateGroupRoleInDB(roleData.GroupId, name, permissions, db)
+	if err != nil {
+		if respondWithRoleError(c, err) {
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, groupRole)
+}
+
+// UpdateGroupRole godoc
+// @Summary Change a role of a group
+// @Description Renames a role and replaces its permissions, members keep the role. Default roles can't be renamed and the admin role can't be changed at all.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param roleData body RequestUpdateGroupRole true "Group, role, new name and new permissions"
+// @Success 200 {object} GroupRole "Role changed"
+// @Failure 400 {object} ManagementError "Error decoding request", "Unknown permission" or "Default roles can't be renamed"
+// @Failure 401 {object} ManagementError "Unauthorized"
+// @Failure 403 {object} ManagementError "You are not allowed to perform this action" or "You can't grant a permission you don't have yourself"
+// @Failure 404 {object} ManagementError "Role does not exist"
+// @Failure 409 {object} ManagementError "The group already has a role with this name"
+// @Failure 500 {object} ManagementError "Internal server error"
+// @Router /management/roles [put]
+func UpdateGroupRole(c *gin.Context, db *sql.DB) {
+	var roleData RequestUpdateGroupRole
+	if err := c.ShouldBindJSON(&roleData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	groupRole, err := GetGroupRoleFromDB(roleData.GroupId, roleData.RoleId, db)
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		if respondWithRoleError(c, err) {
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	action := "can_demote_from_" + role
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(roleData.GroupId, jwtPayload.UserId, action, db)
+	name := normalizeRoleName(roleData.Name)
+	if name == "" {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRoleError, "Invalid role")
+		return
+	}
+	if groupRole.Name == roles.AdminRole {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.DefaultRoleCanNotBeChangedError, "The admin role can't be changed")
+		return
+	}
+	if groupRole.IsDefault && name != groupRole.Name {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.DefaultRoleCanNotBeChangedError, "Default roles can't be renamed")
+		return
+	}
+
+	permissions, ok := normalizePermissions(c, roleData.Permissions)
+	if !ok {
+		return
+	}
+
+	groupRole, err = UpdateGroupRoleInDB(roleData.GroupId, roleData.RoleId, name, permissions, db)
 	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+		if respondWithRoleError(c, err) {
 			return
 		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, groupRole)
+}
+
+// DeleteGroupRole godoc
+// @Summary Delete a role of a group
+// @Description Deletes a custom role, every member loses it. Default roles can't be deleted.
+// @Tags Roles
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param groupId query string true "Group ID"
+// @Param roleId query string true "Role ID"
+// @Success 200 {object} ManagementSuccess "Role deleted"
+// @Failure 400 {object} ManagementError "Error decoding request" or "Default roles can't be deleted"
+// @Failure 401 {object} ManagementError "Unauthorized"
+// @Failure 403 {object} ManagementError "You are not allowed to perform this action"
+// @Failure 404 {object} ManagementError "Role does not exist"
+// @Failure 500 {object} ManagementError "Internal server error"
+// @Router /management/roles [delete]
+func DeleteGroupRole(c *gin.Context, db *sql.DB) {
+	var roleData RequestGroupRoleId
+	if err := c.ShouldBindQuery(&roleData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
 
+	groupRole, err := GetGroupRoleFromDB(roleData.GroupId, roleData.RoleId, db)
+	if err != nil {
+		if respondWithRoleError(c, err) {
+			return
+		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+	if groupRole.IsDefault {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.DefaultRoleCanNotBeChangedError, "Default roles can't be deleted")
 		return
 	}
 
-	err = group.RemoveRoleFromUserInGroup(roleData.GroupId, roleData.UserId, role, db)
+	err = DeleteGroupRoleInDB(roleData.GroupId, roleData.RoleId, db)
 	if err != nil {
-		if errors.Is(err, group.ErrNothingHappened) {
-			c.JSON(http.StatusOK, ManagementSuccess{Message: "Role successfully removed"})
+		if respondWithRoleError(c, err) {
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ManagementError{Error: "Internal server error"})
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	c.JSON(http.StatusOK, ManagementSuccess{Message: "Role successfully removed"})
+	c.JSON(http.StatusOK, ManagementSuccess{Message: "Role successfully deleted"})
 }
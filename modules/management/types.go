@@ -1,5 +1,7 @@
 package management
 
+import "time"
+
 type ManagementError struct {
 	Error string `json:"error"`
 }
@@ -12,8 +14,59 @@ type RequestKickUser struct {
 	UserId  string `json:"userId" binding:"required,uuid"`
 	GroupId string `json:"groupId" binding:"required,uuid"`
 }
+type RequestBanUser struct {
+	UserId        string `json:"userId" binding:"required,uuid"`
+	GroupId       string `json:"groupId" binding:"required,uuid"`
+	Reason        string `json:"reason" binding:"max=255"`
+	ExpiresInDays int    `json:"expiresInDays" binding:"omitempty,min=1,max=3650"` // permanent ban if empty
+}
+
+type Ban struct {
+	UserId           string     `json:"userId"`
+	Username         string     `json:"username"`
+	BannedBy         *string    `json:"bannedBy"`
+	BannedByUsername *string    `json:"bannedByUsername"`
+	Reason           *string    `json:"reason"`
+	BannedAt         time.Time  `json:"bannedAt"`
+	ExpiresAt        *time.Time `json:"expiresAt"`
+}
+
 type RequestRoleData struct {
 	UserId  string `json:"userId" binding:"required,uuid"`
 	GroupId string `json:"groupId" binding:"required,uuid"`
 	Role    string `json:"role" binding:"required"`
 }
+
+type GroupRole struct {
+	RoleId      string   `json:"roleId"`
+	GroupId     string   `json:"groupId"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	IsDefault   bool     `json:"isDefault"`
+}
+
+type RequestGroupId struct {
+	GroupId string `form:"groupId" binding:"required,uuid"`
+}
+
+type RequestCreateGroupRole struct {
+	GroupId     string   `json:"groupId" binding:"required,uuid"`
+	Name        string   `json:"name" binding:"required,max=20"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type RequestUpdateGroupRole struct {
+	GroupId     string   `json:"groupId" binding:"required,uuid"`
+	RoleId      string   `json:"roleId" binding:"required,uuid"`
+	Name        string   `json:"name" binding:"required,max=20"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type RequestGroupRoleId struct {
+	GroupId string `form:"groupId" binding:"required,uuid"`
+	RoleId  string `form:"roleId" binding:"required,uuid"`
+}
+
+type ResponsePermissions struct {
+	Permissions []string `json:"permissions"`
+}
@@ -2,62 +2,105 @@ package meal
 
 import (
 	"database/sql"
+	"enguete/modules/group"
+	"enguete/util/roles"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterMealRoute(router *gin.Engine, db *sql.DB) {
+func RegisterMealRoute(router *gin.RouterGroup, db *sql.DB) {
 	registerMealRoutes(router, db)
 	registerPreferenceRoutes(router, db)
 	registerMealUpdateRoutes(router, db)
+	registerSeriesRoutes(router, db)
+	registerTemplateRoutes(router, db)
 	registerSyncRoutes(router, db)
 }
 
-func registerMealRoutes(router *gin.Engine, db *sql.DB) {
-	router.GET("/meals", func(c *gin.Context) {
+func registerMealRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/meals", group.RequireMealMember(db, group.FromQuery("mealId")), func(c *gin.Context) {
 		GetMealById(c, db)
 	})
-	router.POST("/meals/", func(c *gin.Context) {
+	router.POST("/meals/", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
 		CreateNewMeal(c, db)
 	})
-	router.DELETE("/meals/:mealId", func(c *gin.Context) {
+	router.DELETE("/meals/:mealId", group.RequireMealPermission(db, group.FromQuery("mealId"), roles.CanDeleteMeal), func(c *gin.Context) {
 		DeleteMeal(c, db)
 	})
-	router.POST("/meals/open/", func(c *gin.Context) {
+	router.POST("/meals/open/", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanChangeMealFlags), func(c *gin.Context) {
 		ChangeMealClosedFlag(c, db)
 	})
-	router.POST("/meals/fulfilled", func(c *gin.Context) {
+	router.POST("/meals/fulfilled", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanChangeMealFlags), func(c *gin.Context) {
 		ChangeMealFulfilledFlag(c, db)
 	})
 
 }
 
-func registerPreferenceRoutes(router *gin.Engine, db *sql.DB) {
-	router.PUT("/meals/preferences", func(c *gin.Context) {
+func registerPreferenceRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.PUT("/meals/preferences", group.RequireMealMember(db, group.FromJSON("mealId")), func(c *gin.Context) {
 		UpdatePreference(c, db)
 	})
 }
 
-func registerMealUpdateRoutes(router *gin.Engine, db *sql.DB) {
+func registerMealUpdateRoutes(router *gin.RouterGroup, db *sql.DB) {
 
-	router.PUT("/meals/title", func(c *gin.Context) {
+	router.PUT("/meals/title", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
 		UpdateMealTitle(c, db)
 	})
-	router.PUT("/meals/type", func(c *gin.Context) {
+	router.PUT("/meals/type", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
 		UpdateMealType(c, db)
 	})
-	router.PUT("/meals/note", func(c *gin.Context) {
+	router.PUT("/meals/note", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
 		UpdateMealNotes(c, db)
 	})
-	router.PUT("/meals/scheduledAt", func(c *gin.Context) {
+	router.PUT("/meals/deadline", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
+		UpdatePreferenceDeadline(c, db)
+	})
+	router.PUT("/meals/capacity", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
+		UpdateMaxParticipants(c, db)
+	})
+	router.PUT("/meals/scheduledAt", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
 		UpdateMealScheduledAt(c, db)
 	})
 }
 
-func registerSyncRoutes(router *gin.Engine, db *sql.DB) {
-	router.GET("/sync/group/meals", func(c *gin.Context) {
+func registerSeriesRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/meals/series", group.RequireGroupMember(db, group.FromQuery("groupId")), func(c *gin.Context) {
+		GetGroupMealSeries(c, db)
+	})
+	router.POST("/meals/series", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
+		CreateMealSeries(c, db)
+	})
+	router.PUT("/meals/series", group.RequireMealPermission(db, group.FromJSON("mealId"), roles.CanUpdateMeal), func(c *gin.Context) {
+		UpdateMealSeries(c, db)
+	})
+	router.DELETE("/meals/series", group.RequireMealPermission(db, group.FromQuery("mealId"), roles.CanDeleteMeal), func(c *gin.Context) {
+		DeleteMealSeries(c, db)
+	})
+}
+
+func registerTemplateRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/meals/templates", group.RequireGroupMember(db, group.FromQuery("groupId")), func(c *gin.Context) {
+		GetGroupMealTemplates(c, db)
+	})
+	router.POST("/meals/templates", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
+		CreateMealTemplate(c, db)
+	})
+	router.PUT("/meals/templates", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
+		UpdateMealTemplate(c, db)
+	})
+	router.DELETE("/meals/templates", group.RequireGroupPermission(db, group.FromQuery("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
+		DeleteMealTemplate(c, db)
+	})
+	router.POST("/meals/copy-week", group.RequireGroupPermission(db, group.FromJSON("groupId"), roles.CanCreateMeal), func(c *gin.Context) {
+		CopyWeek(c, db)
+	})
+}
+
+func registerSyncRoutes(router *gin.RouterGroup, db *sql.DB) {
+	router.GET("/sync/group/meals", group.RequireGroupMember(db, group.FromQuery("groupId")), func(c *gin.Context) {
 		SyncGroupMeals(c, db)
 	})
-	router.GET("/sync/group/meal", func(c *gin.Context) {
+	router.GET("/sync/group/meal", group.RequireMealMember(db, group.FromQuery("mealId")), func(c *gin.Context) {
 		SyncMealInformation(c, db)
 	})
 }
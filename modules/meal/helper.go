@@ -1,20 +1,57 @@
 package meal
 
-import "sort"
+import (
+	"database/sql"
+	"enguete/modules/group"
+	"enguete/util/recurrence"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// seriesGenerationHorizon is how far ahead the occurrences of a series are created, so members can state their
+// preferences early.
+const seriesGenerationHorizon = time.Hour * 24 * 7 * 8
+
+// edit scopes of a series, starting from one occurrence
+const (
+	EditScopeThis      = "this"
+	EditScopeFollowing = "following"
+	EditScopeAll       = "all"
+)
+
+// preferences a member can have for a meal, the database only accepts these
+const (
+	PreferenceOptIn     = "opt-in"
+	PreferenceOptOut    = "opt-out"
+	PreferenceMaybe     = "maybe"
+	PreferenceUndecided = "undecided"
+)
+
+// preferenceOrder is the order of the participant list, members that eat come first.
+var preferenceOrder = map[string]int{
+	PreferenceOptIn:     0,
+	PreferenceMaybe:     1,
+	PreferenceOptOut:    2,
+	PreferenceUndecided: 3,
+}
 
 func MergeAndSortParticipants(withPreference, withoutPreference []MealPreferences) []MealPreferences {
 	allParticipants := append(withPreference, withoutPreference...)
 
 	sort.Slice(allParticipants, func(i, j int) bool {
-		if allParticipants[i].Preference == "undecided" && allParticipants[j].Preference != "undecided" {
-			return false
-		}
-		if allParticipants[j].Preference == "undecided" && allParticipants[i].Preference != "undecided" {
-			return true
+		if allParticipants[i].Preference != allParticipants[j].Preference {
+			return preferenceOrder[allParticipants[i].Preference] < preferenceOrder[allParticipants[j].Preference]
 		}
 
-		if allParticipants[i].Preference != allParticipants[j].Preference {
-			return allParticipants[i].Preference < allParticipants[j].Preference
+		// confirmed opt-ins first, then the waitlist in its order
+		positionI, positionJ := allParticipants[i].WaitlistPosition, allParticipants[j].WaitlistPosition
+		if (positionI == nil) != (positionJ == nil) {
+			return positionI == nil
+		}
+		if positionI != nil && *positionI != *positionJ {
+			return *positionI < *positionJ
 		}
 
 		return allParticipants[i].Username < allParticipants[j].Username
@@ -22,3 +59,153 @@ func MergeAndSortParticipants(withPreference, withoutPreference []MealPreference
 
 	return allParticipants
 }
+
+// rule returns the parsed rule and the start of the series in its time zone.
+func (s MealSeries) rule() (recurrence.Rule, time.Time, error) {
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return recurrence.Rule{}, time.Time{}, err
+	}
+	rule, err := recurrence.Parse(s.RRule, location)
+	return rule, s.StartsAt.In(location), err
+}
+
+func (s MealSeries) occurrencesBetween(from time.Time, to time.Time) ([]time.Time, error) {
+	rule, start, err := s.rule()
+	if err != nil {
+		return nil, err
+	}
+	return rule.Occurrences(start, from, to, s.Exceptions), nil
+}
+
+// splitAt returns the series ending before the occurrence and a new series starting with it. A COUNT is divided
+// between the two, so together they still have the same occurrences.
+func (s MealSeries) splitAt(occurrenceAt time.Time) (MealSeries, MealSeries, error) {
+	rule, start, err := s.rule()
+	if err != nil {
+		return s, s, err
+	}
+	occurrenceAt = occurrenceAt.In(start.Location())
+
+	beforeRule, afterRule := rule, rule
+	if rule.Count > 0 {
+		beforeRule.Count = len(rule.Occurrences(start, start, occurrenceAt, nil))
+		afterRule.Count = rule.Count - beforeRule.Count
+	} else {
+		beforeRule.Until = occurrenceAt.Add(-time.Second)
+	}
+
+	before := s
+	before.RRule = beforeRule.String()
+
+	after := s
+	after.SeriesId = ""
+	after.RRule = afterRule.String()
+	after.StartsAt = occurrenceAt
+	splitDate := occurrenceAt.Format(time.DateOnly)
+	after.Exceptions = slices.DeleteFunc(slices.Clone(s.Exceptions), func(exception string) bool {
+		return exception < splitDate
+	})
+	return before, after, nil
+}
+
+// applySeriesUpdate changes the fields of the series that are set in the request.
+func applySeriesUpdate(series MealSeries, update RequestUpdateMealSeries) (MealSeries, error) {
+	if update.Title != nil {
+		series.Title = *update.Title
+	}
+	if update.Type != nil {
+		series.MealType = *update.Type
+	}
+	if update.Notes != nil {
+		series.Notes = *update.Notes
+	}
+	if update.Time != nil {
+		location, err := time.LoadLocation(series.TimeZone)
+		if err != nil {
+			return series, err
+		}
+		clock, err := time.Parse("15:04", *update.Time)
+		if err != nil {
+			return series, err
+		}
+		start := series.StartsAt.In(location)
+		series.StartsAt = time.Date(start.Year(), start.Month(), start.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+	}
+	return series, nil
+}
+
+var ErrMealTimeMissing = errors.New("no time for the meal")
+
+// applyMealTemplate fills the fields the request leaves empty from the template.
+func applyMealTemplate(newMeal RequestNewMeal, template MealTemplate) RequestNewMeal {
+	if newMeal.Title == "" {
+		newMeal.Title = template.Title
+	}
+	if newMeal.Type == "" {
+		newMeal.Type = template.MealType
+	}
+	if newMeal.Notes == "" {
+		newMeal.Notes = template.Notes
+	}
+	return newMeal
+}
+
+// scheduledAtOfDate returns the time of a meal that was created with a date instead of a time. The default time of the
+// template is used first, then the default time of the meal type in the group settings.
+//
+// return ErrMealTimeMissing => neither has a default time
+func scheduledAtOfDate(date string, defaultTime *string, mealType string, settings group.GroupSettings) (string, error) {
+	location, err := settings.Location()
+	if err != nil {
+		return "", err
+	}
+
+	clock := settings.DefaultMealTimes[mealType]
+	if defaultTime != nil {
+		clock = *defaultTime
+	}
+	if clock == "" {
+		return "", ErrMealTimeMissing
+	}
+
+	scheduledAt, err := time.ParseInLocation(time.DateOnly+" 15:04", date+" "+clock, location)
+	if err != nil {
+		return "", err
+	}
+	return scheduledAt.Format(time.RFC3339), nil
+}
+
+// shiftDays moves the time by whole days in the location, so the clock time stays the same across daylight saving
+// time changes.
+func shiftDays(dateTime time.Time, days int, location *time.Location) time.Time {
+	dateTime = dateTime.In(location)
+	return time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day()+days, dateTime.Hour(), dateTime.Minute(), dateTime.Second(), 0, location)
+}
+
+// daysBetween counts the calendar days from one midnight to another, daylight saving time changes included.
+func daysBetween(from time.Time, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// uniqueIds sorts the ids and removes duplicates.
+func uniqueIds(ids []string) []string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// checkPreferenceDeadline returns ErrPreferenceDeadlinePassed once the deadline of the meal is reached. The scheduler
+// closes such meals only every minute, so the time is checked and not the closed flag.
+func checkPreferenceDeadline(mealId string, db *sql.DB) error {
+	deadline, err := GetPreferenceDeadlineFromDB(mealId, db)
+	if err != nil {
+		return err
+	}
+	if deadline != nil && !time.Now().Before(*deadline) {
+		return ErrPreferenceDeadlinePassed
+	}
+	return nil
+}
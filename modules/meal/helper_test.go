@@ -0,0 +1,120 @@
+package meal
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMealSeriesSplitAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("loading Europe/Berlin: %v", err)
+	}
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 18, 0, 0, 0, berlin)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, berlin)
+	to := time.Date(2027, 1, 1, 0, 0, 0, 0, berlin)
+
+	tests := []struct {
+		name                string
+		rrule               string
+		startsAt            time.Time
+		exceptions          []string
+		splitAt             time.Time
+		wantBeforeRRule     string
+		wantAfterRRule      string
+		wantAfterExceptions []string
+	}{
+		{
+			name:            "count is divided",
+			rrule:           "FREQ=DAILY;COUNT=5",
+			startsAt:        at(1, 1),
+			splitAt:         at(1, 3),
+			wantBeforeRRule: "FREQ=DAILY;COUNT=2",
+			wantAfterRRule:  "FREQ=DAILY;COUNT=3",
+		},
+		{
+			name:                "exceptions before the split still count",
+			rrule:               "FREQ=DAILY;COUNT=5",
+			startsAt:            at(1, 1),
+			exceptions:          []string{"2026-01-02", "2026-01-05"},
+			splitAt:             at(1, 4),
+			wantBeforeRRule:     "FREQ=DAILY;COUNT=3",
+			wantAfterRRule:      "FREQ=DAILY;COUNT=2",
+			wantAfterExceptions: []string{"2026-01-05"},
+		},
+		{
+			name:            "count of a weekly rule across the change to summer time",
+			rrule:           "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=6",
+			startsAt:        at(3, 16),
+			splitAt:         at(3, 30),
+			wantBeforeRRule: "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4",
+			wantAfterRRule:  "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=2",
+		},
+		{
+			name:                "without count the first series ends before the split",
+			rrule:               "FREQ=MONTHLY;BYMONTHDAY=-1",
+			startsAt:            at(1, 31),
+			exceptions:          []string{"2026-02-28", "2026-05-31"},
+			splitAt:             at(4, 30),
+			wantBeforeRRule:     "FREQ=MONTHLY;BYMONTHDAY=-1;UNTIL=20260430T155959Z",
+			wantAfterRRule:      "FREQ=MONTHLY;BYMONTHDAY=-1",
+			wantAfterExceptions: []string{"2026-05-31"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			series := MealSeries{
+				SeriesId:   "series",
+				RRule:      test.rrule,
+				StartsAt:   test.startsAt.UTC(),
+				TimeZone:   "Europe/Berlin",
+				Exceptions: test.exceptions,
+			}
+
+			before, after, err := series.splitAt(test.splitAt.UTC())
+			if err != nil {
+				t.Fatalf("splitAt() error = %v", err)
+			}
+			if before.RRule != test.wantBeforeRRule {
+				t.Errorf("before.RRule = %q, want %q", before.RRule, test.wantBeforeRRule)
+			}
+			if after.RRule != test.wantAfterRRule {
+				t.Errorf("after.RRule = %q, want %q", after.RRule, test.wantAfterRRule)
+			}
+			if before.SeriesId != series.SeriesId || after.SeriesId != "" {
+				t.Errorf("series ids = %q and %q, want %q and a new one", before.SeriesId, after.SeriesId, series.SeriesId)
+			}
+			if !after.StartsAt.Equal(test.splitAt) {
+				t.Errorf("after.StartsAt = %v, want %v", after.StartsAt, test.splitAt)
+			}
+			if !slices.Equal(after.Exceptions, test.wantAfterExceptions) {
+				t.Errorf("after.Exceptions = %v, want %v", after.Exceptions, test.wantAfterExceptions)
+			}
+
+			// together the two series have the same occurrences as the original one
+			want, err := series.occurrencesBetween(from, to)
+			if err != nil {
+				t.Fatalf("occurrencesBetween() error = %v", err)
+			}
+			beforeOccurrences, err := before.occurrencesBetween(from, to)
+			if err != nil {
+				t.Fatalf("before.occurrencesBetween() error = %v", err)
+			}
+			afterOccurrences, err := after.occurrencesBetween(from, to)
+			if err != nil {
+				t.Fatalf("after.occurrencesBetween() error = %v", err)
+			}
+			if len(beforeOccurrences) > 0 && !beforeOccurrences[len(beforeOccurrences)-1].Before(test.splitAt) {
+				t.Errorf("before ends with %v, which is not before the split", beforeOccurrences[len(beforeOccurrences)-1])
+			}
+			got := append(beforeOccurrences, afterOccurrences...)
+			if !slices.EqualFunc(got, want, time.Time.Equal) {
+				t.Errorf("occurrences after the split = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package meal
 import (
 	"database/sql"
 	"enguete/modules/group"
+	"enguete/util/waitlist"
 	"errors"
 	"github.com/lib/pq"
 	"time"
@@ -10,19 +11,60 @@ import (
 
 //General
 
-func CreateNewMealInDBWithTransaction(newMeal RequestNewMeal, userId string, db *sql.DB) (string, error) {
+// CreateNewMealInDB creates the meal and makes the cooks that are members of the group its cooks.
+func CreateNewMealInDB(newMeal RequestNewMeal, userId string, cookIds []string, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	mealId, err := CreateNewMealInDBWithTransaction(newMeal, userId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	err = addCooksToMealWithTransaction(mealId, newMeal.GroupId, cookIds, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return mealId, tx.Commit()
+}
+
+func CreateNewMealInDBWithTransaction(newMeal RequestNewMeal, userId string, tx *sql.Tx) (string, error) {
 	query := `INSERT INTO meals
-				(title, notes, date_time, meal_type, created_by, group_id)
+				(title, notes, date_time, meal_type, created_by, group_id, preference_deadline, preference_deadline_offset, max_participants)
 			VALUES
-				($1, $2, $3, $4, $5, $6)
+				($1, $2, $3, $4, $5, $6, NULLIF($7, '')::timestamptz, $8, $9)
 			RETURNING
 				meal_id`
-	row := db.QueryRow(query, newMeal.Title, newMeal.Notes, newMeal.ScheduledAt, newMeal.Type, userId, newMeal.GroupId)
+	row := tx.QueryRow(query, newMeal.Title, newMeal.Notes, newMeal.ScheduledAt, newMeal.Type, userId, newMeal.GroupId, newMeal.PreferenceDeadline, newMeal.DeadlineMinutesBefore, newMeal.MaxParticipants)
 	var mealId string
 	err := row.Scan(&mealId)
 	return mealId, err
 }
 
+// addCooksToMealWithTransaction skips users that are not members of the group anymore.
+func addCooksToMealWithTransaction(mealId string, groupId string, cookIds []string, tx *sql.Tx) error {
+	if len(cookIds) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO meal_preferences (meal_id, user_id, preference, is_cook)
+		SELECT $1, ug.user_id, 'undecided', TRUE
+		FROM user_groups ug
+		WHERE ug.group_id = $2
+		AND ug.user_id = ANY ($3::uuid[])
+		AND ug.deleted_at IS NULL
+		ON CONFLICT (meal_id, user_id) DO UPDATE
+		SET is_cook = TRUE
+	`
+	_, err := tx.Exec(query, mealId, groupId, pq.Array(cookIds))
+	return err
+}
+
 func DeleteMealInDB(mealId string, db *sql.DB) error {
 
 	tx, err := db.Begin()
@@ -30,17 +72,23 @@ func DeleteMealInDB(mealId string, db *sql.DB) error {
 		return err
 	}
 
+	err = deleteMealWithTransaction(mealId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteMealWithTransaction(mealId string, tx *sql.Tx) error {
 	updateMealQuery := `
 		UPDATE meals
 		SET deleted_at = NOW()
 		WHERE meal_id = $1 AND deleted_at IS NULL
 	`
-	_, err = tx.Exec(updateMealQuery, mealId)
+	_, err := tx.Exec(updateMealQuery, mealId)
 	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
 		return err
 	}
 
@@ -50,15 +98,7 @@ func DeleteMealInDB(mealId string, db *sql.DB) error {
 		WHERE meal_id = $1 AND deleted_at IS NULL
 	`
 	_, err = tx.Exec(updatePreferencesQuery, mealId)
-	if err != nil {
-		transactionErr := tx.Rollback()
-		if transactionErr != nil {
-			return transactionErr
-		}
-		return err
-	}
-
-	return nil
+	return err
 }
 
 var ErrNoData = errors.New("no data found")
@@ -74,15 +114,29 @@ func GetSingularMealInformation(mealId string, userId string, db *sql.DB) (MealI
             m.date_time,
             m.meal_type,
             m.notes,
-            COUNT(CASE WHEN mp.preference = 'opt-in' OR mp.preference = 'eat later' THEN 1 END) AS participant_count, --todo make it so its just for undecided preferences
+            COALESCE(SUM(CASE WHEN mp.preference = 'opt-in' AND mp.waitlisted_at IS NULL THEN 1 + mp.guest_count END), 0) AS participant_count,
+            COALESCE(SUM(CASE WHEN mp.preference = 'maybe' THEN 1 + mp.guest_count END), 0) AS maybe_count,
             COALESCE(user_pref.is_cook, FALSE) AS is_cook,
-            COALESCE(user_pref.preference, 'undecided') AS user_preference
+            COALESCE(user_pref.preference, 'undecided') AS user_preference,
+            m.series_id,
+            COALESCE(m.preference_deadline, m.date_time - make_interval(mins => m.preference_deadline_offset)) AS preference_deadline,
+            m.preference_deadline_offset,
+            COUNT(CASE WHEN mp.waitlisted_at IS NOT NULL THEN 1 END) AS waitlist_count,
+            m.max_participants,
+            CASE WHEN user_pref.waitlisted_at IS NOT NULL THEN (
+                SELECT COUNT(*)
+                FROM meal_preferences w
+                WHERE w.meal_id = m.meal_id
+                AND w.deleted_at IS NULL
+                AND w.waitlisted_at IS NOT NULL
+                AND (w.waitlisted_at, w.preference_id) <= (user_pref.waitlisted_at, user_pref.preference_id)
+            ) END AS user_waitlist_position
         FROM meals m
         LEFT JOIN meal_preferences mp ON mp.meal_id = m.meal_id AND mp.deleted_at IS NULL
         LEFT JOIN meal_preferences user_pref ON user_pref.meal_id = m.meal_id AND user_pref.user_id = $2 AND user_pref.deleted_at IS NULL
         WHERE m.meal_id = $1
         AND m.deleted_at IS NULL
-        GROUP BY m.meal_id, user_pref.preference, user_pref.is_cook, m.date_time
+        GROUP BY m.meal_id, user_pref.preference_id, user_pref.preference, user_pref.is_cook, user_pref.waitlisted_at, m.date_time
         ORDER BY m.date_time
 `
 	var mealInformation MealInformation
@@ -96,8 +150,15 @@ func GetSingularMealInformation(mealId string, userId string, db *sql.DB) (MealI
 		&mealInformation.MealType,
 		&mealInformation.Notes,
 		&mealInformation.ParticipantCount,
+		&mealInformation.MaybeCount,
 		&mealInformation.IsCook,
 		&mealInformation.UserPreference,
+		&mealInformation.SeriesId,
+		&mealInformation.PreferenceDeadline,
+		&mealInformation.DeadlineMinutesBefore,
+		&mealInformation.WaitlistCount,
+		&mealInformation.MaxParticipants,
+		&mealInformation.UserWaitlistPosition,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -118,7 +179,17 @@ func GetMealParticipationInformationFromDB(mealId string, db *sql.DB) ([]MealPre
 				mp.preference_id,
 				u.username,
 				mp.preference AS preference,
-				mp.is_cook AS is_cook
+				mp.is_cook AS is_cook,
+				mp.guest_count,
+				mp.comment,
+				CASE WHEN mp.waitlisted_at IS NOT NULL THEN (
+					SELECT COUNT(*)
+					FROM meal_preferences w
+					WHERE w.meal_id = mp.meal_id
+					AND w.deleted_at IS NULL
+					AND w.waitlisted_at IS NOT NULL
+					AND (w.waitlisted_at, w.preference_id) <= (mp.waitlisted_at, mp.preference_id)
+				) END AS waitlist_position
 	
 			FROM users u
 			INNER JOIN meal_preferences mp ON u.user_id = mp.user_id AND mp.meal_id = $1
@@ -151,6 +222,9 @@ func GetMealParticipationInformationFromDB(mealId string, db *sql.DB) ([]MealPre
 			&mealParticipant.Username,
 			&mealParticipant.Preference,
 			&mealParticipant.IsCook,
+			&mealParticipant.GuestCount,
+			&mealParticipant.Comment,
+			&mealParticipant.WaitlistPosition,
 		)
 		if err != nil {
 			return mealParticipants, err
@@ -246,8 +320,23 @@ var ErrUserAlreadyHasAPreferenceInSpecificMeal = errors.New("user already has A
 
 // Flags
 
+// UpdateClosedBoolInDB opens or closes the meal. Opening a meal whose preference deadline has passed removes the
+// deadline, otherwise preferences would still be refused and the scheduler would close the meal again.
 func UpdateClosedBoolInDB(mealId string, isClosed bool, db *sql.DB) error {
-	query := `UPDATE meals SET closed=$1 WHERE meal_id=$2 AND deleted_at IS NULL RETURNING closed` // TODO Swap the closed bool from what it currently is
+	query := `
+		UPDATE meals m
+		SET closed = $1,
+			preference_deadline = CASE WHEN d.reopened_after_deadline THEN NULL ELSE m.preference_deadline END,
+			preference_deadline_offset = CASE WHEN d.reopened_after_deadline THEN NULL ELSE m.preference_deadline_offset END,
+			auto_closed_at = CASE WHEN d.reopened_after_deadline THEN NULL ELSE m.auto_closed_at END
+		FROM (
+			SELECT meal_id, NOT $1::boolean
+				AND COALESCE(preference_deadline, date_time - make_interval(mins => preference_deadline_offset)) <= NOW() AS reopened_after_deadline
+			FROM meals
+			WHERE meal_id = $2
+		) d
+		WHERE m.meal_id = d.meal_id AND m.deleted_at IS NULL
+		RETURNING m.closed` // TODO Swap the closed bool from what it currently is
 
 	//TODO: delete all preference that are 'undecided' when opening a meal also set all current members to 'undecided' when closing a meal and store in the db for future reference
 
@@ -263,21 +352,124 @@ func UpdateMealFulfilledStatus(mealId string, isFulfilled bool, db *sql.DB) erro
 	return err
 }
 
+// Preference deadlines
+
+var ErrPreferenceDeadlinePassed = errors.New("preference deadline has passed")
+
+// GetPreferenceDeadlineFromDB returns nil when the meal has no deadline.
+func GetPreferenceDeadlineFromDB(mealId string, db *sql.DB) (*time.Time, error) {
+	query := `
+		SELECT COALESCE(preference_deadline, date_time - make_interval(mins => preference_deadline_offset))
+		FROM meals
+		WHERE meal_id = $1 AND deleted_at IS NULL
+	`
+	var deadline *time.Time
+	err := db.QueryRow(query, mealId).Scan(&deadline)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoData
+	}
+	return deadline, err
+}
+
+// UpdatePreferenceDeadlineInDB sets either an absolute deadline or one in minutes before the meal, without both the
+// deadline is removed. A meal that was closed by its old deadline opens again, the scheduler closes it again if the
+// new deadline has passed as well.
+func UpdatePreferenceDeadlineInDB(mealId string, deadline string, minutesBefore *int, db *sql.DB) error {
+	query := `
+		UPDATE meals
+		SET preference_deadline = NULLIF($2, '')::timestamptz,
+			preference_deadline_offset = $3,
+			closed = CASE WHEN auto_closed_at IS NOT NULL THEN FALSE ELSE closed END,
+			auto_closed_at = NULL,
+			updated_at = NOW()
+		WHERE meal_id = $1 AND deleted_at IS NULL
+	`
+	result, err := db.Exec(query, mealId, deadline, minutesBefore)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDataCouldNotBeUpdated
+	}
+	return nil
+}
+
+// CloseMealsAfterDeadlineInDB closes the open meals whose deadline has passed. Meals that were closed by their deadline
+// before and opened again by hand stay open.
+func CloseMealsAfterDeadlineInDB(db *sql.DB) error {
+	query := `
+		UPDATE meals
+		SET closed = TRUE, auto_closed_at = NOW()
+		WHERE closed = FALSE
+		AND auto_closed_at IS NULL
+		AND deleted_at IS NULL
+		AND (preference_deadline IS NOT NULL OR preference_deadline_offset IS NOT NULL)
+		AND COALESCE(preference_deadline, date_time - make_interval(mins => preference_deadline_offset)) <= NOW()
+	`
+	_, err := db.Exec(query)
+	return err
+}
+
 //OptIn Status
 
-func ChangeOptInStatusMealInDB(userId string, mealId string, preference string, db *sql.DB) error {
+// ChangeOptInStatusMealInDB changes the fields that are not nil. A new preference starts as undecided without guests
+// and comment, guests are only kept for opt-in and maybe.
+func ChangeOptInStatusMealInDB(userId string, mealId string, preference *string, guestCount *int, comment *string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = changeOptInStatusWithTransaction(userId, mealId, preference, guestCount, comment, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changeOptInStatusWithTransaction puts a new opt-in at the end of the waitlist and lets the promotion confirm it if it
+// fits. Confirmed participants and waiting ones keep their place.
+func changeOptInStatusWithTransaction(userId string, mealId string, preference *string, guestCount *int, comment *string, tx *sql.Tx) error {
+	maxParticipants, err := lockMealCapacityWithTransaction(mealId, tx)
+	if err != nil {
+		return err
+	}
+
 	query := `
-        INSERT INTO meal_preferences (meal_id, user_id, preference, updated_at)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO meal_preferences (meal_id, user_id, preference, guest_count, comment, waitlisted_at, updated_at)
+        VALUES (
+            $1, $2, COALESCE($3::varchar, 'undecided'),
+            CASE WHEN $3::varchar IN ('opt-in', 'maybe') THEN COALESCE($4::smallint, 0) ELSE 0 END,
+            COALESCE($5::varchar, ''),
+            CASE WHEN $3::varchar = 'opt-in' THEN clock_timestamp() END,
+            $6
+        )
         ON CONFLICT (meal_id, user_id)
         DO UPDATE
-        SET preference = EXCLUDED.preference,
-            updated_at = EXCLUDED.updated_at;`
-
-	_, err := db.Exec(query, mealId, userId, preference, time.Now())
+        SET preference = COALESCE($3::varchar, meal_preferences.preference),
+            guest_count = CASE
+                WHEN COALESCE($3::varchar, meal_preferences.preference) IN ('opt-in', 'maybe')
+                THEN COALESCE($4::smallint, meal_preferences.guest_count)
+                ELSE 0
+            END,
+            comment = COALESCE($5::varchar, meal_preferences.comment),
+            waitlisted_at = CASE
+                WHEN COALESCE($3::varchar, meal_preferences.preference) != 'opt-in' THEN NULL
+                WHEN meal_preferences.preference = 'opt-in' THEN meal_preferences.waitlisted_at
+                ELSE clock_timestamp()
+            END,
+            updated_at = EXCLUDED.updated_at
+        RETURNING preference = 'opt-in' AND waitlisted_at IS NULL;`
 
+	var isConfirmed bool
+	err = tx.QueryRow(query, mealId, userId, preference, guestCount, comment, time.Now()).Scan(&isConfirmed)
 	if err != nil {
-
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrUserAlreadyHasAPreferenceInSpecificMeal
@@ -285,7 +477,74 @@ func ChangeOptInStatusMealInDB(userId string, mealId string, preference string,
 		return err
 	}
 
-	return nil
+	// a confirmed participant that brings more guests keeps the seat, but only if the guests fit as well
+	if isConfirmed && maxParticipants != nil {
+		seats, err := waitlist.CountConfirmedSeatsWithTransaction(mealId, tx)
+		if err != nil {
+			return err
+		}
+		if seats > *maxParticipants {
+			return ErrNotEnoughSeats
+		}
+	}
+
+	return waitlist.PromoteWithTransaction(mealId, maxParticipants, tx)
+}
+
+// Capacity
+
+var ErrNotEnoughSeats = errors.New("not enough free seats in the meal")
+var ErrCapacityBelowConfirmed = errors.New("more participants are confirmed than the limit allows")
+
+// UpdateMaxParticipantsInDB sets the limit of the meal, nil removes it. A limit below the confirmed participants is
+// refused, so nobody loses a seat they already have. Raising the limit promotes from the waitlist.
+func UpdateMaxParticipantsInDB(mealId string, maxParticipants *int, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = updateMaxParticipantsWithTransaction(mealId, maxParticipants, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateMaxParticipantsWithTransaction(mealId string, maxParticipants *int, tx *sql.Tx) error {
+	_, err := lockMealCapacityWithTransaction(mealId, tx)
+	if err != nil {
+		return err
+	}
+
+	if maxParticipants != nil {
+		seats, err := waitlist.CountConfirmedSeatsWithTransaction(mealId, tx)
+		if err != nil {
+			return err
+		}
+		if seats > *maxParticipants {
+			return ErrCapacityBelowConfirmed
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE meals SET max_participants = $2, updated_at = NOW() WHERE meal_id = $1`, mealId, maxParticipants)
+	if err != nil {
+		return err
+	}
+
+	return waitlist.PromoteWithTransaction(mealId, maxParticipants, tx)
+}
+
+// lockMealCapacityWithTransaction locks the meal, so changes to its participants happen one after another, and returns
+// its limit.
+func lockMealCapacityWithTransaction(mealId string, tx *sql.Tx) (*int, error) {
+	maxParticipants, err := waitlist.LockMealWithTransaction(mealId, tx)
+	if errors.Is(err, waitlist.ErrMealNotFound) {
+		return nil, ErrNoData
+	}
+	return maxParticipants, err
 }
 
 // Meal Cook Status
@@ -380,16 +639,29 @@ func GetAllMealsInGroupInTimeframe(groupId string, userId string, startDate stri
             m.date_time,
             m.meal_type,
             m.notes,
-    		SUM(CASE WHEN mp.preference != 'undecided' THEN 1 ELSE 0 END) AS participant_count,
+            COALESCE(SUM(CASE WHEN mp.preference = 'opt-in' AND mp.waitlisted_at IS NULL THEN 1 + mp.guest_count END), 0) AS participant_count,
+            COALESCE(SUM(CASE WHEN mp.preference = 'maybe' THEN 1 + mp.guest_count END), 0) AS maybe_count,
             COALESCE(user_pref.preference, 'undecided') AS user_preference,
-            COALESCE(user_pref.is_cook, FALSE) AS is_cook
+            COALESCE(user_pref.is_cook, FALSE) AS is_cook,
+            m.series_id,
+            COALESCE(m.preference_deadline, m.date_time - make_interval(mins => m.preference_deadline_offset)) AS preference_deadline,
+            COUNT(CASE WHEN mp.waitlisted_at IS NOT NULL THEN 1 END) AS waitlist_count,
+            m.max_participants,
+            CASE WHEN user_pref.waitlisted_at IS NOT NULL THEN (
+                SELECT COUNT(*)
+                FROM meal_preferences w
+                WHERE w.meal_id = m.meal_id
+                AND w.deleted_at IS NULL
+                AND w.waitlisted_at IS NOT NULL
+                AND (w.waitlisted_at, w.preference_id) <= (user_pref.waitlisted_at, user_pref.preference_id)
+            ) END AS user_waitlist_position
         FROM meals m
         LEFT JOIN meal_preferences mp ON mp.meal_id = m.meal_id AND mp.deleted_at IS NULL
         LEFT JOIN meal_preferences user_pref ON user_pref.meal_id = m.meal_id AND user_pref.user_id = $2 AND user_pref.deleted_at IS NULL
         WHERE m.group_id = $1
     	AND m.deleted_at IS NULL
         AND (m.date_time BETWEEN $3 AND $4)
-		GROUP BY m.meal_id, user_pref.preference, user_pref.is_cook, m.date_time
+		GROUP BY m.meal_id, user_pref.preference_id, user_pref.preference, user_pref.is_cook, user_pref.waitlisted_at, m.date_time
         ORDER BY m.date_time desc 
 `
 	rows, err := db.Query(query, groupId, userId, startDate, endDate)
@@ -415,8 +687,14 @@ func GetAllMealsInGroupInTimeframe(groupId string, userId string, startDate stri
 			&mealCard.MealType,
 			&mealCard.Notes,
 			&mealCard.ParticipantCount,
+			&mealCard.MaybeCount,
 			&mealCard.UserPreference,
 			&mealCard.IsCook,
+			&mealCard.SeriesId,
+			&mealCard.PreferenceDeadline,
+			&mealCard.WaitlistCount,
+			&mealCard.MaxParticipants,
+			&mealCard.UserWaitlistPosition,
 		)
 		if err != nil {
 			return mealCards, err
@@ -459,3 +737,653 @@ func GetDeletedMealsInTimeframe(groupId string, startDate string, endDate string
 
 	return deletedIds, nil
 }
+
+// Series
+
+var ErrMealIsNotAnOccurrence = errors.New("meal is not an occurrence of a series")
+var ErrSeriesNotFound = errors.New("meal series not found")
+
+const mealSeriesColumns = `
+		s.series_id, s.group_id, s.title, s.meal_type, COALESCE(s.notes, ''), s.rrule, s.starts_at, s.time_zone,
+		s.exceptions, s.generated_until, s.created_by`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMealSeries(row rowScanner, extra ...any) (MealSeries, error) {
+	var series MealSeries
+	var exceptions pq.StringArray
+	dest := []any{&series.SeriesId, &series.GroupId, &series.Title, &series.MealType, &series.Notes, &series.RRule,
+		&series.StartsAt, &series.TimeZone, &exceptions, &series.GeneratedUntil, &series.CreatedBy}
+	err := row.Scan(append(dest, extra...)...)
+	series.Exceptions = exceptions
+	if series.Exceptions == nil {
+		series.Exceptions = []string{}
+	}
+	return series, err
+}
+
+// CreateMealSeriesInDB stores the series and creates its occurrences up to the generation horizon.
+func CreateMealSeriesInDB(series MealSeries, db *sql.DB) (string, []string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+
+	seriesId, err := createMealSeriesWithTransaction(series, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", nil, err
+	}
+
+	mealIds, err := generateOccurrencesWithTransaction(seriesId, time.Now().Add(seriesGenerationHorizon), tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", nil, err
+	}
+
+	return seriesId, mealIds, tx.Commit()
+}
+
+// createMealSeriesWithTransaction doesn't create occurrences, the generation starts at GeneratedUntil.
+func createMealSeriesWithTransaction(series MealSeries, tx *sql.Tx) (string, error) {
+	query := `
+		INSERT INTO meal_series (group_id, title, meal_type, notes, rrule, starts_at, time_zone, exceptions, generated_until, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING series_id
+	`
+	var seriesId string
+	err := tx.QueryRow(query, series.GroupId, series.Title, series.MealType, series.Notes, series.RRule, series.StartsAt,
+		series.TimeZone, pq.Array(series.Exceptions), series.GeneratedUntil, series.CreatedBy).Scan(&seriesId)
+	return seriesId, err
+}
+
+func GetMealSeriesOfGroupFromDB(groupId string, db *sql.DB) ([]MealSeries, error) {
+	query := `
+		SELECT` + mealSeriesColumns + `
+		FROM meal_series s
+		WHERE s.group_id = $1
+		AND s.deleted_at IS NULL
+		ORDER BY s.starts_at
+	`
+	rows, err := db.Query(query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allSeries := []MealSeries{}
+	for rows.Next() {
+		series, err := scanMealSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		allSeries = append(allSeries, series)
+	}
+	return allSeries, rows.Err()
+}
+
+// lockSeriesOfMealWithTransaction returns the series of the occurrence and the time the series planned it at. The
+// series stays locked until the end of the transaction, so the generation can't run at the same time.
+//
+// return ErrMealIsNotAnOccurrence => the meal doesn't exist or doesn't belong to a series
+func lockSeriesOfMealWithTransaction(mealId string, tx *sql.Tx) (MealSeries, time.Time, error) {
+	query := `
+		SELECT` + mealSeriesColumns + `, m.occurrence_at
+		FROM meals m
+		INNER JOIN meal_series s ON s.series_id = m.series_id
+		WHERE m.meal_id = $1
+		AND m.deleted_at IS NULL
+		AND s.deleted_at IS NULL
+		FOR UPDATE OF s
+	`
+	var occurrenceAt time.Time
+	series, err := scanMealSeries(tx.QueryRow(query, mealId), &occurrenceAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return series, occurrenceAt, ErrMealIsNotAnOccurrence
+	}
+	return series, occurrenceAt, err
+}
+
+// generateOccurrencesWithTransaction creates the occurrences between GeneratedUntil of the series and until. Existing
+// occurrences, also deleted ones, are skipped.
+func generateOccurrencesWithTransaction(seriesId string, until time.Time, tx *sql.Tx) ([]string, error) {
+	query := `
+		SELECT` + mealSeriesColumns + `
+		FROM meal_series s
+		WHERE s.series_id = $1
+		AND s.deleted_at IS NULL
+		FOR UPDATE
+	`
+	series, err := scanMealSeries(tx.QueryRow(query, seriesId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSeriesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !series.GeneratedUntil.Before(until) {
+		return []string{}, nil
+	}
+
+	occurrences, err := series.occurrencesBetween(series.GeneratedUntil, until)
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery := `
+		INSERT INTO meals (title, notes, date_time, meal_type, created_by, group_id, series_id, occurrence_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $3)
+		ON CONFLICT (series_id, occurrence_at) WHERE series_id IS NOT NULL DO NOTHING
+		RETURNING meal_id
+	`
+	mealIds := []string{}
+	for _, occurrence := range occurrences {
+		var mealId string
+		err := tx.QueryRow(insertQuery, series.Title, series.Notes, occurrence, series.MealType, series.CreatedBy, series.GroupId, series.SeriesId).Scan(&mealId)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mealIds = append(mealIds, mealId)
+	}
+
+	_, err = tx.Exec(`UPDATE meal_series SET generated_until = $2 WHERE series_id = $1`, series.SeriesId, until)
+	if err != nil {
+		return nil, err
+	}
+	return mealIds, nil
+}
+
+// GenerateSeriesOccurrencesInDB creates the occurrences of every series up to the generation horizon. A failing series
+// doesn't stop the others.
+func GenerateSeriesOccurrencesInDB(db *sql.DB) error {
+	until := time.Now().Add(seriesGenerationHorizon)
+
+	query := `
+		SELECT series_id
+		FROM meal_series
+		WHERE deleted_at IS NULL
+		AND generated_until < $1
+	`
+	rows, err := db.Query(query, until)
+	if err != nil {
+		return err
+	}
+	var seriesIds []string
+	for rows.Next() {
+		var seriesId string
+		if err := rows.Scan(&seriesId); err != nil {
+			rows.Close()
+			return err
+		}
+		seriesIds = append(seriesIds, seriesId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, seriesId := range seriesIds {
+		errs = append(errs, generateOccurrencesOfSeriesInDB(seriesId, until, db))
+	}
+	return errors.Join(errs...)
+}
+
+func generateOccurrencesOfSeriesInDB(seriesId string, until time.Time, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = generateOccurrencesWithTransaction(seriesId, until, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, ErrSeriesNotFound) {
+			return nil // deleted in the meantime
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateMealSeriesInDB applies the changes to the occurrence, to it and the later occurrences, or to all upcoming
+// occurrences of its series, depending on the scope. For the later occurrences the series is split in two, so the
+// earlier ones keep their values.
+//
+// return ErrMealIsNotAnOccurrence => the meal doesn't exist or doesn't belong to a series
+func UpdateMealSeriesInDB(update RequestUpdateMealSeries, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = updateMealSeriesWithTransaction(update, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateMealSeriesWithTransaction(update RequestUpdateMealSeries, tx *sql.Tx) error {
+	series, occurrenceAt, err := lockSeriesOfMealWithTransaction(update.MealId, tx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case update.Scope == EditScopeThis:
+		query := `
+			UPDATE meals
+			SET title = COALESCE($2, title),
+			    meal_type = COALESCE($3, meal_type),
+			    notes = COALESCE($4, notes),
+			    date_time = CASE WHEN $5::time IS NULL THEN date_time ELSE ((date_time AT TIME ZONE $6)::date + $5::time) AT TIME ZONE $6 END
+			WHERE meal_id = $1
+			AND deleted_at IS NULL
+		`
+		_, err = tx.Exec(query, update.MealId, update.Title, update.Type, update.Notes, update.Time, series.TimeZone)
+		return err
+
+	case update.Scope == EditScopeAll || occurrenceAt.Equal(series.StartsAt):
+		query := `
+			UPDATE meal_series
+			SET title = COALESCE($2, title),
+			    meal_type = COALESCE($3, meal_type),
+			    notes = COALESCE($4, notes),
+			    starts_at = CASE WHEN $5::time IS NULL THEN starts_at ELSE ((starts_at AT TIME ZONE $6)::date + $5::time) AT TIME ZONE $6 END
+			WHERE series_id = $1
+		`
+		_, err = tx.Exec(query, series.SeriesId, update.Title, update.Type, update.Notes, update.Time, series.TimeZone)
+		if err != nil {
+			return err
+		}
+
+		from := occurrenceAt
+		if update.Scope == EditScopeAll {
+			from = time.Now()
+		}
+		return updateOccurrencesFromWithTransaction(series.SeriesId, from, series.SeriesId, update, series.TimeZone, tx)
+
+	default:
+		before, after, err := series.splitAt(occurrenceAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE meal_series SET rrule = $2 WHERE series_id = $1`, series.SeriesId, before.RRule)
+		if err != nil {
+			return err
+		}
+
+		after, err = applySeriesUpdate(after, update)
+		if err != nil {
+			return err
+		}
+		newSeriesId, err := createMealSeriesWithTransaction(after, tx)
+		if err != nil {
+			return err
+		}
+		return updateOccurrencesFromWithTransaction(series.SeriesId, occurrenceAt, newSeriesId, update, series.TimeZone, tx)
+	}
+}
+
+// updateOccurrencesFromWithTransaction changes the occurrences of the series from the time on and moves them to
+// targetSeriesId. Deleted occurrences are moved as well, so they are not created again by the target series.
+func updateOccurrencesFromWithTransaction(seriesId string, from time.Time, targetSeriesId string, update RequestUpdateMealSeries, timeZone string, tx *sql.Tx) error {
+	query := `
+		UPDATE meals
+		SET series_id = $3,
+		    title = COALESCE($4, title),
+		    meal_type = COALESCE($5, meal_type),
+		    notes = COALESCE($6, notes),
+		    date_time = CASE WHEN $7::time IS NULL THEN date_time ELSE ((date_time AT TIME ZONE $8)::date + $7::time) AT TIME ZONE $8 END,
+		    occurrence_at = CASE WHEN $7::time IS NULL THEN occurrence_at ELSE ((occurrence_at AT TIME ZONE $8)::date + $7::time) AT TIME ZONE $8 END
+		WHERE series_id = $1
+		AND occurrence_at >= $2
+	`
+	_, err := tx.Exec(query, seriesId, from, targetSeriesId, update.Title, update.Type, update.Notes, update.Time, timeZone)
+	return err
+}
+
+// DeleteMealSeriesInDB cancels the occurrence, it and the later occurrences, or all upcoming occurrences and the series,
+// depending on the scope. Preferences of the cancelled occurrences are deleted with them.
+//
+// return ErrMealIsNotAnOccurrence => the meal doesn't exist or doesn't belong to a series
+func DeleteMealSeriesInDB(mealId string, scope string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = deleteMealSeriesWithTransaction(mealId, scope, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteMealSeriesWithTransaction(mealId string, scope string, tx *sql.Tx) error {
+	series, occurrenceAt, err := lockSeriesOfMealWithTransaction(mealId, tx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case scope == EditScopeThis:
+		exceptionQuery := `
+			UPDATE meal_series
+			SET exceptions = ARRAY_APPEND(exceptions, ($2::timestamptz AT TIME ZONE time_zone)::date)
+			WHERE series_id = $1
+			AND NOT (($2::timestamptz AT TIME ZONE time_zone)::date = ANY (exceptions))
+		`
+		_, err = tx.Exec(exceptionQuery, series.SeriesId, occurrenceAt)
+		if err != nil {
+			return err
+		}
+		return deleteMealWithTransaction(mealId, tx)
+
+	case scope == EditScopeAll || occurrenceAt.Equal(series.StartsAt):
+		_, err = tx.Exec(`UPDATE meal_series SET deleted_at = NOW() WHERE series_id = $1`, series.SeriesId)
+		if err != nil {
+			return err
+		}
+
+		from := occurrenceAt
+		if scope == EditScopeAll {
+			from = time.Now()
+		}
+		return deleteOccurrencesFromWithTransaction(series.SeriesId, from, tx)
+
+	default:
+		before, _, err := series.splitAt(occurrenceAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE meal_series SET rrule = $2 WHERE series_id = $1`, series.SeriesId, before.RRule)
+		if err != nil {
+			return err
+		}
+		return deleteOccurrencesFromWithTransaction(series.SeriesId, occurrenceAt, tx)
+	}
+}
+
+func deleteOccurrencesFromWithTransaction(seriesId string, from time.Time, tx *sql.Tx) error {
+	preferencesQuery := `
+		UPDATE meal_preferences
+		SET deleted_at = NOW()
+		WHERE deleted_at IS NULL
+		AND meal_id IN (SELECT meal_id FROM meals WHERE series_id = $1 AND occurrence_at >= $2 AND deleted_at IS NULL)
+	`
+	_, err := tx.Exec(preferencesQuery, seriesId, from)
+	if err != nil {
+		return err
+	}
+
+	mealsQuery := `
+		UPDATE meals
+		SET deleted_at = NOW()
+		WHERE series_id = $1
+		AND occurrence_at >= $2
+		AND deleted_at IS NULL
+	`
+	_, err = tx.Exec(mealsQuery, seriesId, from)
+	return err
+}
+
+// Templates
+
+var ErrTemplateNotFound = errors.New("meal template not found")
+var ErrCookIsNotMember = errors.New("cook is not a member of the group")
+
+const mealTemplateQuery = `
+		SELECT t.template_id, t.group_id, t.title, t.meal_type, t.notes, TO_CHAR(t.default_time, 'HH24:MI'),
+		       COALESCE(ARRAY_AGG(tc.user_id) FILTER (WHERE tc.user_id IS NOT NULL), '{}')
+		FROM meal_templates t
+		LEFT JOIN meal_template_cooks tc ON tc.template_id = t.template_id
+		WHERE t.group_id = $1`
+
+func scanMealTemplate(row rowScanner) (MealTemplate, error) {
+	var template MealTemplate
+	var cookIds pq.StringArray
+	err := row.Scan(&template.TemplateId, &template.GroupId, &template.Title, &template.MealType, &template.Notes, &template.DefaultTime, &cookIds)
+	template.CookIds = cookIds
+	return template, err
+}
+
+func GetMealTemplatesOfGroupFromDB(groupId string, db *sql.DB) ([]MealTemplate, error) {
+	rows, err := db.Query(mealTemplateQuery+`
+		GROUP BY t.template_id
+		ORDER BY t.title
+	`, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []MealTemplate{}
+	for rows.Next() {
+		template, err := scanMealTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetMealTemplateFromDB returns ErrTemplateNotFound if the group has no template with this id.
+func GetMealTemplateFromDB(groupId string, templateId string, db *sql.DB) (MealTemplate, error) {
+	row := db.QueryRow(mealTemplateQuery+`
+		AND t.template_id = $2
+		GROUP BY t.template_id
+	`, groupId, templateId)
+	template, err := scanMealTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return template, ErrTemplateNotFound
+	}
+	return template, err
+}
+
+// CreateMealTemplateInDB returns ErrCookIsNotMember if one of the cooks is not a member of the group.
+func CreateMealTemplateInDB(template RequestMealTemplate, userId string, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	templateId, err := createMealTemplateWithTransaction(template, userId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return templateId, tx.Commit()
+}
+
+func createMealTemplateWithTransaction(template RequestMealTemplate, userId string, tx *sql.Tx) (string, error) {
+	query := `
+		INSERT INTO meal_templates (group_id, title, meal_type, notes, default_time, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING template_id
+	`
+	var templateId string
+	err := tx.QueryRow(query, template.GroupId, template.Title, template.Type, template.Notes, template.DefaultTime, userId).Scan(&templateId)
+	if err != nil {
+		return "", err
+	}
+	return templateId, replaceTemplateCooksWithTransaction(templateId, template.GroupId, template.CookIds, tx)
+}
+
+// UpdateMealTemplateInDB returns ErrTemplateNotFound if the group has no template with this id and ErrCookIsNotMember
+// if one of the cooks is not a member of the group.
+func UpdateMealTemplateInDB(template RequestUpdateMealTemplate, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = updateMealTemplateWithTransaction(template, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateMealTemplateWithTransaction(template RequestUpdateMealTemplate, tx *sql.Tx) error {
+	query := `
+		UPDATE meal_templates
+		SET title = $3, meal_type = $4, notes = $5, default_time = $6
+		WHERE template_id = $1
+		AND group_id = $2
+	`
+	result, err := tx.Exec(query, template.TemplateId, template.GroupId, template.Title, template.Type, template.Notes, template.DefaultTime)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return replaceTemplateCooksWithTransaction(template.TemplateId, template.GroupId, template.CookIds, tx)
+}
+
+func replaceTemplateCooksWithTransaction(templateId string, groupId string, cookIds []string, tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM meal_template_cooks WHERE template_id = $1`, templateId)
+	if err != nil {
+		return err
+	}
+	if len(cookIds) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO meal_template_cooks (template_id, user_id)
+		SELECT $1, ug.user_id
+		FROM user_groups ug
+		WHERE ug.group_id = $2
+		AND ug.user_id = ANY ($3::uuid[])
+		AND ug.deleted_at IS NULL
+	`
+	result, err := tx.Exec(query, templateId, groupId, pq.Array(cookIds))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(rowsAffected) != len(cookIds) {
+		return ErrCookIsNotMember
+	}
+	return nil
+}
+
+func DeleteMealTemplateInDB(groupId string, templateId string, db *sql.DB) error {
+	result, err := db.Exec(`DELETE FROM meal_templates WHERE template_id = $1 AND group_id = $2`, templateId, groupId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// Copy week
+
+// CopyMealsInDB creates a copy of every meal of the group in [from, to) that is dayOffset days later, at the same clock
+// time in the location. The copies are open and not part of a series. With includeCooks the cooks that are still
+// members stay cooks.
+func CopyMealsInDB(groupId string, from time.Time, to time.Time, dayOffset int, location *time.Location, includeCooks bool, userId string, db *sql.DB) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	mealIds, err := copyMealsWithTransaction(groupId, from, to, dayOffset, location, includeCooks, userId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	return mealIds, tx.Commit()
+}
+
+func copyMealsWithTransaction(groupId string, from time.Time, to time.Time, dayOffset int, location *time.Location, includeCooks bool, userId string, tx *sql.Tx) ([]string, error) {
+	query := `
+		SELECT meal_id, title, meal_type, COALESCE(notes, ''), date_time, preference_deadline_offset, max_participants
+		FROM meals
+		WHERE group_id = $1
+		AND deleted_at IS NULL
+		AND date_time >= $2
+		AND date_time < $3
+		ORDER BY date_time
+	`
+	rows, err := tx.Query(query, groupId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	type sourceMeal struct {
+		mealId   string
+		meal     RequestNewMeal
+		dateTime time.Time
+	}
+	var sourceMeals []sourceMeal
+	for rows.Next() {
+		source := sourceMeal{meal: RequestNewMeal{GroupId: groupId}}
+		err := rows.Scan(&source.mealId, &source.meal.Title, &source.meal.Type, &source.meal.Notes, &source.dateTime, &source.meal.DeadlineMinutesBefore, &source.meal.MaxParticipants)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sourceMeals = append(sourceMeals, source)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	copyCooksQuery := `
+		INSERT INTO meal_preferences (meal_id, user_id, preference, is_cook)
+		SELECT $2, mp.user_id, 'undecided', TRUE
+		FROM meal_preferences mp
+		INNER JOIN user_groups ug ON ug.user_id = mp.user_id AND ug.group_id = $3 AND ug.deleted_at IS NULL
+		WHERE mp.meal_id = $1
+		AND mp.is_cook
+		AND mp.deleted_at IS NULL
+	`
+	mealIds := []string{}
+	for _, source := range sourceMeals {
+		source.meal.ScheduledAt = shiftDays(source.dateTime, dayOffset, location).Format(time.RFC3339)
+		mealId, err := CreateNewMealInDBWithTransaction(source.meal, userId, tx)
+		if err != nil {
+			return nil, err
+		}
+		if includeCooks {
+			_, err = tx.Exec(copyCooksQuery, source.mealId, mealId, groupId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		mealIds = append(mealIds, mealId)
+	}
+	return mealIds, nil
+}
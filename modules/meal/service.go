@@ -4,28 +4,32 @@ import (
 	"database/sql"
 	"enguete/modules/group"
 	"enguete/util/auth"
+	"enguete/util/dates"
 	"enguete/util/frontendErrors"
+	"enguete/util/recurrence"
 	"enguete/util/responses"
 	"enguete/util/roles"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"time"
 )
 
 // basic meal functions
 
 // CreateNewMeal godoc
 // @Summary Create a new meal
-// @Description Creates a new meal within a specified group. The requesting user must be an admin or owner of the group.
+// @Description Creates a new meal within a specified group. The requesting user must be an admin or owner of the group. With a template the empty fields are taken from it and its default cooks become cooks. Instead of scheduledAt a date can be sent, the meal then gets the default time of the template or of its meal type in the group settings.
 // @Tags Meals
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token for authorization"
 // @Param newMeal body RequestNewMeal true "Payload to create a new meal"
 // @Success 201 {object} ResponseNewMeal "Successfully created new meal with meal ID"
-// @Failure 400 {object} MealError "Invalid request body"
+// @Failure 400 {object} MealError "Invalid request body or no time for the meal"
 // @Failure 401 {object} MealError "Unauthorized user or insufficient permissions"
+// @Failure 404 {object} MealError "Template does not exist"
 // @Failure 500 {object} MealError "Internal server error"
 // @Router /meals [post]
 func CreateNewMeal(c *gin.Context, db *sql.DB) {
@@ -37,28 +41,49 @@ func CreateNewMeal(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformAction(newMeal.GroupId, jwtPayload.UserId, roles.CanCreateMeal, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+	var template MealTemplate
+	if newMeal.TemplateId != "" {
+		template, err = GetMealTemplateFromDB(newMeal.GroupId, newMeal.TemplateId, db)
+		if err != nil {
+			if errors.Is(err, ErrTemplateNotFound) {
+				responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealTemplateDoesNotExistError, "Meal template does not exist")
+				return
+			}
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
 			return
 		}
-		responses.GenericInternalServerError(c.Writer)
-		return
+		newMeal = applyMealTemplate(newMeal, template)
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+	if newMeal.Title == "" || newMeal.Type == "" {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	mealId, err := CreateNewMealInDBWithTransaction(newMeal, jwtPayload.UserId, db)
+	if newMeal.ScheduledAt == "" {
+		settings, err := group.GetGroupSettingsFromDB(newMeal.GroupId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		newMeal.ScheduledAt, err = scheduledAtOfDate(newMeal.Date, template.DefaultTime, newMeal.Type, settings)
+		if err != nil {
+			if errors.Is(err, ErrMealTimeMissing) {
+				responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.MealTimeIsMissingError, "Send a time, there is no default time for this meal")
+				return
+			}
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+	}
+
+	mealId, err := CreateNewMealInDB(newMeal, jwtPayload.UserId, template.CookIds, db)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
@@ -74,21 +99,7 @@ func GetMealById(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	groupId, err := group.IsUserInGroupViaMealId(mealInfo.MealId, jwtPayload.UserId, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	mealInformation, err := GetSingularMealInformation(mealInfo.MealId, jwtPayload.UserId, db)
 	if err != nil {
@@ -110,7 +121,7 @@ func GetMealById(c *gin.Context, db *sql.DB) {
 
 	var participationInformationWithoutPreference []MealPreferences
 	if !mealInformation.Closed {
-		participationInformationWithoutPreference, err = GetGroupMembersNotParticipatingInMeal(mealInfo.MealId, groupId, db)
+		participationInformationWithoutPreference, err = GetGroupMembersNotParticipatingInMeal(mealInfo.MealId, group.GetMembership(c).GroupId, db)
 		if err != nil {
 			responses.GenericInternalServerError(c.Writer)
 			return
@@ -146,23 +157,7 @@ func DeleteMeal(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(requestData.MealId, jwtPayload.UserId, roles.CanDeleteMeal, db)
-	if err != nil {
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
-	err = DeleteMealInDB(requestData.MealId, db)
+	err := DeleteMealInDB(requestData.MealId, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -174,7 +169,7 @@ func DeleteMeal(c *gin.Context, db *sql.DB) {
 
 // ChangeMealClosedFlag godoc
 // @Summary Change a meal's open status
-// @Description Updates a meal's open or closed status within a specified group. The requesting user must be an admin or owner of the group.
+// @Description Updates a meal's open or closed status within a specified group. The requesting user must be an admin or owner of the group. Opening a meal whose preference deadline has passed removes the deadline, so preferences can be changed again and the meal stays open.
 // @Tags Meals
 // @Accept json
 // @Produce json
@@ -192,35 +187,92 @@ func ChangeMealClosedFlag(c *gin.Context, db *sql.DB) { //TODO: Functionality of
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+	err := UpdateClosedBoolInDB(updateClosedFlag.MealId, updateClosedFlag.CloseFlag, db)
 	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	//TODO: send a notification to all the members of the group.
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Meal Successfully updated"})
+}
+
+// UpdatePreferenceDeadline godoc
+// @Summary Change the preference deadline of a meal
+// @Description Sets an absolute deadline or one in minutes before the meal, which moves with the meal. Without both the deadline is removed. Once it has passed the meal gets closed and only users that can force preferences can change them. A meal that was closed by its old deadline opens again.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param deadline body RequestUpdatePreferenceDeadline true "Meal and deadline"
+// @Success 200 {object} MealSuccess "Deadline updated"
+// @Failure 400 {object} MealError "Invalid request body"
+// @Failure 401 {object} MealError "Unauthorized"
+// @Failure 403 {object} MealError "Not allowed to update the meal"
+// @Failure 404 {object} MealError "Meal does not exist"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/deadline [put]
+func UpdatePreferenceDeadline(c *gin.Context, db *sql.DB) {
+	var deadlineData RequestUpdatePreferenceDeadline
+	if err := c.ShouldBindJSON(&deadlineData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(updateClosedFlag.MealId, jwtPayload.UserId, roles.CanChangeMealFlags, db)
+	err := UpdatePreferenceDeadlineInDB(deadlineData.MealId, deadlineData.PreferenceDeadline, deadlineData.DeadlineMinutesBefore, db)
 	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+		if errors.Is(err, ErrDataCouldNotBeUpdated) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealDoesNotExistError, "Meal does not exist")
 			return
 		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Preference deadline updated"})
+}
+
+// UpdateMaxParticipants godoc
+// @Summary Change the participant limit of a meal
+// @Description Sets how many people, guests included, the meal can feed. Without maxParticipants the limit is removed. Opt-ins that don't fit wait on a waitlist and are confirmed in order once seats are free. The limit can't be lowered below the people that are already confirmed.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param capacity body RequestUpdateMaxParticipants true "Meal and limit"
+// @Success 200 {object} MealSuccess "Limit updated"
+// @Failure 400 {object} MealError "Invalid request body"
+// @Failure 401 {object} MealError "Unauthorized"
+// @Failure 403 {object} MealError "Not allowed to update the meal"
+// @Failure 404 {object} MealError "Meal does not exist"
+// @Failure 409 {object} MealError "More people are confirmed than the limit allows"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/capacity [put]
+func UpdateMaxParticipants(c *gin.Context, db *sql.DB) {
+	var capacityData RequestUpdateMaxParticipants
+	if err := c.ShouldBindJSON(&capacityData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
 		return
 	}
 
-	err = UpdateClosedBoolInDB(updateClosedFlag.MealId, updateClosedFlag.CloseFlag, db)
+	err := UpdateMaxParticipantsInDB(capacityData.MealId, capacityData.MaxParticipants, db)
 	if err != nil {
+		if errors.Is(err, ErrCapacityBelowConfirmed) {
+			responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.CapacityBelowConfirmedError, "More people are already confirmed than the new limit allows")
+			return
+		}
+		if errors.Is(err, ErrNoData) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealDoesNotExistError, "Meal does not exist")
+			return
+		}
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	//TODO: send a notification to all the members of the group.
-
-	c.JSON(http.StatusOK, MealSuccess{Message: "Meal Successfully updated"})
+	c.JSON(http.StatusOK, MealSuccess{Message: "Participant limit updated"})
 }
 
 // ChangeMealFulfilledFlag godoc
@@ -243,28 +295,7 @@ func ChangeMealFulfilledFlag(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(updateFulfilledFlag.MealId, jwtPayload.UserId, roles.CanChangeMealFlags, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
-	err = UpdateMealFulfilledStatus(updateFulfilledFlag.MealId, updateFulfilledFlag.Fulfilled, db)
+	err := UpdateMealFulfilledStatus(updateFulfilledFlag.MealId, updateFulfilledFlag.Fulfilled, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -285,31 +316,28 @@ func UpdatePreference(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
+	jwtPayload := auth.GetJWTPayload(c)
+
+	changesPreference := updatePreference.Preference != nil || updatePreference.GuestCount != nil || updatePreference.Comment != nil
+	if !changesPreference && updatePreference.IsCook == nil {
+		c.JSON(http.StatusOK, MealSuccess{Message: "No changes made"})
 		return
 	}
 
-	if updatePreference.Preference == nil && updatePreference.IsCook == nil {
-		c.JSON(http.StatusOK, MealSuccess{Message: "No changes made"})
+	if !jwtPayload.HasScope(roles.ScopeMeals) {
+		responses.GenericApiTokenScopeError(c.Writer)
 		return
 	}
 
 	isSelfAction := updatePreference.UserId == jwtPayload.UserId
 
-	_, err = group.IsUserInGroupViaMealId(updatePreference.MealId, updatePreference.UserId, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
+	if !isSelfAction {
+		if !group.CheckIfRequesterCanPerformAction(c, roles.CanForceMealPreferenceAndCooking) {
+			responses.GenericNotAllowedToPerformActionError(c.Writer)
 			return
 		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
 
-	if !isSelfAction {
-		canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(updatePreference.MealId, jwtPayload.UserId, roles.CanForceMealPreferenceAndCooking, db)
+		_, err := group.IsUserInGroupViaMealId(updatePreference.MealId, updatePreference.UserId, db)
 		if err != nil {
 			if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
 				responses.GenericGroupDoesNotExistError(c.Writer)
@@ -318,22 +346,44 @@ func UpdatePreference(c *gin.Context, db *sql.DB) {
 			responses.GenericInternalServerError(c.Writer)
 			return
 		}
-		if !canPerformAction {
-			responses.GenericNotAllowedToPerformActionError(c.Writer)
+	}
+
+	if changesPreference && !group.CheckIfRequesterCanPerformAction(c, roles.CanForceMealPreferenceAndCooking) {
+		err := checkPreferenceDeadline(updatePreference.MealId, db)
+		if err != nil {
+			if errors.Is(err, ErrPreferenceDeadlinePassed) {
+				responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.PreferenceDeadlinePassedError, "The deadline for preferences of this meal has passed")
+				return
+			}
+			if errors.Is(err, ErrNoData) {
+				responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealDoesNotExistError, "Meal does not exist")
+				return
+			}
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
 			return
 		}
 	}
 
-	if updatePreference.Preference != nil {
-		err = ChangeOptInStatusMealInDB(updatePreference.UserId, updatePreference.MealId, *updatePreference.Preference, db)
+	if changesPreference {
+		err := ChangeOptInStatusMealInDB(updatePreference.UserId, updatePreference.MealId, updatePreference.Preference, updatePreference.GuestCount, updatePreference.Comment, db)
 		if err != nil {
+			if errors.Is(err, ErrNotEnoughSeats) {
+				responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.NotEnoughSeatsError, "There are not enough free seats for the guests")
+				return
+			}
+			if errors.Is(err, ErrNoData) {
+				responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealDoesNotExistError, "Meal does not exist")
+				return
+			}
+			log.Println(err)
 			responses.GenericInternalServerError(c.Writer)
 			return
 		}
 	}
 
 	if updatePreference.IsCook != nil {
-		err = ChangeIsCookForUserOnMeal(updatePreference.UserId, updatePreference.MealId, *updatePreference.IsCook, db)
+		err := ChangeIsCookForUserOnMeal(updatePreference.UserId, updatePreference.MealId, *updatePreference.IsCook, db)
 
 		if err != nil {
 			log.Println(err)
@@ -371,27 +421,7 @@ func UpdateMealTitle(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(newTitle.MealId, jwtPayload.UserId, roles.CanUpdateMeal, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
-	err = UpdateMealTitleIdDB(newTitle.MealId, newTitle.NewTitle, db)
+	err := UpdateMealTitleIdDB(newTitle.MealId, newTitle.NewTitle, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -421,26 +451,6 @@ func UpdateMealType(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(newType.MealId, jwtPayload.UserId, roles.CanUpdateMeal, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
 	//TODO: Send an updated meal information to the frontend
 	c.JSON(http.StatusOK, MealSuccess{Message: "Meal updated successfully"})
 }
@@ -465,29 +475,7 @@ func UpdateMealNotes(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(newNotes.MealId, jwtPayload.UserId, roles.CanUpdateMeal, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-
-		responses.GenericInternalServerError(c.Writer)
-		return
-
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
-	err = UpdateMealNotesInDB(newNotes.MealId, newNotes.NewNotes, db)
+	err := UpdateMealNotesInDB(newNotes.MealId, newNotes.NewNotes, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -517,27 +505,7 @@ func UpdateMealScheduledAt(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	canPerformAction, _, err := group.CheckIfUserIsAllowedToPerformActionViaMealId(newScheduledAt.MealId, jwtPayload.UserId, roles.CanUpdateMeal, db)
-	if err != nil {
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !canPerformAction {
-		responses.GenericNotAllowedToPerformActionError(c.Writer)
-		return
-	}
-
-	err = UpdateMealScheduledAtInDB(newScheduledAt.MealId, newScheduledAt.NewScheduledAt, db)
+	err := UpdateMealScheduledAtInDB(newScheduledAt.MealId, newScheduledAt.NewScheduledAt, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -554,21 +522,7 @@ func SyncGroupMeals(c *gin.Context, db *sql.DB) {
 		responses.GenericBadRequestError(c.Writer)
 		return
 	}
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
-
-	inGroup, err := group.IsUserInGroup(requestSyncGroupMeals.GroupId, jwtPayload.UserId, db)
-	if err != nil {
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
-	if !inGroup {
-		responses.GenericNotFoundError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	meals, err := GetAllMealsInGroupInTimeframe(requestSyncGroupMeals.GroupId, jwtPayload.UserId, requestSyncGroupMeals.StartDate, requestSyncGroupMeals.EndDate, db)
 	if err != nil {
@@ -596,23 +550,8 @@ func SyncMealInformation(c *gin.Context, db *sql.DB) {
 		return
 	}
 	log.Println(1)
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 	log.Println(2)
-	_, err = group.IsUserInGroupViaMealId(mealInfo.MealId, jwtPayload.UserId, db)
-	if err != nil {
-		log.Println(err)
-
-		if errors.Is(err, group.ErrUserIsNotPartOfThisGroup) {
-			responses.GenericGroupDoesNotExistError(c.Writer)
-			return
-		}
-		responses.GenericInternalServerError(c.Writer)
-		return
-	}
 	log.Println(3)
 	mealInformation, err := GetSingularMealInformation(mealInfo.MealId, jwtPayload.UserId, db)
 	if err != nil {
@@ -648,3 +587,403 @@ func SyncMealInformation(c *gin.Context, db *sql.DB) {
 	}
 	c.JSON(http.StatusOK, meal)
 }
+
+// Series
+
+// CreateMealSeries godoc
+// @Summary Create a recurring meal
+// @Description Creates a meal series from a recurrence rule, a subset of iCalendar RRULE with FREQ=DAILY, WEEKLY or MONTHLY, INTERVAL, BYDAY, BYMONTHDAY, WKST and COUNT or UNTIL. The rule is expanded in the time zone of the group and the occurrences of the next weeks are created right away, later ones ahead of time.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param series body RequestNewMealSeries true "Meal, first occurrence and recurrence rule"
+// @Success 201 {object} ResponseNewMealSeries "Series and created occurrences"
+// @Failure 400 {object} MealError "Invalid request body or recurrence rule"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to create meals"
+// @Failure 404 {object} MealError "Group does not exist"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/series [post]
+func CreateMealSeries(c *gin.Context, db *sql.DB) {
+	var newSeries RequestNewMealSeries
+	if err := c.ShouldBindJSON(&newSeries); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	settings, err := group.GetGroupSettingsFromDB(newSeries.GroupId, db)
+	if err != nil {
+		if errors.Is(err, group.ErrNotFound) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	location, err := settings.Location()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	rule, err := recurrence.Parse(newSeries.RRule, location)
+	if err != nil {
+		if errors.Is(err, recurrence.ErrUnsupportedRule) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.UnsupportedRecurrenceRuleError, "Only FREQ=DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY, BYMONTHDAY, WKST, COUNT and UNTIL are supported")
+			return
+		}
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidRecurrenceRuleError, "Invalid recurrence rule")
+		return
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, newSeries.StartsAt)
+	if err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+	startsAt = startsAt.In(location)
+
+	exceptions := newSeries.Exceptions
+	if exceptions == nil {
+		exceptions = []string{}
+	}
+
+	seriesId, mealIds, err := CreateMealSeriesInDB(MealSeries{
+		GroupId:        newSeries.GroupId,
+		Title:          newSeries.Title,
+		MealType:       newSeries.Type,
+		Notes:          newSeries.Notes,
+		RRule:          rule.String(),
+		StartsAt:       startsAt,
+		TimeZone:       settings.TimeZone,
+		Exceptions:     exceptions,
+		GeneratedUntil: startsAt,
+		CreatedBy:      &jwtPayload.UserId,
+	}, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ResponseNewMealSeries{SeriesId: seriesId, MealIds: mealIds})
+}
+
+// GetGroupMealSeries godoc
+// @Summary List the meal series of a group
+// @Description Returns the recurring meals of the group that are not cancelled.
+// @Tags Meals
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} MealSeries "Meal series of the group"
+// @Failure 400 {object} MealError "Invalid group ID"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/series [get]
+func GetGroupMealSeries(c *gin.Context, db *sql.DB) {
+	var groupData RequestGroupMealSeries
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	series, err := GetMealSeriesOfGroupFromDB(groupData.GroupId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// UpdateMealSeries godoc
+// @Summary Edit a recurring meal
+// @Description Changes the fields that are set for the occurrence (scope this), the occurrence and the later ones (following) or every upcoming occurrence (all). Preferences of the occurrences are kept.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param update body RequestUpdateMealSeries true "Occurrence, scope and changes"
+// @Success 200 {object} MealSuccess "Series updated"
+// @Failure 400 {object} MealError "Invalid request body or the meal is not part of a series"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to update meals"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/series [put]
+func UpdateMealSeries(c *gin.Context, db *sql.DB) {
+	var updateData RequestUpdateMealSeries
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+	if updateData.Title == nil && updateData.Type == nil && updateData.Notes == nil && updateData.Time == nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := UpdateMealSeriesInDB(updateData, db)
+	if err != nil {
+		if errors.Is(err, ErrMealIsNotAnOccurrence) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.MealIsNotPartOfASeriesError, "Meal is not part of a series")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Meal series updated"})
+}
+
+// DeleteMealSeries godoc
+// @Summary Cancel a recurring meal
+// @Description Cancels the occurrence (scope this), the occurrence and the later ones (following) or every upcoming occurrence and the series itself (all).
+// @Tags Meals
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param mealId query string true "Occurrence the cancellation starts from"
+// @Param scope query string true "this, following or all"
+// @Success 200 {object} MealSuccess "Occurrences cancelled"
+// @Failure 400 {object} MealError "Invalid parameters or the meal is not part of a series"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to delete meals"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/series [delete]
+func DeleteMealSeries(c *gin.Context, db *sql.DB) {
+	var deleteData RequestDeleteMealSeries
+	if err := c.ShouldBindQuery(&deleteData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := DeleteMealSeriesInDB(deleteData.MealId, deleteData.Scope, db)
+	if err != nil {
+		if errors.Is(err, ErrMealIsNotAnOccurrence) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.MealIsNotPartOfASeriesError, "Meal is not part of a series")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Meal series cancelled"})
+}
+
+// Templates
+
+// GetGroupMealTemplates godoc
+// @Summary List the meal templates of a group
+// @Description Returns the templates of the group ordered by title.
+// @Tags Meals
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Success 200 {array} MealTemplate "Meal templates of the group"
+// @Failure 400 {object} MealError "Invalid group ID"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/templates [get]
+func GetGroupMealTemplates(c *gin.Context, db *sql.DB) {
+	var groupData RequestGroupMealSeries
+	if err := c.ShouldBindQuery(&groupData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	templates, err := GetMealTemplatesOfGroupFromDB(groupData.GroupId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// CreateMealTemplate godoc
+// @Summary Create a meal template
+// @Description Stores a title, type, notes, default time and default cooks that new meals can be created from.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param template body RequestMealTemplate true "Template"
+// @Success 201 {object} ResponseMealTemplateId "Template created"
+// @Failure 400 {object} MealError "Invalid request body or a cook is not a member"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to create meals"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/templates [post]
+func CreateMealTemplate(c *gin.Context, db *sql.DB) {
+	var templateData RequestMealTemplate
+	if err := c.ShouldBindJSON(&templateData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+	templateData.CookIds = uniqueIds(templateData.CookIds)
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	templateId, err := CreateMealTemplateInDB(templateData, jwtPayload.UserId, db)
+	if err != nil {
+		respondWithMealTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ResponseMealTemplateId{TemplateId: templateId})
+}
+
+// UpdateMealTemplate godoc
+// @Summary Update a meal template
+// @Description Replaces all fields of the template. Meals that were created from it don't change.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param template body RequestUpdateMealTemplate true "Template"
+// @Success 200 {object} MealSuccess "Template updated"
+// @Failure 400 {object} MealError "Invalid request body or a cook is not a member"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to create meals"
+// @Failure 404 {object} MealError "Template does not exist"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/templates [put]
+func UpdateMealTemplate(c *gin.Context, db *sql.DB) {
+	var templateData RequestUpdateMealTemplate
+	if err := c.ShouldBindJSON(&templateData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+	templateData.CookIds = uniqueIds(templateData.CookIds)
+
+	err := UpdateMealTemplateInDB(templateData, db)
+	if err != nil {
+		respondWithMealTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Meal template updated"})
+}
+
+// DeleteMealTemplate godoc
+// @Summary Delete a meal template
+// @Description Deletes the template. Meals that were created from it stay.
+// @Tags Meals
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param groupId query string true "Group ID"
+// @Param templateId query string true "Template ID"
+// @Success 200 {object} MealSuccess "Template deleted"
+// @Failure 400 {object} MealError "Invalid parameters"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to create meals"
+// @Failure 404 {object} MealError "Template does not exist"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/templates [delete]
+func DeleteMealTemplate(c *gin.Context, db *sql.DB) {
+	var templateData RequestMealTemplateId
+	if err := c.ShouldBindQuery(&templateData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := DeleteMealTemplateInDB(templateData.GroupId, templateData.TemplateId, db)
+	if err != nil {
+		respondWithMealTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MealSuccess{Message: "Meal template deleted"})
+}
+
+func respondWithMealTemplateError(c *gin.Context, err error) {
+	if errors.Is(err, ErrTemplateNotFound) {
+		responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.MealTemplateDoesNotExistError, "Meal template does not exist")
+		return
+	}
+	if errors.Is(err, ErrCookIsNotMember) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.CookIsNotAMemberError, "Every cook has to be a member of the group")
+		return
+	}
+	log.Println(err)
+	responses.GenericInternalServerError(c.Writer)
+}
+
+// CopyWeek godoc
+// @Summary Copy the meals of a week into another week
+// @Description Creates a copy of every meal of the source week in the target week, on the same weekday and at the same time. Weeks follow the time zone and week start of the group settings. The copies are open, without preferences and optionally with the same cooks.
+// @Tags Meals
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token for authorization"
+// @Param copy body RequestCopyWeek true "Group, source and target week"
+// @Success 201 {object} ResponseCopyWeek "Created meals"
+// @Failure 400 {object} MealError "Invalid request body or source and target are the same week"
+// @Failure 401 {object} MealError "Unauthorized user"
+// @Failure 403 {object} MealError "Not allowed to create meals"
+// @Failure 404 {object} MealError "Group does not exist"
+// @Failure 500 {object} MealError "Internal server error"
+// @Router /meals/copy-week [post]
+func CopyWeek(c *gin.Context, db *sql.DB) {
+	var copyData RequestCopyWeek
+	if err := c.ShouldBindJSON(&copyData); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	settings, err := group.GetGroupSettingsFromDB(copyData.GroupId, db)
+	if err != nil {
+		if errors.Is(err, group.ErrNotFound) {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	location, err := settings.Location()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	sourceWeek, err := time.Parse(time.RFC3339, copyData.SourceWeek)
+	if err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+	targetWeek, err := time.Parse(time.RFC3339, copyData.TargetWeek)
+	if err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	weekStart := time.Weekday(settings.WeekStart)
+	sourceStart := dates.StartOfWeek(sourceWeek, location, weekStart)
+	targetStart := dates.StartOfWeek(targetWeek, location, weekStart)
+	dayOffset := daysBetween(sourceStart, targetStart)
+	if dayOffset == 0 {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	mealIds, err := CopyMealsInDB(copyData.GroupId, sourceStart, sourceStart.AddDate(0, 0, 7), dayOffset, location, copyData.IncludeCooks, jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ResponseCopyWeek{MealIds: mealIds})
+}
@@ -1,6 +1,9 @@
 package meal
 
-import "enguete/modules/group"
+import (
+	"enguete/modules/group"
+	"time"
+)
 
 type MealError struct {
 	Error string `json:"error"`
@@ -10,12 +13,20 @@ type MealSuccess struct {
 	Message string `json:"message"`
 }
 
+// RequestNewMeal needs a title and a type, unless the template has them. Instead of ScheduledAt a date can be sent,
+// the meal then gets the default time of the template or of the meal type in the group settings. The preference
+// deadline is either a time or a number of minutes before the meal.
 type RequestNewMeal struct {
-	Title       string `json:"title" binding:"required"`
-	Type        string `json:"type" binding:"required"`
-	ScheduledAt string `json:"scheduledAt" binding:"required,dateTime"`
-	Notes       string `json:"notes" `
-	GroupId     string `json:"groupId" binding:"required,uuid"`
+	Title                 string `json:"title" binding:"max=100"`
+	Type                  string `json:"type" binding:"max=50"`
+	ScheduledAt           string `json:"scheduledAt" binding:"required_without=Date,omitempty,dateTime"`
+	Date                  string `json:"date" binding:"omitempty,datetime=2006-01-02"`
+	Notes                 string `json:"notes" `
+	GroupId               string `json:"groupId" binding:"required,uuid"`
+	TemplateId            string `json:"templateId" binding:"omitempty,uuid"`
+	PreferenceDeadline    string `json:"preferenceDeadline" binding:"omitempty,dateTime,excluded_with=DeadlineMinutesBefore"`
+	DeadlineMinutesBefore *int   `json:"deadlineMinutesBefore" binding:"omitempty,min=0,max=43200"`
+	MaxParticipants       *int   `json:"maxParticipants" binding:"omitempty,min=1,max=1000"`
 }
 
 type RequestOptInMeal struct {
@@ -46,6 +57,20 @@ type RequestUpdateNotes struct {
 	NewNotes string `json:"newNotes" binding:"required"`
 	MealId   string `json:"mealId" binding:"required,uuid"`
 }
+
+// RequestUpdatePreferenceDeadline removes the deadline when neither field is sent.
+type RequestUpdatePreferenceDeadline struct {
+	MealId                string `json:"mealId" binding:"required,uuid"`
+	PreferenceDeadline    string `json:"preferenceDeadline" binding:"omitempty,dateTime,excluded_with=DeadlineMinutesBefore"`
+	DeadlineMinutesBefore *int   `json:"deadlineMinutesBefore" binding:"omitempty,min=0,max=43200"`
+}
+
+// RequestUpdateMaxParticipants removes the limit when MaxParticipants is not sent.
+type RequestUpdateMaxParticipants struct {
+	MealId          string `json:"mealId" binding:"required,uuid"`
+	MaxParticipants *int   `json:"maxParticipants" binding:"omitempty,min=1,max=1000"`
+}
+
 type RequestUpdateScheduledAt struct {
 	NewScheduledAt string `json:"newScheduledAt" binding:"required,dateTime"`
 	MealId         string `json:"mealId" binding:"required,uuid"`
@@ -56,11 +81,15 @@ type RequestAddCookToMeal struct {
 	MealId string `json:"mealId" binding:"required,uuid"`
 }
 
+// RequestUpdatePreference changes only the fields that are sent. Guests are dropped when the preference is neither
+// opt-in nor maybe.
 type RequestUpdatePreference struct {
 	UserId     string  `json:"userId" binding:"required"`
 	MealId     string  `json:"mealId" binding:"required,uuid"`
-	Preference *string `json:"preference"`
+	Preference *string `json:"preference" binding:"omitempty,oneof=opt-in opt-out maybe undecided"`
 	IsCook     *bool   `json:"isCook"`
+	GuestCount *int    `json:"guestCount" binding:"omitempty,min=0,max=20"`
+	Comment    *string `json:"comment" binding:"omitempty,max=500"`
 }
 
 type RequestRemoveCook struct {
@@ -73,17 +102,26 @@ type ResponseNewMeal struct {
 }
 
 type MealInformation struct {
-	MealId           string `json:"mealId"`
-	GroupId          string `json:"groupId"`
-	Title            string `json:"title"`
-	Closed           bool   `json:"closed"`
-	Fulfilled        bool   `json:"fulfilled"`
-	DateTime         string `json:"dateTime"`
-	MealType         string `json:"mealType"`
-	Notes            string `json:"notes"`
-	ParticipantCount int    `json:"participantCount"`
-	UserPreference   string `json:"userPreference"`
-	IsCook           bool   `json:"isCook"`
+	MealId           string  `json:"mealId"`
+	GroupId          string  `json:"groupId"`
+	Title            string  `json:"title"`
+	Closed           bool    `json:"closed"`
+	Fulfilled        bool    `json:"fulfilled"`
+	DateTime         string  `json:"dateTime"`
+	MealType         string  `json:"mealType"`
+	Notes            string  `json:"notes"`
+	ParticipantCount int     `json:"participantCount"` // opt-ins and their guests
+	MaybeCount       int     `json:"maybeCount"`       // maybes and their guests
+	UserPreference   string  `json:"userPreference"`
+	IsCook           bool    `json:"isCook"`
+	SeriesId         *string `json:"seriesId"` // set for occurrences of a recurring meal
+
+	PreferenceDeadline    *string `json:"preferenceDeadline"`    // preferences can't be changed after it
+	DeadlineMinutesBefore *int    `json:"deadlineMinutesBefore"` // set when the deadline moves with the meal
+
+	MaxParticipants      *int `json:"maxParticipants"` // seats including guests, nil for no limit
+	WaitlistCount        int  `json:"waitlistCount"`
+	UserWaitlistPosition *int `json:"userWaitlistPosition"` // starts at 1, nil when the user is not waiting
 }
 
 type MealPreferences struct {
@@ -94,6 +132,10 @@ type MealPreferences struct {
 	Username     string `json:"username"`
 	Preference   string `json:"preference"`
 	IsCook       bool   `json:"isCook"`
+	GuestCount   int    `json:"guestCount"`
+	Comment      string `json:"comment"`
+
+	WaitlistPosition *int `json:"waitlistPosition"` // starts at 1, nil when the user is not waiting
 }
 
 type Meal struct {
@@ -123,3 +165,98 @@ type ResponseSyncSingularMeal struct {
 	MealInformation           MealInformation        `json:"mealInformation"`
 	MealPreferenceInformation ResponsePreferenceSync `json:"mealPreferences"`
 }
+
+type RequestNewMealSeries struct {
+	GroupId    string   `json:"groupId" binding:"required,uuid"`
+	Title      string   `json:"title" binding:"required,max=100"`
+	Type       string   `json:"type" binding:"required,max=50"`
+	Notes      string   `json:"notes"`
+	StartsAt   string   `json:"startsAt" binding:"required,dateTime"`                            // first occurrence, its clock time in the time zone of the group is used for every occurrence
+	RRule      string   `json:"rrule" binding:"required,max=500"`                                // e.g. "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"
+	Exceptions []string `json:"exceptions" binding:"omitempty,max=366,dive,datetime=2006-01-02"` // dates without an occurrence
+}
+
+type ResponseNewMealSeries struct {
+	SeriesId string   `json:"seriesId"`
+	MealIds  []string `json:"mealIds"` // occurrences that were created ahead of time
+}
+
+// RequestUpdateMealSeries changes the fields that are set, starting from the occurrence MealId.
+type RequestUpdateMealSeries struct {
+	MealId string  `json:"mealId" binding:"required,uuid"`
+	Scope  string  `json:"scope" binding:"required,oneof=this following all"`
+	Title  *string `json:"title" binding:"omitempty,min=1,max=100"`
+	Type   *string `json:"type" binding:"omitempty,min=1,max=50"`
+	Notes  *string `json:"notes"`
+	Time   *string `json:"time" binding:"omitempty,datetime=15:04"` // new clock time in the time zone of the series
+}
+
+type RequestDeleteMealSeries struct {
+	MealId string `form:"mealId" binding:"required,uuid"`
+	Scope  string `form:"scope" binding:"required,oneof=this following all"`
+}
+
+type RequestGroupMealSeries struct {
+	GroupId string `form:"groupId" binding:"required,uuid"`
+}
+
+type MealSeries struct {
+	SeriesId       string    `json:"seriesId"`
+	GroupId        string    `json:"groupId"`
+	Title          string    `json:"title"`
+	MealType       string    `json:"mealType"`
+	Notes          string    `json:"notes"`
+	RRule          string    `json:"rrule"`
+	StartsAt       time.Time `json:"startsAt"`
+	TimeZone       string    `json:"timeZone"`
+	Exceptions     []string  `json:"exceptions"`
+	GeneratedUntil time.Time `json:"generatedUntil"`
+	CreatedBy      *string   `json:"createdBy"`
+}
+
+type MealTemplate struct {
+	TemplateId  string   `json:"templateId"`
+	GroupId     string   `json:"groupId"`
+	Title       string   `json:"title"`
+	MealType    string   `json:"mealType"`
+	Notes       string   `json:"notes"`
+	DefaultTime *string  `json:"defaultTime"` // "HH:MM" in the time zone of the group
+	CookIds     []string `json:"cookIds"`
+}
+
+type RequestMealTemplate struct {
+	GroupId     string   `json:"groupId" binding:"required,uuid"`
+	Title       string   `json:"title" binding:"required,max=100"`
+	Type        string   `json:"type" binding:"required,max=50"`
+	Notes       string   `json:"notes"`
+	DefaultTime *string  `json:"defaultTime" binding:"omitempty,datetime=15:04"`
+	CookIds     []string `json:"cookIds" binding:"omitempty,max=20,dive,uuid"`
+}
+
+// RequestUpdateMealTemplate replaces all fields of the template.
+type RequestUpdateMealTemplate struct {
+	RequestMealTemplate
+	TemplateId string `json:"templateId" binding:"required,uuid"`
+}
+
+type RequestMealTemplateId struct {
+	GroupId    string `form:"groupId" binding:"required,uuid"`
+	TemplateId string `form:"templateId" binding:"required,uuid"`
+}
+
+type ResponseMealTemplateId struct {
+	TemplateId string `json:"templateId"`
+}
+
+// RequestCopyWeek copies the meals of the week that contains SourceWeek into the week that contains TargetWeek, on
+// the same weekdays and at the same times.
+type RequestCopyWeek struct {
+	GroupId      string `json:"groupId" binding:"required,uuid"`
+	SourceWeek   string `json:"sourceWeek" binding:"required,dateTime"`
+	TargetWeek   string `json:"targetWeek" binding:"required,dateTime"`
+	IncludeCooks bool   `json:"includeCooks"`
+}
+
+type ResponseCopyWeek struct {
+	MealIds []string `json:"mealIds"`
+}
@@ -2,45 +2,122 @@ package user
 
 import (
 	"database/sql"
+	"enguete/util/auth"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterUserRoute(router *gin.Engine, db *sql.DB) {
-	registerUserRoutes(router, db)
-	registerAuthRoutes(router, db)
+// RegisterUserRoute registers the user and auth routes. Account endpoints are limited to sessions, personal access
+// tokens can only read the user.
+func RegisterUserRoute(public *gin.RouterGroup, authenticated *gin.RouterGroup, db *sql.DB) {
+	session := authenticated.Group("/", auth.RequireSession())
+
+	registerUserRoutes(authenticated, session, db)
+	registerAuthRoutes(public, authenticated, session, db)
 }
 
-func registerUserRoutes(router *gin.Engine, db *sql.DB) {
-	router.GET("/users/", func(c *gin.Context) {
+func registerUserRoutes(authenticated *gin.RouterGroup, session *gin.RouterGroup, db *sql.DB) {
+	authenticated.GET("/users/", func(c *gin.Context) {
 		GetUserInformationById(c, db)
 	})
-	router.GET("/users/groups", func(c *gin.Context) {
+	authenticated.GET("/users/groups", func(c *gin.Context) {
 		GetUserGroups(c, db)
 	})
-	router.DELETE("/users/", func(c *gin.Context) {
+	session.DELETE("/users/", func(c *gin.Context) {
 		DeleteUserWithJWT(c, db)
 	})
-	router.PUT("/users/username/", func(c *gin.Context) {
+	session.PUT("/users/username/", func(c *gin.Context) {
 		UpdateUsername(c, db)
 	})
-	router.PUT("/users/password/", func(c *gin.Context) {
+	session.PUT("/users/password/", func(c *gin.Context) {
 		UpdateUserPassword(c, db)
 	})
+	session.PUT("/users/email", func(c *gin.Context) {
+		UpdateEmail(c, db)
+	})
+	session.POST("/users/email/resend", func(c *gin.Context) {
+		ResendEmailVerification(c, db)
+	})
+	session.POST("/users/2fa/enroll", func(c *gin.Context) {
+		EnrollTwoFactor(c, db)
+	})
+	session.POST("/users/2fa/verify", func(c *gin.Context) {
+		VerifyTwoFactorEnrollment(c, db)
+	})
+	session.POST("/users/2fa/recovery-codes", func(c *gin.Context) {
+		RegenerateRecoveryCodes(c, db)
+	})
+	session.DELETE("/users/2fa", func(c *gin.Context) {
+		DisableTwoFactor(c, db)
+	})
+	session.GET("/users/tokens", func(c *gin.Context) {
+		GetApiTokens(c, db)
+	})
+	session.POST("/users/tokens", func(c *gin.Context) {
+		CreateApiToken(c, db)
+	})
+	session.DELETE("/users/tokens", func(c *gin.Context) {
+		RevokeApiToken(c, db)
+	})
+	session.GET("/users/identities", func(c *gin.Context) {
+		GetUserIdentities(c, db)
+	})
+	session.POST("/users/identities/link", func(c *gin.Context) {
+		StartOidcLink(c, db)
+	})
+	session.POST("/users/identities/link/callback", func(c *gin.Context) {
+		FinishOidcLink(c, db)
+	})
+	session.DELETE("/users/identities", func(c *gin.Context) {
+		UnlinkIdentity(c, db)
+	})
+	session.GET("/users/sessions", func(c *gin.Context) {
+		GetUserSessions(c, db)
+	})
+	session.DELETE("/users/sessions", func(c *gin.Context) {
+		RevokeSession(c, db)
+	})
+	session.DELETE("/users/sessions/others", func(c *gin.Context) {
+		RevokeOtherSessions(c, db)
+	})
 }
 
-func registerAuthRoutes(router *gin.Engine, db *sql.DB) {
+func registerAuthRoutes(public *gin.RouterGroup, authenticated *gin.RouterGroup, session *gin.RouterGroup, db *sql.DB) {
 
-	router.POST("/auth/signup", func(c *gin.Context) {
+	public.POST("/auth/signup", func(c *gin.Context) {
 		SignUp(c, db)
 	})
-	router.POST("/auth/signin", func(c *gin.Context) {
+	public.POST("/auth/signin", func(c *gin.Context) {
 		SignIn(c, db)
 	})
-	router.POST("/auth/logout", func(c *gin.Context) {
+	public.POST("/auth/signin/2fa", func(c *gin.Context) {
+		SignInWithTwoFactor(c, db)
+	})
+	public.GET("/auth/oidc/providers", func(c *gin.Context) {
+		GetOidcProviders(c)
+	})
+	public.GET("/auth/oidc/start", func(c *gin.Context) {
+		StartOidcSignIn(c, db)
+	})
+	public.POST("/auth/oidc/callback", func(c *gin.Context) {
+		OidcCallback(c, db)
+	})
+	session.POST("/auth/logout", func(c *gin.Context) {
 		Logout(c, db)
 	})
-	router.GET("/auth/check", func(c *gin.Context) {
+	public.POST("/auth/email/verify", func(c *gin.Context) {
+		VerifyEmail(c, db)
+	})
+	public.POST("/auth/password/forgot", func(c *gin.Context) {
+		ForgotPassword(c, db)
+	})
+	public.POST("/auth/password/reset", func(c *gin.Context) {
+		ResetPassword(c, db)
+	})
+	authenticated.GET("/auth/check", func(c *gin.Context) {
 		CheckAuth(c, db)
 	})
+	public.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		GetJWKS(c)
+	})
 
 }
@@ -0,0 +1,365 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"enguete/util/auth"
+	"enguete/util/frontendErrors"
+	"enguete/util/hashing"
+	"enguete/util/jwt"
+	"enguete/util/links"
+	"enguete/util/mailer"
+	"enguete/util/oidc"
+	"enguete/util/responses"
+	"enguete/util/throttle"
+	"enguete/util/totp"
+	"enguete/util/validation"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailVerificationTokenLifeTime is how long the link of a verification mail can be used.
+const emailVerificationTokenLifeTime = time.Hour * 24
+
+// twoFactorIssuer is the name authenticator apps show next to the code.
+const twoFactorIssuer = "enguete"
+
+const recoveryCodeCount = 10
+
+// oidcLoginStateLifeTime is how long the user has to finish the sign in at the identity provider.
+const oidcLoginStateLifeTime = time.Minute * 10
+
+// oidcBindingCookie ties a login state to the browser that started the flow, so a provider url sent to someone else
+// can't be finished in their browser.
+const oidcBindingCookie = "oidc_binding"
+
+// apiTokenHintLength is how much of a personal access token is stored in plain text to recognize it.
+const apiTokenHintLength = 8
+
+// respondWithPasswordValidationError writes the matching error response for an error of validation.IsValidPassword.
+func respondWithPasswordValidationError(c *gin.Context, err error) {
+	if errors.Is(err, validation.PasswordFormatNeedsUpperLowerSpecialError) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatNeedsUpperLowerSpecialError, "Password needs Upper, lower and special characters and at least one number")
+		return
+	}
+	if errors.Is(err, validation.PasswordFormatTooShortError) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooShortError, "The Password needs to be at least 8 letters long")
+		return
+	}
+	if errors.Is(err, validation.PasswordToLongError) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooLongError, "The Password is to long, max length is 127 letters")
+		return
+	}
+	responses.GenericUnauthorizedError(c.Writer)
+}
+
+// sendEmailVerificationMail creates a new verification token for the address and mails the link to it.
+func sendEmailVerificationMail(userId string, username string, email string, db *sql.DB) error {
+	token, err := hashing.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	err = CreateEmailVerificationTokenInDB(userId, email, hashing.HashToken(token), time.Now().Add(emailVerificationTokenLifeTime), db)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: "Hi " + username + ",\n\n" +
+			"please confirm that this is your email address by opening the following link. The link is valid for 24 hours.\n\n" +
+			links.EmailVerificationLink(token) + "\n\n" +
+			"If you didn't create an enguete account or change your email, you can ignore this mail.",
+	})
+}
+
+// reserveSignInAttempt counts the attempt for the ip address and the account before the credentials are checked and
+// returns how long to wait if one of them is over its limit. The account is counted even if it doesn't exist, so
+// locked and unknown accounts can't be told apart. A failed attempt stays counted, a successful one is given back
+// with releaseSignInAttempt.
+func reserveSignInAttempt(accountKey string, ipKey string) (time.Duration, error) {
+	retryAfter, err := throttle.SignInIpLimiter.Reserve(ipKey)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+	return throttle.SignInAccountLimiter.Reserve(accountKey)
+}
+
+// releaseSignInAttempt resets the account after a successful sign in and takes back the attempt of the ip address,
+// which other users may share.
+func releaseSignInAttempt(accountKey string, ipKey string) error {
+	err := throttle.SignInAccountLimiter.Reset(accountKey)
+	if err != nil {
+		return err
+	}
+	return throttle.SignInIpLimiter.Release(ipKey)
+}
+
+// releasePasswordAttempt gives back the attempt of a correct password. With two-factor authentication the account stays
+// counted until the code is checked as well, otherwise entering the password again would clear the lockout of the
+// code guesses.
+func releasePasswordAttempt(accountKey string, ipKey string, twoFactorEnabled bool) error {
+	if twoFactorEnabled {
+		return throttle.SignInIpLimiter.Release(ipKey)
+	}
+	return releaseSignInAttempt(accountKey, ipKey)
+}
+
+func respondWithTooManySignInAttempts(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	responses.HttpErrorResponse(c.Writer, http.StatusTooManyRequests, frontendErrors.TooManySignInAttemptsError, "Too many failed sign in attempts, try again later")
+}
+
+// startSession creates a new session for the user and sets the Authorization and RefreshToken headers.
+func startSession(c *gin.Context, jwtUserData jwt.JWTUser, db *sql.DB) error {
+	refreshToken, sessionId, err := jwt.CreateRefreshToken(jwtUserData, auth.GetSessionInfoFromRequest(c), db)
+	if err != nil {
+		return err
+	}
+	jwtUserData.SessionId = sessionId
+
+	jwtToken, err := jwt.CreateToken(jwtUserData)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Authorization", jwtToken)
+	c.Header("RefreshToken", refreshToken)
+	return nil
+}
+
+// completeSignIn finishes a sign in after the user proved their identity. With two-factor authentication enabled
+// only a challenge token for /auth/signin/2fa is returned, otherwise the session gets started.
+func completeSignIn(c *gin.Context, jwtUserData jwt.JWTUser, db *sql.DB) {
+	twoFactorEnabled, err := IsTwoFactorEnabled(jwtUserData.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if twoFactorEnabled {
+		challengeToken, err := jwt.CreateChallengeToken(jwtUserData, jwt.TwoFactorChallengePurpose)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		c.JSON(http.StatusOK, ResponseTwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: challengeToken})
+		return
+	}
+
+	err = startSession(c, jwtUserData, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Sign in successfully"})
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes. Only the hashes get stored.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	codeHashes := make([]string, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for range recoveryCodeCount {
+		raw := make([]byte, 7)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		codeHashes = append(codeHashes, hashing.HashToken(code))
+	}
+	return codes, codeHashes, nil
+}
+
+// normalizeRecoveryCode makes the comparison ignore case and the dash, so users can type the code as they like.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code. Both can only be used once.
+func checkSecondFactor(userId string, code string, db *sql.DB) (bool, error) {
+	twoFactor, err := GetTwoFactorFromDB(userId, db)
+	if err != nil {
+		return false, err
+	}
+
+	secret, err := hashing.DecryptSecret(twoFactor.EncryptedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	isValid, step, err := totp.Validate(secret, code, time.Now(), twoFactor.LastUsedStep)
+	if err != nil {
+		return false, err
+	}
+	if isValid {
+		err = UseTwoFactorStepInDB(userId, step, db)
+		if errors.Is(err, ErrTwoFactorCodeAlreadyUsed) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if !twoFactor.Enabled {
+		return false, nil
+	}
+	return UseRecoveryCodeInDB(userId, hashing.HashToken(normalizeRecoveryCode(code)), db)
+}
+
+// generateUsernameForIdentity picks a free username for an account created by an identity provider sign in,
+// based on the preferred username, the name or the email of the identity.
+func generateUsernameForIdentity(claims oidc.Claims, db *sql.DB) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = claims.Name
+	}
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.TrimSpace(base)
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 90 {
+		base = base[:90]
+	}
+
+	username := base
+	for range 10 {
+		userId, err := GetUserIdByName(username, db)
+		if err != nil {
+			return "", err
+		}
+		if userId == "" {
+			return username, nil
+		}
+
+		suffix := make([]byte, 2)
+		_, err = rand.Read(suffix)
+		if err != nil {
+			return "", err
+		}
+		username = base + strconv.Itoa(int(suffix[0])<<8|int(suffix[1]))
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// startOidcFlow stores a new login state and returns the url of the identity provider. linkUserId is empty for sign ins.
+func startOidcFlow(c *gin.Context, providerName string, linkUserId string, db *sql.DB) (string, error) {
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	binding, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	err = CreateOidcLoginStateInDB(OidcLoginState{
+		StateHash:    hashing.HashToken(state),
+		BindingHash:  hashing.HashToken(binding),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserId:   linkUserId,
+		ExpiresAt:    time.Now().Add(oidcLoginStateLifeTime),
+	}, db)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationUrl, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, binding, int(oidcLoginStateLifeTime.Seconds()), "/", "", true, true)
+	return authorizationUrl, nil
+}
+
+// finishOidcFlow consumes the state of the callback, checks that it was started by this browser and by linkUserId,
+// which is empty for sign ins, and redeems the code.
+//
+// return false => the error response was written
+func finishOidcFlow(c *gin.Context, request RequestOidcCallback, linkUserId string, db *sql.DB) (*oidc.Provider, oidc.Claims, bool) {
+	binding, cookieErr := c.Cookie(oidcBindingCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, "", -1, "/", "", true, true)
+
+	state, err := ConsumeOidcLoginStateFromDB(hashing.HashToken(request.State), db)
+	if err != nil && !errors.Is(err, ErrOidcStateInvalid) {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return nil, oidc.Claims{}, false
+	}
+	isBound := cookieErr == nil && subtle.ConstantTimeCompare([]byte(hashing.HashToken(binding)), []byte(state.BindingHash)) == 1
+	if err != nil || !isBound || state.LinkUserId != linkUserId {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidOidcStateError, "The sign in expired, please try again")
+		return nil, oidc.Claims{}, false
+	}
+
+	provider, err := oidc.GetProvider(state.Provider)
+	if err != nil {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.UnknownIdentityProviderError, "Unknown identity provider")
+		return nil, oidc.Claims{}, false
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), request.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Println(err)
+		responses.HttpErrorResponse(c.Writer, http.StatusUnauthorized, frontendErrors.IdentityProviderError, "The identity provider did not confirm the sign in")
+		return nil, oidc.Claims{}, false
+	}
+	return provider, claims, true
+}
+
+func respondWithOidcStartError(c *gin.Context, err error) {
+	if errors.Is(err, oidc.ErrUnknownProvider) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.UnknownIdentityProviderError, "Unknown identity provider")
+		return
+	}
+	log.Println(err)
+	responses.HttpErrorResponse(c.Writer, http.StatusBadGateway, frontendErrors.IdentityProviderError, "The identity provider is not reachable")
+}
+
+// filterGroupCardsForToken removes the groups a personal access token is not limited to.
+func filterGroupCardsForToken(groups []GroupCard, jwtPayload jwt.JWTPayload) []GroupCard {
+	return slices.DeleteFunc(groups, func(group GroupCard) bool {
+		return !jwtPayload.CanAccessGroup(group.GroupId)
+	})
+}
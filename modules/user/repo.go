@@ -2,8 +2,11 @@ package user
 
 import (
 	"database/sql"
+	"enguete/util/waitlist"
 	"errors"
+	"github.com/lib/pq"
 	"log"
+	"time"
 )
 
 func GetUserIdByName(username string, db *sql.DB) (string, error) {
@@ -54,7 +57,10 @@ func GetUserByIdFromDB(userId string, db *sql.DB) (UserFromDB, error) {
     			username,
     			email,
     			password_hash,
-    			user_id
+    			user_id,
+    			email_verified_at IS NOT NULL,
+    			COALESCE(pending_email, ''),
+    			has_password
     		FROM
     		    users
     		WHERE user_id = $1
@@ -63,7 +69,7 @@ func GetUserByIdFromDB(userId string, db *sql.DB) (UserFromDB, error) {
 	row := db.QueryRow(query, userId)
 
 	var userData UserFromDB
-	err := row.Scan(&userData.Username, &userData.Email, &userData.PasswordHash, &userData.UserId)
+	err := row.Scan(&userData.Username, &userData.Email, &userData.PasswordHash, &userData.UserId, &userData.EmailVerified, &userData.PendingEmail, &userData.HasPassword)
 	if errors.Is(err, sql.ErrNoRows) {
 		return UserFromDB{}, ErrUserNotFound
 	}
@@ -198,12 +204,7 @@ func DeleteUserInDB(userId string, db *sql.DB) error {
 		return err
 	}
 
-	updateMealPreferencesQuery := `
-		UPDATE meal_preferences
-		SET deleted_at = NOW()
-		WHERE user_id = $1 AND deleted_at IS NULL
-	`
-	_, err = tx.Exec(updateMealPreferencesQuery, userId)
+	err = removeMealPreferencesWithTransaction(userId, tx)
 	if err != nil {
 		transactionErr := tx.Rollback()
 		if transactionErr != nil {
@@ -242,3 +243,820 @@ func DeleteUserInDB(userId string, db *sql.DB) error {
 	}
 	return nil
 }
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// GetActiveSessionsOfUserFromDB returns one entry per token family that still has a usable refresh token.
+// The device information is taken from the newest token, as it gets updated on every refresh.
+func GetActiveSessionsOfUserFromDB(userId string, db *sql.DB) ([]Session, error) {
+	query := `
+		SELECT * FROM (
+			SELECT DISTINCT ON (rt.family_id)
+				rt.family_id,
+				COALESCE(rt.device_name, ''),
+				COALESCE(rt.user_agent, ''),
+				COALESCE(rt.ip_address, ''),
+				family.started_at,
+				rt.created_at AS last_used_at
+			FROM refresh_tokens rt
+			INNER JOIN (
+				SELECT family_id, MIN(created_at) AS started_at
+				FROM refresh_tokens
+				WHERE user_id = $1
+				GROUP BY family_id
+			) family ON family.family_id = rt.family_id
+			WHERE rt.user_id = $1
+			AND rt.revoked_at IS NULL
+			AND rt.last_used IS NULL
+			AND rt.life_time > NOW()
+			ORDER BY rt.family_id, rt.created_at DESC
+		) sessions
+		ORDER BY last_used_at DESC
+	`
+	rows, err := db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.SessionId,
+			&session.DeviceName,
+			&session.UserAgent,
+			&session.IpAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func RevokeSessionInDB(sessionId string, userId string, db *sql.DB) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1
+		AND user_id = $2
+		AND revoked_at IS NULL
+	`
+	result, err := db.Exec(query, sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func RevokeOtherSessionsInDB(userId string, currentSessionId string, db *sql.DB) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1
+		AND family_id <> $2
+		AND revoked_at IS NULL
+	`
+	_, err := db.Exec(query, userId, currentSessionId)
+	return err
+}
+
+var ErrPasswordResetTokenInvalid = errors.New("password reset token is invalid, expired or already used")
+
+func GetUserByEmailFromDB(email string, db *sql.DB) (UserFromDB, error) {
+	query := `SELECT
+				username,
+				email,
+				password_hash,
+				user_id
+			FROM
+				users
+			WHERE LOWER(email) = LOWER($1)
+			AND deleted_at IS NULL
+	`
+	var userData UserFromDB
+	err := db.QueryRow(query, email).Scan(&userData.Username, &userData.Email, &userData.PasswordHash, &userData.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserFromDB{}, ErrUserNotFound
+	}
+	return userData, err
+}
+
+// CreatePasswordResetTokenInDB stores a new reset token and invalidates all older unused tokens of the user,
+// so only the link of the latest mail works.
+func CreatePasswordResetTokenInDB(userId string, tokenHash string, expiresAt time.Time, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	invalidateQuery := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1
+		AND used_at IS NULL
+	`
+	_, err = tx.Exec(invalidateQuery, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err = tx.Exec(insertQuery, userId, tokenHash, expiresAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPasswordWithTokenInDB consumes the reset token, sets the new password and revokes every refresh token of the user
+// in one transaction. A token can only be used once, even if two requests arrive at the same time.
+func ResetPasswordWithTokenInDB(tokenHash string, passwordHash string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	selectQuery := `
+		SELECT prt.password_reset_token_id, prt.user_id
+		FROM password_reset_tokens prt
+		INNER JOIN users u ON u.user_id = prt.user_id
+		WHERE prt.token_hash = $1
+		AND prt.used_at IS NULL
+		AND prt.expires_at > NOW()
+		AND u.deleted_at IS NULL
+		FOR UPDATE OF prt
+	`
+	var tokenId, userId string
+	err = tx.QueryRow(selectQuery, tokenHash).Scan(&tokenId, &userId)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPasswordResetTokenInvalid
+		}
+		return err
+	}
+
+	useTokenQuery := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE password_reset_token_id = $1
+	`
+	_, err = tx.Exec(useTokenQuery, tokenId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	updatePasswordQuery := `
+		UPDATE users
+		SET password_hash = $1, has_password = TRUE
+		WHERE user_id = $2
+	`
+	_, err = tx.Exec(updatePasswordQuery, passwordHash, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	revokeSessionsQuery := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1
+		AND revoked_at IS NULL
+	`
+	_, err = tx.Exec(revokeSessionsQuery, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// a reset means the account might have been taken over, so tokens created by someone else stop working too
+	revokeApiTokensQuery := `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1
+		AND revoked_at IS NULL
+	`
+	_, err = tx.Exec(revokeApiTokensQuery, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var ErrEmailVerificationTokenInvalid = errors.New("email verification token is invalid, expired or already used")
+var ErrEmailAlreadyInUse = errors.New("email is already used by another account")
+
+func CheckIfEmailIsInUse(email string, db *sql.DB) (bool, error) {
+	query := `SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER($1)`
+	var count int
+	err := db.QueryRow(query, email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateEmailVerificationTokenInDB stores a new verification token for the address and invalidates the older unused tokens of the user.
+func CreateEmailVerificationTokenInDB(userId string, email string, tokenHash string, expiresAt time.Time, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	invalidateQuery := `
+		UPDATE email_verification_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1
+		AND used_at IS NULL
+	`
+	_, err = tx.Exec(invalidateQuery, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.Exec(insertQuery, userId, email, tokenHash, expiresAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmailWithTokenInDB consumes the token and marks the address as verified.
+// If the token belongs to the pending address of an email change, the pending address becomes the email of the user.
+// Tokens for an address the user no longer has (current or pending) are rejected.
+func VerifyEmailWithTokenInDB(tokenHash string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	selectQuery := `
+		SELECT email_verification_token_id, user_id, email
+		FROM email_verification_tokens
+		WHERE token_hash = $1
+		AND used_at IS NULL
+		AND expires_at > NOW()
+		FOR UPDATE
+	`
+	var tokenId, userId, email string
+	err = tx.QueryRow(selectQuery, tokenHash).Scan(&tokenId, &userId, &email)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEmailVerificationTokenInvalid
+		}
+		return err
+	}
+
+	useTokenQuery := `
+		UPDATE email_verification_tokens
+		SET used_at = NOW()
+		WHERE email_verification_token_id = $1
+	`
+	_, err = tx.Exec(useTokenQuery, tokenId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	verifyQuery := `
+		UPDATE users
+		SET email = $2,
+		    email_verified_at = NOW(),
+		    pending_email = CASE WHEN LOWER(pending_email) = LOWER($2) THEN NULL ELSE pending_email END
+		WHERE user_id = $1
+		AND deleted_at IS NULL
+		AND (LOWER(email) = LOWER($2) OR LOWER(pending_email) = LOWER($2))
+	`
+	result, err := tx.Exec(verifyQuery, userId, email)
+	if err != nil {
+		_ = tx.Rollback()
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrEmailAlreadyInUse
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if rowsAffected == 0 {
+		_ = tx.Rollback()
+		return ErrEmailVerificationTokenInvalid
+	}
+
+	return tx.Commit()
+}
+
+func SetPendingEmailInDB(userId string, email string, db *sql.DB) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1
+		WHERE user_id = $2
+		AND deleted_at IS NULL
+	`
+	result, err := db.Exec(query, email, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+var ErrTwoFactorNotFound = errors.New("two-factor authentication is not set up")
+var ErrTwoFactorCodeAlreadyUsed = errors.New("two-factor code was already used")
+
+func GetTwoFactorFromDB(userId string, db *sql.DB) (TwoFactorFromDB, error) {
+	query := `
+		SELECT secret_encrypted, enabled_at IS NOT NULL, last_used_step
+		FROM user_two_factor
+		WHERE user_id = $1
+	`
+	var twoFactor TwoFactorFromDB
+	err := db.QueryRow(query, userId).Scan(&twoFactor.EncryptedSecret, &twoFactor.Enabled, &twoFactor.LastUsedStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return twoFactor, ErrTwoFactorNotFound
+	}
+	return twoFactor, err
+}
+
+// IsTwoFactorEnabled reports whether the user completed the two-factor enrollment.
+func IsTwoFactorEnabled(userId string, db *sql.DB) (bool, error) {
+	twoFactor, err := GetTwoFactorFromDB(userId, db)
+	if errors.Is(err, ErrTwoFactorNotFound) {
+		return false, nil
+	}
+	return twoFactor.Enabled, err
+}
+
+// SaveTwoFactorEnrollmentInDB stores a new secret for an enrollment that isn't finished yet.
+// An already enabled secret is never replaced.
+func SaveTwoFactorEnrollmentInDB(userId string, encryptedSecret string, db *sql.DB) error {
+	query := `
+		INSERT INTO user_two_factor (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted,
+		    last_used_step = 0
+		WHERE user_two_factor.enabled_at IS NULL
+	`
+	_, err := db.Exec(query, userId, encryptedSecret)
+	return err
+}
+
+// UseTwoFactorStepInDB remembers the time step of an accepted code. It fails if the step, or a later one, was already used,
+// which also covers two requests with the same code at the same time.
+func UseTwoFactorStepInDB(userId string, step int64, db *sql.DB) error {
+	query := `
+		UPDATE user_two_factor
+		SET last_used_step = $2
+		WHERE user_id = $1
+		AND last_used_step < $2
+	`
+	result, err := db.Exec(query, userId, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorCodeAlreadyUsed
+	}
+	return nil
+}
+
+// EnableTwoFactorInDB finishes the enrollment and stores the first set of recovery codes.
+func EnableTwoFactorInDB(userId string, recoveryCodeHashes []string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE user_two_factor
+		SET enabled_at = NOW()
+		WHERE user_id = $1
+		AND enabled_at IS NULL
+	`
+	_, err = tx.Exec(query, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = replaceRecoveryCodesWithTransaction(userId, recoveryCodeHashes, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func ReplaceRecoveryCodesInDB(userId string, recoveryCodeHashes []string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodesWithTransaction(userId, recoveryCodeHashes, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodesWithTransaction(userId string, recoveryCodeHashes []string, tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO two_factor_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.Exec(insertQuery, userId, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCodeInDB marks the recovery code as used. It returns false if the code doesn't exist or was used before.
+func UseRecoveryCodeInDB(userId string, codeHash string, db *sql.DB) (bool, error) {
+	query := `
+		UPDATE two_factor_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1
+		AND code_hash = $2
+		AND used_at IS NULL
+	`
+	result, err := db.Exec(query, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func DeleteTwoFactorInDB(userId string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_two_factor WHERE user_id = $1`, userId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var ErrOidcStateInvalid = errors.New("oidc login state is invalid or expired")
+var ErrIdentityNotFound = errors.New("identity not found")
+var ErrIdentityAlreadyLinked = errors.New("identity is already linked to an account")
+
+// CreateOidcLoginStateInDB stores a pending identity provider sign in. Expired states of abandoned sign ins are removed on the way.
+func CreateOidcLoginStateInDB(state OidcLoginState, db *sql.DB) error {
+	_, err := db.Exec(`DELETE FROM oidc_login_states WHERE expires_at < NOW()`)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, binding_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, $7)
+	`
+	_, err = db.Exec(query, state.StateHash, state.BindingHash, state.Provider, state.Nonce, state.CodeVerifier, state.LinkUserId, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOidcLoginStateFromDB deletes and returns the state, so every state can only be used for one callback.
+func ConsumeOidcLoginStateFromDB(stateHash string, db *sql.DB) (OidcLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING binding_hash, provider, nonce, code_verifier, COALESCE(link_user_id::text, ''), expires_at
+	`
+	state := OidcLoginState{StateHash: stateHash}
+	err := db.QueryRow(query, stateHash).Scan(&state.BindingHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.LinkUserId, &state.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, ErrOidcStateInvalid
+	}
+	if err != nil {
+		return state, err
+	}
+	if !state.ExpiresAt.After(time.Now()) {
+		return state, ErrOidcStateInvalid
+	}
+	return state, nil
+}
+
+func GetUserByIdentityFromDB(provider string, subject string, db *sql.DB) (UserFromDB, error) {
+	query := `
+		SELECT u.username, u.email, u.user_id
+		FROM user_identities ui
+		INNER JOIN users u ON u.user_id = ui.user_id
+		WHERE ui.provider = $1
+		AND ui.subject = $2
+		AND u.deleted_at IS NULL
+	`
+	var userData UserFromDB
+	err := db.QueryRow(query, provider, subject).Scan(&userData.Username, &userData.Email, &userData.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserFromDB{}, ErrIdentityNotFound
+	}
+	return userData, err
+}
+
+func UpdateIdentityLoginInDB(provider string, subject string, email string, db *sql.DB) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = NOW(), email = NULLIF($3, '')
+		WHERE provider = $1
+		AND subject = $2
+	`
+	_, err := db.Exec(query, provider, subject, email)
+	return err
+}
+
+// CreateUserWithIdentityInDB creates the account for the first sign in with an identity provider.
+// The account has no usable password until the user sets one with the forgot password flow.
+func CreateUserWithIdentityInDB(userData DBNewUser, emailVerified bool, provider string, subject string, db *sql.DB) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	createUserQuery := `
+		INSERT INTO users (username, email, password_hash, has_password, email_verified_at)
+		VALUES ($1, $2, $3, FALSE, CASE WHEN $4 THEN NOW() END)
+		RETURNING user_id
+	`
+	var userId string
+	err = tx.QueryRow(createUserQuery, userData.username, userData.email, userData.password_hash, emailVerified).Scan(&userId)
+	if err != nil {
+		_ = tx.Rollback()
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return "", ErrEmailAlreadyInUse
+		}
+		return "", err
+	}
+
+	err = linkIdentityWithTransaction(userId, provider, subject, userData.email, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	return userId, tx.Commit()
+}
+
+func LinkIdentityToUserInDB(userId string, provider string, subject string, email string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = linkIdentityWithTransaction(userId, provider, subject, email, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func linkIdentityWithTransaction(userId string, provider string, subject string, email string, tx *sql.Tx) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+	`
+	_, err := tx.Exec(query, userId, provider, subject, email)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrIdentityAlreadyLinked
+	}
+	return err
+}
+
+func GetUserIdentitiesFromDB(userId string, db *sql.DB) ([]Identity, error) {
+	query := `
+		SELECT provider, COALESCE(email, ''), created_at, COALESCE(last_login_at::text, '')
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(&identity.Provider, &identity.Email, &identity.LinkedAt, &identity.LastLoginAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func UnlinkIdentityInDB(userId string, provider string, db *sql.DB) error {
+	query := `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`
+	result, err := db.Exec(query, userId, provider)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+var ErrApiTokenNotFound = errors.New("api token not found")
+
+func CheckIfUserIsMemberOfGroup(userId string, groupId string, db *sql.DB) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_groups ug
+			INNER JOIN groups g ON g.group_id = ug.group_id
+			WHERE ug.user_id = $1
+			AND ug.group_id = $2
+			AND ug.deleted_at IS NULL
+			AND g.deleted_at IS NULL
+		)
+	`
+	var isMember bool
+	err := db.QueryRow(query, userId, groupId).Scan(&isMember)
+	return isMember, err
+}
+
+func CreateApiTokenInDB(userId string, request RequestCreateApiToken, tokenHash string, tokenHint string, expiresAt *time.Time, db *sql.DB) (ApiToken, error) {
+	query := `
+		INSERT INTO api_tokens (user_id, group_id, name, token_hash, token_hint, scopes, expires_at)
+		VALUES ($1, NULLIF($2, '')::UUID, $3, $4, $5, $6, $7)
+		RETURNING api_token_id, created_at
+	`
+	apiToken := ApiToken{
+		Name:      request.Name,
+		TokenHint: tokenHint,
+		Scopes:    request.Scopes,
+		GroupId:   request.GroupId,
+		ExpiresAt: expiresAt,
+	}
+	err := db.QueryRow(query, userId, request.GroupId, request.Name, tokenHash, tokenHint, pq.Array(request.Scopes), expiresAt).Scan(
+		&apiToken.TokenId,
+		&apiToken.CreatedAt,
+	)
+	return apiToken, err
+}
+
+// GetApiTokensOfUserFromDB returns the tokens that are not revoked, expired ones are included so the user sees why a script stopped working.
+func GetApiTokensOfUserFromDB(userId string, db *sql.DB) ([]ApiToken, error) {
+	query := `
+		SELECT api_token_id, name, token_hint, scopes, COALESCE(group_id::TEXT, ''), expires_at, last_used_at, created_at
+		FROM api_tokens
+		WHERE user_id = $1
+		AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiTokens := []ApiToken{}
+	for rows.Next() {
+		var apiToken ApiToken
+		err := rows.Scan(
+			&apiToken.TokenId,
+			&apiToken.Name,
+			&apiToken.TokenHint,
+			pq.Array(&apiToken.Scopes),
+			&apiToken.GroupId,
+			&apiToken.ExpiresAt,
+			&apiToken.LastUsedAt,
+			&apiToken.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		apiTokens = append(apiTokens, apiToken)
+	}
+	return apiTokens, rows.Err()
+}
+
+func RevokeApiTokenInDB(tokenId string, userId string, db *sql.DB) error {
+	query := `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE api_token_id = $1
+		AND user_id = $2
+		AND revoked_at IS NULL
+	`
+	result, err := db.Exec(query, tokenId, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrApiTokenNotFound
+	}
+	return nil
+}
+
+// removeMealPreferencesWithTransaction removes all preferences of the user, the seats of their confirmed opt-ins go to
+// the waitlist.
+func removeMealPreferencesWithTransaction(userId string, tx *sql.Tx) error {
+	query := `
+		WITH removed AS (
+			UPDATE meal_preferences
+			SET deleted_at = NOW()
+			WHERE user_id = $1 AND deleted_at IS NULL
+			RETURNING meal_id, preference, waitlisted_at
+		)
+		SELECT meal_id FROM removed WHERE preference = 'opt-in' AND waitlisted_at IS NULL
+	`
+	rows, err := tx.Query(query, userId)
+	if err != nil {
+		return err
+	}
+	freedMealIds, err := waitlist.ScanMealIds(rows)
+	if err != nil {
+		return err
+	}
+	return waitlist.PromoteMealsWithTransaction(freedMealIds, tx)
+}
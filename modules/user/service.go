@@ -6,12 +6,19 @@ import (
 	"enguete/util/frontendErrors"
 	"enguete/util/hashing"
 	"enguete/util/jwt"
+	"enguete/util/links"
+	"enguete/util/mailer"
+	"enguete/util/oidc"
 	"enguete/util/responses"
+	"enguete/util/roles"
+	"enguete/util/totp"
 	"enguete/util/validation"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // SignUp godoc
@@ -35,19 +42,7 @@ func SignUp(c *gin.Context, db *sql.DB) {
 	}
 	err := validation.IsValidPassword(newUser.Password)
 	if err != nil {
-		if errors.Is(err, validation.PasswordFormatNeedsUpperLowerSpecialError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatNeedsUpperLowerSpecialError, "Password needs Upper, lower and special characters and at least one number")
-			return
-		}
-		if errors.Is(err, validation.PasswordFormatTooShortError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooShortError, "The Password needs to be at least 8 letters long")
-			return
-		}
-		if errors.Is(err, validation.PasswordToLongError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooLongError, "The Password is to long, max length is 127 letters")
-			return
-		}
-		responses.GenericUnauthorizedError(c.Writer)
+		respondWithPasswordValidationError(c, err)
 		return
 	}
 
@@ -81,28 +76,25 @@ func SignUp(c *gin.Context, db *sql.DB) {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	jwtUserData := jwt.JWTUser{
-		Username: userInDB.username,
-		UserId:   newUserId,
-	}
 
-	refreshToken, err := jwt.CreateRefreshToken(jwtUserData, true, db)
+	err = sendEmailVerificationMail(newUserId, newUser.Username, newUser.Email, db)
 	if err != nil {
+		// the account exists at this point, the user can request a new mail later on
 		log.Println(err)
-		responses.GenericInternalServerError(c.Writer)
-		return
 	}
 
-	jwtToken, err := jwt.CreateToken(jwtUserData)
+	jwtUserData := jwt.JWTUser{
+		Username: userInDB.username,
+		UserId:   newUserId,
+	}
+
+	err = startSession(c, jwtUserData, db)
 	if err != nil {
 		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	c.Header("Authorization", jwtToken)
-	c.Header("RefreshToken", refreshToken)
-
 	c.JSON(http.StatusOK, MessageResponse{Message: "Sign up successfully"})
 }
 
@@ -114,7 +106,9 @@ func SignUp(c *gin.Context, db *sql.DB) {
 // @Produce json
 // @Param user body SignInCredentials true "Sign-in credentials"
 // @Success 200 {object} jwt.JWTTokenResponse
+// @Success 200 {object} ResponseTwoFactorChallenge "Two-factor authentication is enabled, continue with /auth/signin/2fa"
 // @Failure 401 {object} UserError "Invalid username or password"
+// @Failure 429 {object} UserError "Too many failed attempts, retry after the time in the Retry-After header"
 // @Failure 500 {object} UserError "Server error during sign-in"
 // @Router /auth/signin [post]
 func SignIn(c *gin.Context, db *sql.DB) {
@@ -126,53 +120,154 @@ func SignIn(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	userData, err := GetUserByName(credentials.Username, db)
+	accountKey := strings.ToLower(credentials.Username)
+	ipKey := c.ClientIP()
+
+	retryAfter, err := reserveSignInAttempt(accountKey, ipKey)
 	if err != nil {
 		log.Println(err)
-		if errors.Is(err, ErrUserNotFound) {
-			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
-			return
-		}
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithTooManySignInAttempts(c, retryAfter)
+		return
+	}
+
+	userData, err := GetUserByName(credentials.Username, db)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
-	if !hashing.CheckHashedString(userData.PasswordHash, credentials.Password) {
+	if errors.Is(err, ErrUserNotFound) {
+		hashing.CompareWithDummyHash(credentials.Password)
+	}
+	if err != nil || !hashing.CheckHashedString(userData.PasswordHash, credentials.Password) {
 		responses.HttpErrorResponse(c.Writer, http.StatusUnauthorized, frontendErrors.WrongUsernameOrPasswordError, "Wrong Username Or Password")
 		return
 	}
 
+	twoFactorEnabled, err := IsTwoFactorEnabled(userData.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = releasePasswordAttempt(accountKey, ipKey, twoFactorEnabled)
+	if err != nil {
+		log.Println(err)
+	}
+
 	jwtUserData := jwt.JWTUser{
 		Username: userData.Username,
 		UserId:   userData.UserId,
 	}
 
-	refreshToken, err := jwt.CreateRefreshToken(jwtUserData, false, db)
+	completeSignIn(c, jwtUserData, db)
+}
+
+// SignInWithTwoFactor godoc
+// @Summary Finish a sign in with two-factor authentication
+// @Description Second step of the sign in for accounts with two-factor authentication. Takes the challenge token of /auth/signin and a code of the authenticator app or a recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RequestTwoFactorSignIn true "Challenge token and code"
+// @Success 200 {object} jwt.JWTTokenResponse
+// @Failure 400 {object} UserError "Invalid request"
+// @Failure 401 {object} UserError "Invalid or expired challenge token or wrong code"
+// @Failure 429 {object} UserError "Too many failed attempts, retry after the time in the Retry-After header"
+// @Failure 500 {object} UserError "Server error during sign-in"
+// @Router /auth/signin/2fa [post]
+func SignInWithTwoFactor(c *gin.Context, db *sql.DB) {
+	var request RequestTwoFactorSignIn
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	challenge, err := jwt.VerifyChallengeToken(request.ChallengeToken, jwt.TwoFactorChallengePurpose)
+	if err != nil {
+		responses.HttpErrorResponse(c.Writer, http.StatusUnauthorized, frontendErrors.InvalidChallengeTokenError, "The sign in expired, please sign in again")
+		return
+	}
+
+	accountKey := strings.ToLower(challenge.UserName)
+	ipKey := c.ClientIP()
+
+	retryAfter, err := reserveSignInAttempt(accountKey, ipKey)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithTooManySignInAttempts(c, retryAfter)
+		return
+	}
+
+	isValid, err := checkSecondFactor(challenge.UserId, request.Code, db)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
+	if !isValid {
+		responses.HttpErrorResponse(c.Writer, http.StatusUnauthorized, frontendErrors.InvalidTwoFactorCodeError, "Invalid code")
+		return
+	}
+
+	err = releaseSignInAttempt(accountKey, ipKey)
+	if err != nil {
+		log.Println(err)
+	}
 
-	jwtToken, err := jwt.CreateToken(jwtUserData)
+	err = startSession(c, jwt.JWTUser{Username: challenge.UserName, UserId: challenge.UserId}, db)
 	if err != nil {
+		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
-	c.Header("Authorization", jwtToken)
-	c.Header("RefreshToken", refreshToken)
 
 	c.JSON(http.StatusOK, MessageResponse{Message: "Sign in successfully"})
 }
 
+// Logout godoc
+// @Summary Log out of the current session
+// @Description Revokes the session of the given refresh token. Without a refresh token the session of the access token gets revoked.
+// @Tags users
+// @Produce json
+// @Param RefreshToken header string false "Refresh token of the session"
+// @Param Authorization header string false "JWT Token"
+// @Success 200 {object} MessageResponse
+// @Failure 401 {object} UserError "Neither a refresh token nor a valid access token"
+// @Failure 500 {object} UserError "Server error during logout"
+// @Router /auth/logout [post]
 func Logout(c *gin.Context, db *sql.DB) {
 	refreshToken, err := auth.GetRefreshTokenFromHeader(c)
-	if err != nil {
+	if err == nil {
+		err = jwt.VoidRefreshTokenInDB(refreshToken, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+
+		c.JSON(http.StatusOK, MessageResponse{Message: "Logout successfully"})
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+	if jwtPayload.SessionId == "" {
 		responses.GenericUnauthorizedError(c.Writer)
 		return
 	}
 
-	err = jwt.VoidRefreshTokenInDB(refreshToken, db)
-	if err != nil {
+	err = RevokeSessionInDB(jwtPayload.SessionId, jwtPayload.UserId, db)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
 		log.Println(err)
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -181,14 +276,154 @@ func Logout(c *gin.Context, db *sql.DB) {
 	c.JSON(http.StatusOK, MessageResponse{Message: "Logout successfully"})
 }
 
-func CheckAuth(c *gin.Context, db *sql.DB) {
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
+// passwordResetTokenLifeTime is how long the link of a forgot password mail can be used.
+const passwordResetTokenLifeTime = time.Hour
+
+// ForgotPassword godoc
+// @Summary Request a password reset mail
+// @Description Sends a mail with a single use reset link to the address, if an account with it exists. The response is the same whether the account exists or not.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RequestForgotPassword true "Email address of the account"
+// @Success 200 {object} UserSuccess "Reset mail sent if the account exists"
+// @Failure 400 {object} UserError "Invalid email"
+// @Failure 500 {object} UserError "Server error creating the reset token"
+// @Router /auth/password/forgot [post]
+func ForgotPassword(c *gin.Context, db *sql.DB) {
+	var request RequestForgotPassword
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	successResponse := UserSuccess{Message: "If an account with this email exists, a reset link has been sent"}
+
+	userData, err := GetUserByEmailFromDB(request.Email, db)
 	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusOK, successResponse)
+			return
+		}
 		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	token, err := hashing.GenerateToken()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = CreatePasswordResetTokenInDB(userData.UserId, hashing.HashToken(token), time.Now().Add(passwordResetTokenLifeTime), db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = mailer.Send(mailer.Message{
+		To:      userData.Email,
+		Subject: "Reset your enguete password",
+		Body: "Hi " + userData.Username + ",\n\n" +
+			"use the following link to choose a new password. The link is valid for one hour and can only be used once.\n\n" +
+			links.PasswordResetLink(token) + "\n\n" +
+			"If you didn't request this, you can ignore this mail.",
+	})
+	if err != nil {
+		// the response must not reveal that the account exists, so a failed mail is only logged
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, successResponse)
+}
+
+// ResetPassword godoc
+// @Summary Reset the password with a token from the reset mail
+// @Description Sets a new password. The token can only be used once and every session of the user gets signed out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RequestResetPassword true "Reset token and new password"
+// @Success 200 {object} UserSuccess "Password reset"
+// @Failure 400 {object} UserError "Invalid password or invalid, expired or used token"
+// @Failure 500 {object} UserError "Server error resetting the password"
+// @Router /auth/password/reset [post]
+func ResetPassword(c *gin.Context, db *sql.DB) {
+	var request RequestResetPassword
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := validation.IsValidPassword(request.NewPassword)
+	if err != nil {
+		respondWithPasswordValidationError(c, err)
+		return
+	}
+
+	hashedPassword, err := hashing.HashPassword(request.NewPassword)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = ResetPasswordWithTokenInDB(hashing.HashToken(request.Token), hashedPassword, db)
+	if err != nil {
+		if errors.Is(err, ErrPasswordResetTokenInvalid) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidPasswordResetTokenError, "The reset link is invalid or expired")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Password reset successfully"})
+}
+
+// VerifyEmail godoc
+// @Summary Confirm an email address
+// @Description Confirms the address with the token from the verification mail. For a pending email change the new address replaces the old one.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RequestVerifyEmail true "Token from the verification mail"
+// @Success 200 {object} UserSuccess "Email verified"
+// @Failure 400 {object} UserError "Invalid, expired or used token or the email is already taken"
+// @Failure 500 {object} UserError "Server error verifying the email"
+// @Router /auth/email/verify [post]
+func VerifyEmail(c *gin.Context, db *sql.DB) {
+	var request RequestVerifyEmail
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := VerifyEmailWithTokenInDB(hashing.HashToken(request.Token), db)
+	if err != nil {
+		if errors.Is(err, ErrEmailVerificationTokenInvalid) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidEmailVerificationTokenError, "The verification link is invalid or expired")
+			return
+		}
+		if errors.Is(err, ErrEmailAlreadyInUse) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.EmailIsAlreadyTakenError, "Email is already taken")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
 		return
 	}
 
+	c.JSON(http.StatusOK, UserSuccess{Message: "Email verified successfully"})
+}
+
+func CheckAuth(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
 	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
 	if err != nil {
 		log.Println(err)
@@ -201,13 +436,27 @@ func CheckAuth(c *gin.Context, db *sql.DB) {
 	}
 
 	response := ResponseUserData{
-		UserID:   userData.UserId,
-		Username: userData.Username,
+		UserID:        userData.UserId,
+		Username:      userData.Username,
+		Email:         userData.Email,
+		EmailVerified: userData.EmailVerified,
+		PendingEmail:  userData.PendingEmail,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GetJWKS godoc
+// @Summary Get the public signing keys
+// @Description Returns the public keys used to sign tokens as a JSON Web Key Set. Only asymmetric keys are published.
+// @Tags users
+// @Produce json
+// @Success 200 {object} jwt.JWKSet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, jwt.GetJWKS())
+}
+
 // GetUserInformationById godoc
 // @Summary Get a user by ID
 // @Description Fetch user details by ID.
@@ -222,12 +471,7 @@ func CheckAuth(c *gin.Context, db *sql.DB) {
 // @Router /users/{userId} [get]
 func GetUserInformationById(c *gin.Context, db *sql.DB) {
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
 	if err != nil {
@@ -244,29 +488,29 @@ func GetUserInformationById(c *gin.Context, db *sql.DB) {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
+	groupData = filterGroupCardsForToken(groupData, jwtPayload)
 
 	response := ResponseUserData{
-		Username: userData.Username,
-		UserID:   userData.UserId,
-		Groups:   groupData,
+		Username:      userData.Username,
+		UserID:        userData.UserId,
+		Email:         userData.Email,
+		EmailVerified: userData.EmailVerified,
+		PendingEmail:  userData.PendingEmail,
+		Groups:        groupData,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 func GetUserGroups(c *gin.Context, db *sql.DB) {
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		log.Println(err)
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	groupData, err := GetUsersGroupByUserIdFromDB(jwtPayload.UserId, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
 	}
+	groupData = filterGroupCardsForToken(groupData, jwtPayload)
 	c.JSON(http.StatusOK, groupData)
 }
 
@@ -283,15 +527,10 @@ func GetUserGroups(c *gin.Context, db *sql.DB) {
 // @Router /users [delete]
 func DeleteUserWithJWT(c *gin.Context, db *sql.DB) {
 
-	decodedJWT, err := auth.GetJWTPayloadFromHeader(c, db)
-
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	decodedJWT := auth.GetJWTPayload(c)
 
 	// TODO: Do a email for validation and then handle the delete in another function
-	err = DeleteUserInDB(decodedJWT.UserId, db)
+	err := DeleteUserInDB(decodedJWT.UserId, db)
 	if err != nil {
 		responses.GenericInternalServerError(c.Writer)
 		return
@@ -325,11 +564,7 @@ func UpdateUsername(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	jwtTokenData, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtTokenData := auth.GetJWTPayload(c)
 	userId, err := GetUserIdByName(changeUsernameData.Username, db)
 
 	if userId != "" || err != nil {
@@ -373,27 +608,11 @@ func UpdateUserPassword(c *gin.Context, db *sql.DB) {
 
 	err := validation.IsValidPassword(updatePasswordData.NewPassword)
 	if err != nil {
-		if errors.Is(err, validation.PasswordFormatNeedsUpperLowerSpecialError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatNeedsUpperLowerSpecialError, "Password needs Upper, lower and special characters and at least one number")
-			return
-		}
-		if errors.Is(err, validation.PasswordFormatTooShortError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooShortError, "The Password needs to be at least 8 letters long")
-			return
-		}
-		if errors.Is(err, validation.PasswordToLongError) {
-			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordFormatTooLongError, "The Password is to long, max length is 127 letters")
-			return
-		}
-		responses.GenericUnauthorizedError(c.Writer)
+		respondWithPasswordValidationError(c, err)
 		return
 	}
 
-	jwtPayload, err := auth.GetJWTPayloadFromHeader(c, db)
-	if err != nil {
-		responses.GenericUnauthorizedError(c.Writer)
-		return
-	}
+	jwtPayload := auth.GetJWTPayload(c)
 
 	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
 	if err != nil {
@@ -420,5 +639,879 @@ func UpdateUserPassword(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if updatePasswordData.RevokeOtherSessions {
+		err = RevokeOtherSessionsInDB(jwtPayload.UserId, jwtPayload.SessionId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, UserSuccess{Message: "Password updated Successfully"})
 }
+
+// GetUserSessions godoc
+// @Summary List the active sessions of a user
+// @Description Lists every signed in device of the user with its device name, user agent, ip address and usage times.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {array} Session
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error retrieving sessions"
+// @Router /users/sessions [get]
+func GetUserSessions(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	sessions, err := GetActiveSessionsOfUserFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].IsCurrent = sessions[i].SessionId == jwtPayload.SessionId
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a single session
+// @Description Signs out the device of the given session. The device can't refresh its tokens anymore.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param sessionId query string true "Id of the session to revoke"
+// @Success 200 {object} UserSuccess "Session revoked"
+// @Failure 400 {object} UserError "Invalid session id"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 404 {object} UserError "Session not found"
+// @Failure 500 {object} UserError "Server error revoking the session"
+// @Router /users/sessions [delete]
+func RevokeSession(c *gin.Context, db *sql.DB) {
+	var request RequestSessionId
+	if err := c.ShouldBindQuery(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	err := RevokeSessionInDB(request.SessionId, jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.SessionDoesNotExistError, "Session does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Session revoked successfully"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Revoke all other sessions
+// @Description Signs out every device of the user except the one making the request.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {object} UserSuccess "Sessions revoked"
+// @Failure 400 {object} UserError "The access token does not belong to a session"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error revoking the sessions"
+// @Router /users/sessions/others [delete]
+func RevokeOtherSessions(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+	if jwtPayload.SessionId == "" {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	err := RevokeOtherSessionsInDB(jwtPayload.UserId, jwtPayload.SessionId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Other sessions revoked successfully"})
+}
+
+// ResendEmailVerification godoc
+// @Summary Resend the verification mail
+// @Description Sends a new verification mail to the pending address of an email change, or to the current address if it isn't verified yet.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {object} UserSuccess "Verification mail sent"
+// @Failure 400 {object} UserError "Email is already verified"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error sending the mail"
+// @Router /users/email/resend [post]
+func ResendEmailVerification(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	emailToVerify := userData.PendingEmail
+	if emailToVerify == "" {
+		if userData.EmailVerified {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.EmailIsAlreadyVerifiedError, "Email is already verified")
+			return
+		}
+		emailToVerify = userData.Email
+	}
+
+	err = sendEmailVerificationMail(userData.UserId, userData.Username, emailToVerify, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Verification mail sent"})
+}
+
+// UpdateEmail godoc
+// @Summary Change the email address
+// @Description Starts an email change. The new address is stored as pending and only replaces the current one after it got confirmed with the mailed link.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestChangeEmail true "New email and current password"
+// @Success 200 {object} UserSuccess "Verification mail sent to the new address"
+// @Failure 400 {object} UserError "Invalid email, wrong password or email already taken"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error changing the email"
+// @Router /users/email [put]
+func UpdateEmail(c *gin.Context, db *sql.DB) {
+	var request RequestChangeEmail
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !hashing.CheckHashedString(userData.PasswordHash, request.Password) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordDoesNotMatchError, "Wrong Password")
+		return
+	}
+
+	emailInUse, err := CheckIfEmailIsInUse(request.Email, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if emailInUse {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.EmailIsAlreadyTakenError, "Email is already taken")
+		return
+	}
+
+	err = SetPendingEmailInDB(userData.UserId, request.Email, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = sendEmailVerificationMail(userData.UserId, userData.Username, request.Email, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Verification mail sent to the new email"})
+}
+
+// EnrollTwoFactor godoc
+// @Summary Start the two-factor enrollment
+// @Description Creates a new TOTP secret. It is only used after the first code got confirmed with /users/2fa/verify.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {object} ResponseTwoFactorEnrollment
+// @Failure 400 {object} UserError "Two-factor authentication is already enabled"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error creating the secret"
+// @Router /users/2fa/enroll [post]
+func EnrollTwoFactor(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	twoFactorEnabled, err := IsTwoFactorEnabled(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if twoFactorEnabled {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorAlreadyEnabledError, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	encryptedSecret, err := hashing.EncryptSecret(secret)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = SaveTwoFactorEnrollmentInDB(jwtPayload.UserId, encryptedSecret, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseTwoFactorEnrollment{
+		Secret:     secret,
+		OtpauthUri: totp.URI(twoFactorIssuer, jwtPayload.UserName, secret),
+	})
+}
+
+// VerifyTwoFactorEnrollment godoc
+// @Summary Enable two-factor authentication
+// @Description Confirms the enrollment with the first code of the authenticator app and returns the recovery codes. The codes are only shown once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestTwoFactorCode true "Code of the authenticator app"
+// @Success 200 {object} ResponseRecoveryCodes
+// @Failure 400 {object} UserError "No enrollment started, already enabled or invalid code"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error enabling two-factor authentication"
+// @Router /users/2fa/verify [post]
+func VerifyTwoFactorEnrollment(c *gin.Context, db *sql.DB) {
+	var request RequestTwoFactorCode
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	twoFactor, err := GetTwoFactorFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorNotEnabledError, "Start the two-factor enrollment first")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if twoFactor.Enabled {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorAlreadyEnabledError, "Two-factor authentication is already enabled")
+		return
+	}
+
+	isValid, err := checkSecondFactor(jwtPayload.UserId, request.Code, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !isValid {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidTwoFactorCodeError, "Invalid code")
+		return
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = EnableTwoFactorInDB(jwtPayload.UserId, recoveryCodeHashes, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseRecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Create new recovery codes
+// @Description Replaces all recovery codes with new ones. Needs a current code of the authenticator app.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestTwoFactorCode true "Code of the authenticator app"
+// @Success 200 {object} ResponseRecoveryCodes
+// @Failure 400 {object} UserError "Two-factor authentication is not enabled or invalid code"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error creating the codes"
+// @Router /users/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context, db *sql.DB) {
+	var request RequestTwoFactorCode
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	twoFactorEnabled, err := IsTwoFactorEnabled(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !twoFactorEnabled {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorNotEnabledError, "Two-factor authentication is not enabled")
+		return
+	}
+
+	isValid, err := checkSecondFactor(jwtPayload.UserId, request.Code, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !isValid {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidTwoFactorCodeError, "Invalid code")
+		return
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	err = ReplaceRecoveryCodesInDB(jwtPayload.UserId, recoveryCodeHashes, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseRecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Removes the TOTP secret and all recovery codes. Needs the password and a code of the authenticator app or a recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestDisableTwoFactor true "Password and code"
+// @Success 200 {object} UserSuccess "Two-factor authentication disabled"
+// @Failure 400 {object} UserError "Two-factor authentication is not enabled, wrong password or invalid code"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error disabling two-factor authentication"
+// @Router /users/2fa [delete]
+func DisableTwoFactor(c *gin.Context, db *sql.DB) {
+	var request RequestDisableTwoFactor
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !hashing.CheckHashedString(userData.PasswordHash, request.Password) {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.PasswordDoesNotMatchError, "Wrong Password")
+		return
+	}
+
+	twoFactorEnabled, err := IsTwoFactorEnabled(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !twoFactorEnabled {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.TwoFactorNotEnabledError, "Two-factor authentication is not enabled")
+		return
+	}
+
+	isValid, err := checkSecondFactor(jwtPayload.UserId, request.Code, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if !isValid {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidTwoFactorCodeError, "Invalid code")
+		return
+	}
+
+	err = DeleteTwoFactorInDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Two-factor authentication disabled"})
+}
+
+// GetOidcProviders godoc
+// @Summary List the identity providers
+// @Description Returns the names of the identity providers that can be used to sign in.
+// @Tags users
+// @Produce json
+// @Success 200 {object} ResponseOidcProviders
+// @Router /auth/oidc/providers [get]
+func GetOidcProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, ResponseOidcProviders{Providers: oidc.ProviderNames()})
+}
+
+// StartOidcSignIn godoc
+// @Summary Start a sign in with an identity provider
+// @Description Returns the url of the identity provider and sets the cookie that binds the flow to the browser. After the sign in the provider redirects to the app, which passes state and code to /auth/oidc/callback.
+// @Tags users
+// @Produce json
+// @Param provider query string true "Name of the identity provider"
+// @Success 200 {object} ResponseOidcAuthorization
+// @Failure 400 {object} UserError "Unknown identity provider"
+// @Failure 502 {object} UserError "Identity provider not reachable"
+// @Router /auth/oidc/start [get]
+func StartOidcSignIn(c *gin.Context, db *sql.DB) {
+	var request RequestOidcProvider
+	if err := c.ShouldBindQuery(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	authorizationUrl, err := startOidcFlow(c, request.Provider, "", db)
+	if err != nil {
+		respondWithOidcStartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseOidcAuthorization{AuthorizationUrl: authorizationUrl})
+}
+
+// OidcCallback godoc
+// @Summary Finish a sign in with an identity provider
+// @Description Redeems the code of the identity provider. Unknown identities get a new account, unless the email already belongs to an account. Only works in the browser that started the flow, it has to send the cookie set by /auth/oidc/start.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RequestOidcCallback true "State and code of the redirect"
+// @Success 200 {object} jwt.JWTTokenResponse
+// @Success 200 {object} ResponseTwoFactorChallenge "Two-factor authentication is enabled, continue with /auth/signin/2fa"
+// @Failure 400 {object} UserError "Invalid or expired state, or the flow was started in another browser"
+// @Failure 401 {object} UserError "The identity provider rejected the code"
+// @Failure 409 {object} UserError "The email is already registered"
+// @Failure 500 {object} UserError "Server error during sign-in"
+// @Router /auth/oidc/callback [post]
+func OidcCallback(c *gin.Context, db *sql.DB) {
+	var request RequestOidcCallback
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	provider, claims, ok := finishOidcFlow(c, request, "", db)
+	if !ok {
+		return
+	}
+
+	userData, err := GetUserByIdentityFromDB(provider.Name, claims.Subject, db)
+	if err == nil {
+		err = UpdateIdentityLoginInDB(provider.Name, claims.Subject, claims.Email, db)
+		if err != nil {
+			log.Println(err)
+		}
+		completeSignIn(c, jwt.JWTUser{Username: userData.Username, UserId: userData.UserId}, db)
+		return
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	// an existing account is never taken over by email, the user has to sign in and link the provider
+	if claims.Email == "" {
+		responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.IdentityProviderError, "The identity provider did not share an email address")
+		return
+	}
+	emailInUse, err := CheckIfEmailIsInUse(claims.Email, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	if emailInUse {
+		responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.EmailRegisteredWithPasswordError, "An account with this email already exists, sign in and link the provider in your account settings")
+		return
+	}
+
+	username, err := generateUsernameForIdentity(claims, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	// the account gets a random password nobody knows, a password can be set later with the forgot password flow
+	randomPassword, err := hashing.GenerateToken()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	hashedPassword, err := hashing.HashPassword(randomPassword)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	newUser := DBNewUser{
+		username:      username,
+		email:         claims.Email,
+		password_hash: hashedPassword,
+	}
+	newUserId, err := CreateUserWithIdentityInDB(newUser, claims.EmailVerified, provider.Name, claims.Subject, db)
+	if err != nil {
+		if errors.Is(err, ErrEmailAlreadyInUse) {
+			responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.EmailRegisteredWithPasswordError, "An account with this email already exists, sign in and link the provider in your account settings")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	if !claims.EmailVerified {
+		err = sendEmailVerificationMail(newUserId, username, claims.Email, db)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	completeSignIn(c, jwt.JWTUser{Username: username, UserId: newUserId}, db)
+}
+
+// StartOidcLink godoc
+// @Summary Link an identity provider to the account
+// @Description Returns the url of the identity provider and sets the cookie that binds the flow to the browser. The flow is finished with /users/identities/link/callback.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param provider query string true "Name of the identity provider"
+// @Success 200 {object} ResponseOidcAuthorization
+// @Failure 400 {object} UserError "Unknown identity provider"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 502 {object} UserError "Identity provider not reachable"
+// @Router /users/identities/link [post]
+func StartOidcLink(c *gin.Context, db *sql.DB) {
+	var request RequestOidcProvider
+	if err := c.ShouldBindQuery(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	authorizationUrl, err := startOidcFlow(c, request.Provider, jwtPayload.UserId, db)
+	if err != nil {
+		respondWithOidcStartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ResponseOidcAuthorization{AuthorizationUrl: authorizationUrl})
+}
+
+// FinishOidcLink godoc
+// @Summary Finish linking an identity provider
+// @Description Redeems the code of the identity provider and links the identity to the account. Only works for the account and in the browser that started the flow with /users/identities/link.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestOidcCallback true "State and code of the redirect"
+// @Success 200 {object} UserSuccess "Identity linked"
+// @Failure 400 {object} UserError "Invalid or expired state, or the flow was started by another account or browser"
+// @Failure 401 {object} UserError "Invalid JWT token or the identity provider rejected the code"
+// @Failure 409 {object} UserError "Identity is linked to another account"
+// @Failure 500 {object} UserError "Server error linking the identity"
+// @Router /users/identities/link/callback [post]
+func FinishOidcLink(c *gin.Context, db *sql.DB) {
+	var request RequestOidcCallback
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	provider, claims, ok := finishOidcFlow(c, request, jwtPayload.UserId, db)
+	if !ok {
+		return
+	}
+
+	err := LinkIdentityToUserInDB(jwtPayload.UserId, provider.Name, claims.Subject, claims.Email, db)
+	if err != nil {
+		if errors.Is(err, ErrIdentityAlreadyLinked) {
+			responses.HttpErrorResponse(c.Writer, http.StatusConflict, frontendErrors.IdentityAlreadyLinkedError, "This identity is already linked to an account")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Identity linked successfully"})
+}
+
+// GetUserIdentities godoc
+// @Summary List the linked identity providers
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {array} Identity
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error retrieving the identities"
+// @Router /users/identities [get]
+func GetUserIdentities(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	identities, err := GetUserIdentitiesFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an identity provider
+// @Description Removes the provider from the account. The last provider of an account without password can't be removed.
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param provider query string true "Name of the identity provider"
+// @Success 200 {object} UserSuccess "Identity unlinked"
+// @Failure 400 {object} UserError "Last sign in method of the account"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 404 {object} UserError "Provider is not linked"
+// @Failure 500 {object} UserError "Server error unlinking the identity"
+// @Router /users/identities [delete]
+func UnlinkIdentity(c *gin.Context, db *sql.DB) {
+	var request RequestOidcProvider
+	if err := c.ShouldBindQuery(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	userData, err := GetUserByIdFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.UserDoesNotExistError, "User does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	if !userData.HasPassword {
+		identities, err := GetUserIdentitiesFromDB(jwtPayload.UserId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if len(identities) <= 1 {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.CantRemoveLastSignInMethodError, "Set a password before removing your last identity provider")
+			return
+		}
+	}
+
+	err = UnlinkIdentityInDB(jwtPayload.UserId, strings.ToLower(request.Provider), db)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.IdentityDoesNotExistError, "This identity provider is not linked")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Identity unlinked successfully"})
+}
+
+// CreateApiToken godoc
+// @Summary Create a personal access token
+// @Description Creates a long lived token for scripts and integrations. The token is sent in the Authorization header like an access token and is only returned once. Scopes are read, meals and groups.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param request body RequestCreateApiToken true "Name, scopes and optional group and lifetime of the token"
+// @Success 201 {object} ResponseCreatedApiToken
+// @Failure 400 {object} UserError "Invalid scope"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 404 {object} UserError "Group does not exist"
+// @Failure 500 {object} UserError "Server error creating the token"
+// @Router /users/tokens [post]
+func CreateApiToken(c *gin.Context, db *sql.DB) {
+	var request RequestCreateApiToken
+	if err := c.ShouldBindJSON(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	for _, scope := range request.Scopes {
+		if !roles.IsValidScope(scope) {
+			responses.HttpErrorResponse(c.Writer, http.StatusBadRequest, frontendErrors.InvalidApiTokenScopeError, "Unknown scope "+scope)
+			return
+		}
+	}
+
+	if request.GroupId != "" {
+		isMember, err := CheckIfUserIsMemberOfGroup(jwtPayload.UserId, request.GroupId, db)
+		if err != nil {
+			log.Println(err)
+			responses.GenericInternalServerError(c.Writer)
+			return
+		}
+		if !isMember {
+			responses.GenericGroupDoesNotExistError(c.Writer)
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		expirationDate := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expirationDate
+	}
+
+	secret, err := hashing.GenerateToken()
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+	token := auth.ApiTokenPrefix + secret
+
+	apiToken, err := CreateApiTokenInDB(jwtPayload.UserId, request, hashing.HashToken(token), token[:len(auth.ApiTokenPrefix)+apiTokenHintLength], expiresAt, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ResponseCreatedApiToken{Token: token, ApiToken: apiToken})
+}
+
+// GetApiTokens godoc
+// @Summary List the personal access tokens
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Success 200 {array} ApiToken
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 500 {object} UserError "Server error retrieving the tokens"
+// @Router /users/tokens [get]
+func GetApiTokens(c *gin.Context, db *sql.DB) {
+	jwtPayload := auth.GetJWTPayload(c)
+
+	apiTokens, err := GetApiTokensOfUserFromDB(jwtPayload.UserId, db)
+	if err != nil {
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiTokens)
+}
+
+// RevokeApiToken godoc
+// @Summary Revoke a personal access token
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "JWT Token"
+// @Param tokenId query string true "Id of the token"
+// @Success 200 {object} UserSuccess "Token revoked"
+// @Failure 400 {object} UserError "Invalid token id"
+// @Failure 401 {object} UserError "Invalid JWT token"
+// @Failure 404 {object} UserError "Token does not exist"
+// @Failure 500 {object} UserError "Server error revoking the token"
+// @Router /users/tokens [delete]
+func RevokeApiToken(c *gin.Context, db *sql.DB) {
+	var request RequestApiTokenId
+	if err := c.ShouldBindQuery(&request); err != nil {
+		responses.GenericBadRequestError(c.Writer)
+		return
+	}
+
+	jwtPayload := auth.GetJWTPayload(c)
+
+	err := RevokeApiTokenInDB(request.TokenId, jwtPayload.UserId, db)
+	if err != nil {
+		if errors.Is(err, ErrApiTokenNotFound) {
+			responses.HttpErrorResponse(c.Writer, http.StatusNotFound, frontendErrors.ApiTokenDoesNotExistError, "Token does not exist")
+			return
+		}
+		log.Println(err)
+		responses.GenericInternalServerError(c.Writer)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSuccess{Message: "Token revoked successfully"})
+}
@@ -1,5 +1,7 @@
 package user
 
+import "time"
+
 type UserError struct {
 	Error string `json:"error"`
 }
@@ -10,25 +12,85 @@ type UserSuccess struct {
 
 type RequestNewUser struct {
 	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required"`
+	Email    string `json:"email" binding:"required,email,max=255"`
 	Password string `json:"password" binding:"required"`
 }
 type RequestChangeUsername struct {
 	Username string `json:"username" binding:"required"`
 }
 type RequestChangePassword struct {
-	OldPassword string `json:"oldPassword" binding:"required"`
+	OldPassword         string `json:"oldPassword" binding:"required"`
+	NewPassword         string `json:"newPassword" binding:"required"`
+	RevokeOtherSessions bool   `json:"revokeOtherSessions"`
+}
+
+type RequestForgotPassword struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type RequestResetPassword struct {
+	Token       string `json:"token" binding:"required"`
 	NewPassword string `json:"newPassword" binding:"required"`
 }
 
+type RequestVerifyEmail struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type RequestChangeEmail struct {
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RequestTwoFactorCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RequestDisableTwoFactor struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RequestTwoFactorSignIn struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type RequestOidcProvider struct {
+	Provider string `form:"provider" binding:"required"`
+}
+
+type RequestOidcCallback struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+type RequestCreateApiToken struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,required"`
+	GroupId       string   `json:"groupId" binding:"omitempty,uuid"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=365"` // tokens without expiration if empty
+}
+
+type RequestApiTokenId struct {
+	TokenId string `form:"tokenId" binding:"required,uuid"`
+}
+
+type RequestSessionId struct {
+	SessionId string `form:"sessionId" binding:"required,uuid"`
+}
+
 type ResponseUserGroups struct {
 	Groups []GroupCard `json:"userGroups" `
 }
 
 type ResponseUserData struct {
-	Username string      `json:"username"`
-	UserID   string      `json:"userId"`
-	Groups   []GroupCard `json:"groups"`
+	Username      string      `json:"username"`
+	UserID        string      `json:"userId"`
+	Email         string      `json:"email"`
+	EmailVerified bool        `json:"emailVerified"`
+	PendingEmail  string      `json:"pendingEmail,omitempty"`
+	Groups        []GroupCard `json:"groups"`
 }
 
 type GroupCard struct {
@@ -55,10 +117,13 @@ type SignInCredentials struct {
 }
 
 type UserFromDB struct {
-	UserId       string `json:"userId"`
-	Username     string `json:"username"`
-	Email        string `json:"email"`
-	PasswordHash string `json:"passwordHash"`
+	UserId        string `json:"userId"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	PasswordHash  string `json:"passwordHash"`
+	EmailVerified bool   `json:"emailVerified"`
+	PendingEmail  string `json:"pendingEmail"`
+	HasPassword   bool   `json:"hasPassword"`
 }
 
 type UserGroupsFromDB struct {
@@ -70,3 +135,74 @@ type UserGroupsFromDB struct {
 type MessageResponse struct {
 	Message string `json:"message"`
 }
+
+type Session struct {
+	SessionId  string `json:"sessionId"`
+	DeviceName string `json:"deviceName"`
+	UserAgent  string `json:"userAgent"`
+	IpAddress  string `json:"ipAddress"`
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt"`
+	IsCurrent  bool   `json:"isCurrent"`
+}
+
+type ResponseTwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type ResponseTwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauthUri"`
+}
+
+type ResponseRecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TwoFactorFromDB struct {
+	EncryptedSecret string
+	Enabled         bool
+	LastUsedStep    int64
+}
+
+type ResponseOidcProviders struct {
+	Providers []string `json:"providers"`
+}
+
+type ResponseOidcAuthorization struct {
+	AuthorizationUrl string `json:"authorizationUrl"`
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	BindingHash  string // hash of the cookie set in the browser that started the flow
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserId   string
+	ExpiresAt    time.Time
+}
+
+type Identity struct {
+	Provider    string `json:"provider"`
+	Email       string `json:"email"`
+	LinkedAt    string `json:"linkedAt"`
+	LastLoginAt string `json:"lastLoginAt"`
+}
+
+type ApiToken struct {
+	TokenId    string     `json:"tokenId"`
+	Name       string     `json:"name"`
+	TokenHint  string     `json:"tokenHint"`
+	Scopes     []string   `json:"scopes"`
+	GroupId    string     `json:"groupId,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type ResponseCreatedApiToken struct {
+	Token    string   `json:"token"` // only returned once, only the hash is stored
+	ApiToken ApiToken `json:"apiToken"`
+}
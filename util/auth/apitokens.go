@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"database/sql"
+	"enguete/util/hashing"
+	"enguete/util/jwt"
+	"errors"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// ApiTokenPrefix starts every personal access token, so they can't be mixed up with access tokens and can be found by secret scanners.
+const ApiTokenPrefix = "egt_"
+
+var ErrApiTokenInvalid = errors.New("api token is invalid, expired or revoked")
+
+func IsApiToken(token string) bool {
+	return strings.HasPrefix(token, ApiTokenPrefix)
+}
+
+// GetApiTokenPayload looks up a personal access token and returns a payload that acts like the one of an access token.
+// The last use of the token gets updated at most once a minute.
+func GetApiTokenPayload(token string, db *sql.DB) (jwt.JWTPayload, error) {
+	query := `
+		UPDATE api_tokens at
+		SET last_used_at = CASE
+			WHEN at.last_used_at IS NULL OR at.last_used_at < NOW() - INTERVAL '1 minute' THEN NOW()
+			ELSE at.last_used_at
+		END
+		FROM users u
+		WHERE at.token_hash = $1
+		AND u.user_id = at.user_id
+		AND u.deleted_at IS NULL
+		AND at.revoked_at IS NULL
+		AND (at.expires_at IS NULL OR at.expires_at > NOW())
+		RETURNING at.api_token_id, u.user_id, u.username, at.scopes, COALESCE(at.group_id::TEXT, '')
+	`
+	var payload jwt.JWTPayload
+	err := db.QueryRow(query, hashing.HashToken(token)).Scan(
+		&payload.ApiTokenId,
+		&payload.UserId,
+		&payload.UserName,
+		pq.Array(&payload.Scopes),
+		&payload.LimitedToGroupId,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jwt.JWTPayload{}, ErrApiTokenInvalid
+	}
+	return payload, err
+}
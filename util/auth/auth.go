@@ -3,59 +3,22 @@ package auth
 import (
 	"database/sql"
 	"enguete/util/jwt"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"strings"
 )
 
+var ErrTokenIsNotAnAccessToken = errors.New("token can not be used as access token")
+
 func GetJWTTokenFromHeader(c *gin.Context) (string, error) {
-	jwtString := c.Request.Header.Get("Authorization")
+	jwtString := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
 	if jwtString == "" {
 		return "", fmt.Errorf("missing authorization header")
 	}
 	return jwtString, nil
 }
 
-// GetJWTPayloadFromHeader extracts the JWT payload from the Authorization header of an HTTP request.
-// It first retrieves the JWT token from the header, verifies the token, and then decodes the payload.
-//
-// Parameters:
-//
-//	r (*http.Request): The HTTP request containing the Authorization header with the JWT token.
-//
-// Returns:
-//
-//	(jwt.JWTPayload, error): Returns the decoded JWT payload if successful, otherwise returns an error.
-func GetJWTPayloadFromHeader(c *gin.Context, db *sql.DB) (jwt.JWTPayload, error) {
-	jwtToken, err := GetJWTTokenFromHeader(c)
-	var jwtData jwt.JWTPayload
-	if err != nil {
-		jwtData, newJwtToken, err := CreateNewTokenWithRefreshToken(c, db)
-
-		if err != nil {
-			return jwtData, err
-		}
-
-		c.Header("Authorization", newJwtToken)
-		return jwtData, err
-	}
-
-	valid, jwtData, err := jwt.VerifyToken(jwtToken)
-	if err != nil {
-		return jwtData, err
-	}
-	if !valid {
-		jwtData, jwtToken, err = CreateNewTokenWithRefreshToken(c, db)
-
-		if err != nil {
-			return jwtData, err
-		}
-
-		c.Header("Authorization", jwtToken)
-	}
-
-	return jwtData, err
-}
-
 func GetRefreshTokenFromHeader(c *gin.Context) (string, error) {
 	refreshToken := c.Request.Header.Get("RefreshToken")
 	if refreshToken == "" {
@@ -65,27 +28,41 @@ func GetRefreshTokenFromHeader(c *gin.Context) (string, error) {
 	return refreshToken, nil
 }
 
-func CreateNewTokenWithRefreshToken(c *gin.Context, db *sql.DB) (jwt.JWTPayload, string, error) {
+// CreateNewTokenWithRefreshToken rotates the refresh token from the header and issues a new access token.
+// The old refresh token is retired, so the caller has to hand out both new tokens.
+func CreateNewTokenWithRefreshToken(c *gin.Context, db *sql.DB) (jwt.JWTPayload, string, string, error) {
 	refreshToken, err := GetRefreshTokenFromHeader(c)
 	var jwtData jwt.JWTPayload
 	if err != nil {
-		return jwtData, "", err
+		return jwtData, "", "", err
 	}
 
-	refreshTokenBody, err := jwt.VerifyRefreshToken(refreshToken, db)
+	refreshTokenBody, newRefreshToken, err := jwt.RotateRefreshToken(refreshToken, GetSessionInfoFromRequest(c), db)
 	if err != nil {
-		return jwtData, "", err
+		return jwtData, "", "", err
 	}
 
 	userData := jwt.JWTUser{
-		UserId: refreshTokenBody.UserId,
+		UserId:    refreshTokenBody.UserId,
+		Username:  refreshTokenBody.UserName,
+		SessionId: refreshTokenBody.SessionId,
 	}
 
 	jwtToken, err := jwt.CreateToken(userData)
 	if err != nil {
-		return jwtData, jwtToken, err
+		return jwtData, jwtToken, "", err
 	}
 
 	jwtData, err = jwt.DecodeBearer(jwtToken)
-	return jwtData, jwtToken, err
+	return jwtData, jwtToken, newRefreshToken, err
+}
+
+// GetSessionInfoFromRequest collects the device information that gets stored with a refresh token.
+// The app can name the device with the optional DeviceName header.
+func GetSessionInfoFromRequest(c *gin.Context) jwt.SessionInfo {
+	return jwt.SessionInfo{
+		DeviceName: c.Request.Header.Get("DeviceName"),
+		UserAgent:  c.Request.UserAgent(),
+		IpAddress:  c.ClientIP(),
+	}
 }
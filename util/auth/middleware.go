@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"database/sql"
+	"enguete/util/frontendErrors"
+	"enguete/util/jwt"
+	"enguete/util/responses"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const jwtPayloadContextKey = "jwtPayload"
+
+// Authenticate checks the credentials of the request once and stores the payload in the request context, handlers
+// read it with GetJWTPayload. Requests without valid credentials are aborted with 401.
+//
+// A missing or expired access token gets renewed with the RefreshToken header, the new tokens are returned in the
+// Authorization and RefreshToken headers of the response. Personal access tokens are accepted as well.
+func Authenticate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jwtPayload, err := authenticateRequest(c, db)
+		if err != nil {
+			responses.GenericUnauthorizedError(c.Writer)
+			c.Abort()
+			return
+		}
+
+		c.Set(jwtPayloadContextKey, jwtPayload)
+		c.Next()
+	}
+}
+
+// RequireSession refuses personal access tokens. It guards the account endpoints, so a leaked token can't be used to
+// take over the account. Has to run after Authenticate.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetJWTPayload(c).IsApiToken() {
+			responses.HttpErrorResponse(c.Writer, http.StatusForbidden, frontendErrors.SessionRequiredError, "This endpoint can't be used with an api token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetJWTPayload returns the payload stored by Authenticate. Outside of authenticated routes the payload is empty.
+func GetJWTPayload(c *gin.Context) jwt.JWTPayload {
+	value, _ := c.Get(jwtPayloadContextKey)
+	jwtPayload, _ := value.(jwt.JWTPayload)
+	return jwtPayload
+}
+
+func authenticateRequest(c *gin.Context, db *sql.DB) (jwt.JWTPayload, error) {
+	jwtToken, err := GetJWTTokenFromHeader(c)
+	if err == nil && IsApiToken(jwtToken) {
+		return GetApiTokenPayload(jwtToken, db)
+	}
+
+	if err == nil {
+		isValid, jwtData, err := jwt.VerifyToken(jwtToken)
+		if err != nil {
+			return jwt.JWTPayload{}, err
+		}
+		// refresh tokens issued before the purpose claim are recognized by their token id
+		if jwtData.Purpose != "" || jwtData.TokenId != "" {
+			return jwt.JWTPayload{}, ErrTokenIsNotAnAccessToken
+		}
+		if isValid {
+			return jwtData, nil
+		}
+	}
+
+	jwtData, newJwtToken, newRefreshToken, err := CreateNewTokenWithRefreshToken(c, db)
+	if err != nil {
+		return jwt.JWTPayload{}, err
+	}
+
+	c.Header("Authorization", newJwtToken)
+	c.Header("RefreshToken", newRefreshToken)
+	return jwtData, nil
+}
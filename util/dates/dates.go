@@ -1,16 +1,24 @@
 package dates
 
-import "time"
+import (
+	"time"
+	_ "time/tzdata" // groups can use any IANA time zone, even if the server has no zoneinfo installed
+)
 
-func GetStartAndEndOfWeek(date time.Time) (startOfWeek string, endOfWeek string) {
-
-	weekday := int(date.Weekday())
-	if weekday == 0 {
-		weekday = 7
-	}
+// StartOfWeek returns midnight of the first day of the week that contains the date, in the time zone of the location
+// and with weeks that begin on weekStart.
+func StartOfWeek(date time.Time, location *time.Location, weekStart time.Weekday) time.Time {
+	date = date.In(location)
+	daysSinceWeekStart := (int(date.Weekday()) - int(weekStart) + 7) % 7
+	return time.Date(date.Year(), date.Month(), date.Day()-daysSinceWeekStart, 0, 0, 0, 0, location)
+}
 
-	start := date.AddDate(0, 0, -weekday+1)
-	end := start.AddDate(0, 0, 6)
+// GetStartAndEndOfWeek returns the first and the last instant of the week that contains the date, in the time zone of
+// the location and with weeks that begin on weekStart.
+func GetStartAndEndOfWeek(date time.Time, location *time.Location, weekStart time.Weekday) (startOfWeek string, endOfWeek string) {
+	start := StartOfWeek(date, location, weekStart)
+	// postgres stores microseconds, a finer end would be rounded up to the start of the next week
+	end := start.AddDate(0, 0, 7).Add(-time.Microsecond)
 
-	return start.Format(time.RFC3339), end.Format(time.RFC3339)
+	return start.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano)
 }
@@ -12,15 +12,31 @@ const (
 	NotAllowedToDeleteGroupError = "notAllowedToDeleteGroupError"
 	NotAllowedToUpdateGroupError = "notAllowedToUpdateGroupError"
 	GroupDoesNotExistError       = "groupDoesNotExistError"
+	LastAdminError               = "lastAdminError"
+	CantRemoveOwnerError         = "cantRemoveOwnerError"
 
-	InvalidInviteTokenError = "invalidInviteTokenError"
+	InvalidInviteTokenError       = "invalidInviteTokenError"
+	InviteTokenIsNotUsableError   = "inviteTokenIsNotUsableError"
+	JoinRequestDoesNotExistError  = "joinRequestDoesNotExistError"
+	InvitationDoesNotExistError   = "invitationDoesNotExistError"
+	InvitationAlreadyPendingError = "invitationAlreadyPendingError"
+	UserIsAlreadyMemberError      = "userIsAlreadyMemberError"
 
 	UserDoesNotExistError = "userDoesNotExistError"
 	CreateGroupError      = "createGroupError"
 
 	YouCantKickOrBanYourselfError = "youCantKickOrBanYourselfError"
+	UserIsBannedFromGroupError    = "userIsBannedFromGroupError"
+	UserIsNotBannedError          = "userIsNotBannedError"
 	InvalidRoleError              = "invalidRoleError"
 
+	RoleDoesNotExistError           = "roleDoesNotExistError"
+	RoleAlreadyExistsError          = "roleAlreadyExistsError"
+	InvalidPermissionError          = "invalidPermissionError"
+	DefaultRoleCanNotBeChangedError = "defaultRoleCanNotBeChangedError"
+	CantGrantMissingPermissionError = "cantGrantMissingPermissionError"
+	MemberOutranksYouError          = "memberOutranksYouError"
+
 	PasswordFormatTooShortError               = "passwordFormatTooShortError"
 	PasswordFormatNeedsUpperLowerSpecialError = "passwordFormatNeedsUpperLowerSpecialError"
 	PasswordFormatTooLongError                = "passwordFormatTooLongError"
@@ -29,8 +45,53 @@ const (
 	UsernameIsAlreadyTakenError        = "usernameIsAlreadyTakenError"
 	UsernameOrEmailIsAlreadyTakenError = "usernameOrEmailIsAlreadyTakenError"
 	WrongUsernameOrPasswordError       = "wrongUsernameOrPasswordError"
+	TooManySignInAttemptsError         = "tooManySignInAttemptsError"
+
+	SessionDoesNotExistError = "sessionDoesNotExistError"
+
+	TwoFactorAlreadyEnabledError   = "twoFactorAlreadyEnabledError"
+	TwoFactorNotEnabledError       = "twoFactorNotEnabledError"
+	InvalidTwoFactorCodeError      = "invalidTwoFactorCodeError"
+	InvalidChallengeTokenError     = "invalidChallengeTokenError"
+	TwoFactorRequiredForAdminError = "twoFactorRequiredForAdminError"
+
+	InvalidTimeZoneError = "invalidTimeZoneError"
+	InvalidLocaleError   = "invalidLocaleError"
+	InvalidMealTimeError = "invalidMealTimeError"
+
+	UnknownIdentityProviderError     = "unknownIdentityProviderError"
+	InvalidOidcStateError            = "invalidOidcStateError"
+	IdentityProviderError            = "identityProviderError"
+	IdentityAlreadyLinkedError       = "identityAlreadyLinkedError"
+	IdentityDoesNotExistError        = "identityDoesNotExistError"
+	EmailRegisteredWithPasswordError = "emailRegisteredWithPasswordError"
+	CantRemoveLastSignInMethodError  = "cantRemoveLastSignInMethodError"
+
+	ApiTokenDoesNotExistError = "apiTokenDoesNotExistError"
+	InvalidApiTokenScopeError = "invalidApiTokenScopeError"
+	SessionRequiredError      = "sessionRequiredError"
+	ApiTokenScopeError        = "apiTokenScopeError"
+
+	InvalidPasswordResetTokenError = "invalidPasswordResetTokenError"
+
+	EmailIsAlreadyTakenError           = "emailIsAlreadyTakenError"
+	EmailIsAlreadyVerifiedError        = "emailIsAlreadyVerifiedError"
+	EmailIsNotVerifiedError            = "emailIsNotVerifiedError"
+	InvalidEmailVerificationTokenError = "invalidEmailVerificationTokenError"
 
 	MealDoesNotExistError = "mealDoesNotExistError"
 
+	InvalidRecurrenceRuleError     = "invalidRecurrenceRuleError"
+	UnsupportedRecurrenceRuleError = "unsupportedRecurrenceRuleError"
+	MealIsNotPartOfASeriesError    = "mealIsNotPartOfASeriesError"
+
+	MealTemplateDoesNotExistError = "mealTemplateDoesNotExistError"
+	CookIsNotAMemberError         = "cookIsNotAMemberError"
+	MealTimeIsMissingError        = "mealTimeIsMissingError"
+
+	PreferenceDeadlinePassedError = "preferenceDeadlinePassedError"
+	NotEnoughSeatsError           = "notEnoughSeatsError"
+	CapacityBelowConfirmedError   = "capacityBelowConfirmedError"
+
 	FiltersAreNotValidError = "filtersAreNotValidError"
 )
@@ -1,6 +1,9 @@
 package hashing
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+)
 
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
@@ -11,3 +14,15 @@ func CheckHashedString(hash string, plainText string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plainText))
 	return err == nil
 }
+
+var dummyHash []byte
+var dummyHashOnce sync.Once
+
+// CompareWithDummyHash takes as long as CheckHashedString but always fails.
+// It is used when there is no user to compare against, so the response time doesn't reveal whether an account exists.
+func CompareWithDummyHash(plainText string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), 10)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(plainText))
+}
@@ -0,0 +1,63 @@
+package hashing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidEncryptedSecret = errors.New("encrypted secret is invalid")
+
+// secretEncryptionKey derives the AES key from TOKEN_HASH_KEY, so the same key is never used for two purposes.
+func secretEncryptionKey() []byte {
+	mac := hmac.New(sha256.New, tokenHashKey)
+	mac.Write([]byte("secret-encryption"))
+	return mac.Sum(nil)
+}
+
+// EncryptSecret encrypts a secret that has to be read again later on, like a TOTP secret, with AES-GCM.
+func EncryptSecret(plainText string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plainText), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptSecret(encrypted string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", ErrInvalidEncryptedSecret
+	}
+
+	plainText, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidEncryptedSecret
+	}
+	return string(plainText), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretEncryptionKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
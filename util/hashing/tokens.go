@@ -0,0 +1,45 @@
+package hashing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+var tokenHashKey []byte
+
+var ErrTokenHashKeyNotSet = errors.New("TOKEN_HASH_KEY is not set")
+
+// InitTokenHashKey loads the server side key used for HashToken from the environment.
+func InitTokenHashKey() error {
+	key := os.Getenv("TOKEN_HASH_KEY")
+	if key == "" {
+		return ErrTokenHashKeyNotSet
+	}
+	tokenHashKey = []byte(key)
+	return nil
+}
+
+// HashToken returns the hex encoded HMAC-SHA256 of a token.
+//
+// Tokens are random and long, so unlike passwords they don't need a slow hash. The key makes sure that a leaked
+// database alone is not enough to look up or forge tokens.
+func HashToken(token string) string {
+	mac := hmac.New(sha256.New, tokenHashKey)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateToken returns a random url safe token with 256 bits of entropy, used for links sent by mail.
+func GenerateToken() (string, error) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"enguete/util/hashing"
 	"errors"
 	"fmt"
 	"log"
@@ -11,24 +12,40 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/satori/go.uuid"
 )
 
-var secretKey = []byte("capybara") // TODO: add secret key via .env or some rotation
-
 type NewRefreshTokenDataDB struct {
-	UserId       string     `json:"userId"`
-	RefreshToken string     `json:"refresh_token"`
-	LifeTime     *time.Time `json:"lifeTime"`
+	TokenId   string    `json:"tokenId"`
+	UserId    string    `json:"userId"`
+	FamilyId  string    `json:"familyId"`
+	TokenHash string    `json:"tokenHash"`
+	LifeTime  time.Time `json:"lifeTime"`
+	Session   SessionInfo
+}
+
+type RefreshTokenFromDB struct {
+	TokenId    string
+	FamilyId   string
+	LifeTime   time.Time
+	LastUsed   *time.Time
+	RevokedAt  *time.Time
+	DeviceName string
+}
+
+var validMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
 }
 
 func CreateToken(userData JWTUser) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"UserId":   userData.UserId,
-			"Username": userData.Username,
-			"Exp":      time.Now().Add(time.Minute * 5).Unix(),
-		})
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := signClaims(jwt.MapClaims{
+		"UserId":    userData.UserId,
+		"Username":  userData.Username,
+		"SessionId": userData.SessionId,
+		"Exp":       time.Now().Add(time.Minute * 5).Unix(),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -36,9 +53,11 @@ func CreateToken(userData JWTUser) (string, error) {
 }
 
 func VerifyToken(tokenString string) (isValid bool, jwtData JWTPayload, err error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+	return verifyToken(tokenString, verificationKey)
+}
+
+func verifyToken(tokenString string, keyFunc jwt.Keyfunc) (isValid bool, jwtData JWTPayload, err error) {
+	token, err := jwt.Parse(tokenString, keyFunc, jwt.WithValidMethods(validMethods))
 
 	if err != nil {
 		return false, jwtData, err
@@ -60,81 +79,176 @@ func VerifyToken(tokenString string) (isValid bool, jwtData JWTPayload, err erro
 	return true, jwtData, nil
 }
 
-var RefreshTokenNotInDbError = errors.New("refresh token not found in database")
-var TokenIsNotValidDueToExpirationDate = errors.New("token is not valid due to expiration date")
+// TwoFactorChallengePurpose marks the token handed out after the password step of a sign in with two-factor authentication.
+const TwoFactorChallengePurpose = "two_factor_challenge"
+
+// RefreshTokenPurpose marks refresh tokens, so they are never accepted as access tokens.
+const RefreshTokenPurpose = "refresh"
+
+const challengeTokenLifeTime = time.Minute * 5
 
-func VerifyRefreshToken(tokenString string, db *sql.DB) (JWTPayload, error) {
+var ErrInvalidChallengeToken = errors.New("challenge token is invalid or expired")
+
+// CreateChallengeToken creates a short lived token that only proves that the first step of a flow was completed.
+// Tokens with a purpose are never accepted as access tokens.
+func CreateChallengeToken(userData JWTUser, purpose string) (string, error) {
+	return signClaims(jwt.MapClaims{
+		"UserId":   userData.UserId,
+		"Username": userData.Username,
+		"Purpose":  purpose,
+		"Exp":      time.Now().Add(challengeTokenLifeTime).Unix(),
+	})
+}
 
+func VerifyChallengeToken(tokenString string, purpose string) (JWTPayload, error) {
 	isValid, payload, err := VerifyToken(tokenString)
-	if err != nil || !isValid {
-		return JWTPayload{}, err
+	if err != nil || !isValid || payload.Purpose != purpose {
+		return JWTPayload{}, ErrInvalidChallengeToken
 	}
+	return payload, nil
+}
+
+var RefreshTokenNotInDbError = errors.New("refresh token not found in database")
+var TokenIsNotValidDueToExpirationDate = errors.New("token is not valid due to expiration date")
+var ErrRefreshTokenRevoked = errors.New("refresh token was revoked")
+var ErrRefreshTokenReused = errors.New("refresh token was already used, the token family got revoked")
+
+// refreshTokenLifeTime is how long a single refresh token stays valid. Every rotation issues a new token with a fresh lifetime.
+const refreshTokenLifeTime = time.Hour * 24 * 14
+
+// refreshTokenReuseInterval is the grace period in which a just rotated token may be presented again without it counting as reuse.
+// This covers clients that fire several requests in parallel with the same expired access token.
+const refreshTokenReuseInterval = time.Second * 30
 
-	inDB, err := VerifyRefreshTokenInDB(tokenString, payload.UserId, db)
+// CreateRefreshToken creates the first refresh token of a new token family, which happens on every sign in or sign up.
+// The family id is returned as session id, it identifies the session on the device until it gets revoked.
+func CreateRefreshToken(userData JWTUser, session SessionInfo, db *sql.DB) (tokenString string, sessionId string, err error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return payload, err
+		return "", "", err
 	}
-	if !inDB {
-		return payload, RefreshTokenNotInDbError
+
+	sessionId = uuid.NewV4().String()
+	tokenString, _, err = createRefreshTokenWithTransaction(userData, sessionId, session, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Println(err)
+		return "", "", err
 	}
 
-	return payload, nil
+	err = tx.Commit()
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, sessionId, nil
 }
 
-func VerifyRefreshTokenInDB(token string, userId string, db *sql.DB) (bool, error) {
-	var count int64
+func createRefreshTokenWithTransaction(userData JWTUser, familyId string, session SessionInfo, tx *sql.Tx) (tokenString string, tokenId string, err error) {
+	lifeTime := time.Now().Add(refreshTokenLifeTime)
+	tokenId = uuid.NewV4().String()
+
+	tokenString, err = signClaims(jwt.MapClaims{
+		"UserId":    userData.UserId,
+		"Username":  userData.Username,
+		"TokenId":   tokenId,
+		"SessionId": familyId,
+		"Purpose":   RefreshTokenPurpose,
+		"Exp":       lifeTime.Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
 
-	query := `
-		SELECT COUNT(*)
-		FROM refresh_tokens
-		WHERE refresh_token = $1
-		AND user_id = $2
-	`
+	data := NewRefreshTokenDataDB{
+		TokenId:   tokenId,
+		UserId:    userData.UserId,
+		FamilyId:  familyId,
+		TokenHash: hashing.HashToken(tokenString),
+		LifeTime:  lifeTime,
+		Session:   session,
+	}
+	err = PushRefreshTokenToDBWithTransaction(data, tx)
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, tokenId, nil
+}
 
-	err := db.QueryRow(query, token, userId).Scan(&count)
+// RotateRefreshToken exchanges a refresh token for a new one of the same family and retires the presented token.
+//
+// Presenting a retired token again (outside the reuse interval) means the token was most likely stolen,
+// in that case the whole family gets revoked and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(tokenString string, session SessionInfo, db *sql.DB) (JWTPayload, string, error) {
+	isValid, payload, err := verifyToken(tokenString, refreshVerificationKey)
 	if err != nil {
-		return false, err
+		return JWTPayload{}, "", err
+	}
+	if !isValid {
+		return JWTPayload{}, "", TokenIsNotValidDueToExpirationDate
+	}
+	// refresh tokens issued before the purpose claim have none
+	if payload.Purpose != "" && payload.Purpose != RefreshTokenPurpose {
+		return JWTPayload{}, "", RefreshTokenNotInDbError
 	}
 
-	return count > 0, nil
-}
+	tx, err := db.Begin()
+	if err != nil {
+		return payload, "", err
+	}
 
-func CreateRefreshToken(userData JWTUser, isTimeBased bool, db *sql.DB) (string, error) {
-	var dateTime *time.Time
-	if isTimeBased {
-		t := time.Now().Add(time.Hour * 24 * 14)
-		dateTime = &t
+	storedToken, err := GetRefreshTokenForUpdateWithTransaction(tokenString, payload.UserId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return payload, "", err
+	}
+
+	if storedToken.RevokedAt != nil {
+		_ = tx.Rollback()
+		return payload, "", ErrRefreshTokenRevoked
+	}
+	if !storedToken.LifeTime.After(time.Now()) {
+		_ = tx.Rollback()
+		return payload, "", TokenIsNotValidDueToExpirationDate
+	}
+	if storedToken.LastUsed != nil && time.Since(*storedToken.LastUsed) > refreshTokenReuseInterval {
+		err = RevokeRefreshTokenFamilyWithTransaction(storedToken.FamilyId, tx)
+		if err != nil {
+			_ = tx.Rollback()
+			return payload, "", err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return payload, "", err
+		}
+		return payload, "", ErrRefreshTokenReused
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"UserId":   userData.UserId,
-			"Username": userData.Username,
-			"Exp": func() int64 {
-				var timestamp int64 = 0
-				if dateTime != nil {
-					timestamp = dateTime.Unix()
-				}
-				return timestamp
-			}(),
-		})
-	tokenString, err := token.SignedString(secretKey)
+	userData := JWTUser{
+		UserId:   payload.UserId,
+		Username: payload.UserName,
+	}
+	// legacy tokens carry no session id, their family is the session
+	payload.SessionId = storedToken.FamilyId
+	if session.DeviceName == "" {
+		session.DeviceName = storedToken.DeviceName
+	}
+	newTokenString, newTokenId, err := createRefreshTokenWithTransaction(userData, storedToken.FamilyId, session, tx)
 	if err != nil {
-		return "", err
+		_ = tx.Rollback()
+		return payload, "", err
 	}
 
-	data := NewRefreshTokenDataDB{
-		UserId:       userData.UserId,
-		RefreshToken: tokenString,
-		LifeTime:     dateTime,
+	err = RetireRefreshTokenWithTransaction(storedToken.TokenId, newTokenId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return payload, "", err
 	}
 
-	err = PushRefreshTokenToDB(data, db)
+	err = tx.Commit()
 	if err != nil {
-		log.Println(err)
-		return "", err
+		return payload, "", err
 	}
-	return tokenString, nil
+	return payload, newTokenString, nil
 }
 
 func DecodeBearer(tokenString string) (JWTPayload, error) {
@@ -164,26 +278,70 @@ func DecodeBearer(tokenString string) (JWTPayload, error) {
 	return payload, nil
 }
 
-func PushRefreshTokenToDB(data NewRefreshTokenDataDB, db *sql.DB) error {
-	if data.LifeTime != nil && data.LifeTime.IsZero() {
-		data.LifeTime = nil
-	}
+func PushRefreshTokenToDBWithTransaction(data NewRefreshTokenDataDB, tx *sql.Tx) error {
 	sqlString := `
 	INSERT INTO refresh_tokens 
-	(user_id, refresh_Token) 
-	VALUES ($1, $2)
+	(id, user_id, family_id, token_hash, life_time, device_name, user_agent, ip_address) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 `
-	log.Println(data)
-	_, err := db.Exec(sqlString, data.UserId, data.RefreshToken)
+	_, err := tx.Exec(sqlString, data.TokenId, data.UserId, data.FamilyId, data.TokenHash, data.LifeTime, data.Session.DeviceName, data.Session.UserAgent, data.Session.IpAddress)
+
+	return err
+}
 
+func GetRefreshTokenForUpdateWithTransaction(token string, userId string, tx *sql.Tx) (RefreshTokenFromDB, error) {
+	query := `
+		SELECT id, family_id, life_time, last_used, revoked_at, COALESCE(device_name, '')
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		AND user_id = $2
+		FOR UPDATE
+	`
+	var storedToken RefreshTokenFromDB
+	err := tx.QueryRow(query, hashing.HashToken(token), userId).Scan(
+		&storedToken.TokenId,
+		&storedToken.FamilyId,
+		&storedToken.LifeTime,
+		&storedToken.LastUsed,
+		&storedToken.RevokedAt,
+		&storedToken.DeviceName,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storedToken, RefreshTokenNotInDbError
+	}
+	return storedToken, err
+}
+
+// RetireRefreshTokenWithTransaction marks a token as used. Retired tokens are kept, so that a reuse can be detected later on.
+func RetireRefreshTokenWithTransaction(tokenId string, replacedById string, tx *sql.Tx) error {
+	sqlString := `
+	UPDATE refresh_tokens
+	SET last_used = COALESCE(last_used, NOW()), replaced_by = $2
+	WHERE id = $1
+`
+	_, err := tx.Exec(sqlString, tokenId, replacedById)
+	return err
+}
+
+func RevokeRefreshTokenFamilyWithTransaction(familyId string, tx *sql.Tx) error {
+	sqlString := `
+	UPDATE refresh_tokens
+	SET revoked_at = NOW()
+	WHERE family_id = $1
+	AND revoked_at IS NULL
+`
+	_, err := tx.Exec(sqlString, familyId)
 	return err
 }
 
+// VoidRefreshTokenInDB revokes the whole family of the given token, so older tokens of the same session can't be used either.
 func VoidRefreshTokenInDB(token string, db *sql.DB) error {
 	sqlString := `
-	DELETE FROM refresh_tokens 
-	WHERE refresh_token = $1
+	UPDATE refresh_tokens
+	SET revoked_at = NOW()
+	WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)
+	AND revoked_at IS NULL
 `
-	_, err := db.Exec(sqlString, token)
+	_, err := db.Exec(sqlString, hashing.HashToken(token))
 	return err
 }
@@ -0,0 +1,234 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a single entry of the key ring. Keys without SignKey can only be used to verify tokens,
+// which is how retired keys are kept around until all tokens signed with them have expired.
+type SigningKey struct {
+	KeyId     string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// KeyRing holds every key that is currently accepted for verification and the id of the key used for signing.
+//
+// LegacyKey is the secret of the tokens that were signed before key ids existed. It only verifies refresh tokens
+// without kid, so sessions from before the key ring are rotated onto it instead of being logged out.
+type KeyRing struct {
+	ActiveKeyId string
+	Keys        map[string]SigningKey
+	LegacyKey   *SigningKey
+}
+
+var keyRing *KeyRing
+
+var ErrKeyRingNotInitialized = errors.New("jwt key ring is not initialized")
+var ErrUnknownKeyId = errors.New("token was signed with an unknown key")
+var ErrNoActiveSigningKey = errors.New("active key can not be used for signing")
+
+// InitKeyRing loads the key ring from the environment.
+//
+// JWT_KEYS is a comma separated list of "kid:algorithm:material" entries. For HS256 the material is the shared secret,
+// for RS256 and EdDSA it is the path to a PEM file. Private keys can sign and verify, public keys can only verify.
+//
+// JWT_ACTIVE_KEY_ID selects the key used for signing new tokens. It can be omitted if only one key is configured.
+//
+// JWT_LEGACY_SECRET is the HS256 secret of the tokens issued before JWT_KEYS. It can be removed once the last of those
+// refresh tokens has expired, which is 14 days after the deploy.
+func InitKeyRing() error {
+	ring, err := ParseKeyRing(os.Getenv("JWT_KEYS"), os.Getenv("JWT_ACTIVE_KEY_ID"), os.Getenv("JWT_LEGACY_SECRET"))
+	if err != nil {
+		return err
+	}
+	keyRing = ring
+	return nil
+}
+
+func ParseKeyRing(keysConfig string, activeKeyId string, legacySecret string) (*KeyRing, error) {
+	if strings.TrimSpace(keysConfig) == "" {
+		return nil, fmt.Errorf("JWT_KEYS is not set")
+	}
+
+	ring := &KeyRing{
+		Keys: map[string]SigningKey{},
+	}
+	for _, entry := range strings.Split(keysConfig, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, err := parseKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ring.Keys[key.KeyId]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.KeyId)
+		}
+		ring.Keys[key.KeyId] = key
+	}
+
+	if activeKeyId == "" && len(ring.Keys) == 1 {
+		for keyId := range ring.Keys {
+			activeKeyId = keyId
+		}
+	}
+	activeKey, ok := ring.Keys[activeKeyId]
+	if !ok {
+		return nil, fmt.Errorf("active jwt key %q is not configured", activeKeyId)
+	}
+	if activeKey.SignKey == nil {
+		return nil, ErrNoActiveSigningKey
+	}
+	ring.ActiveKeyId = activeKeyId
+
+	if legacySecret != "" {
+		ring.LegacyKey = &SigningKey{
+			Method:    jwt.SigningMethodHS256,
+			VerifyKey: []byte(legacySecret),
+		}
+	}
+
+	return ring, nil
+}
+
+func parseKeyEntry(entry string) (SigningKey, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return SigningKey{}, fmt.Errorf("invalid jwt key entry, expected kid:algorithm:material")
+	}
+	key := SigningKey{KeyId: parts[0]}
+
+	switch parts[1] {
+	case jwt.SigningMethodHS256.Alg():
+		key.Method = jwt.SigningMethodHS256
+		key.SignKey = []byte(parts[2])
+		key.VerifyKey = []byte(parts[2])
+		return key, nil
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported jwt algorithm %q for key %q", parts[1], key.KeyId)
+	}
+
+	pemBytes, err := os.ReadFile(parts[2])
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("reading jwt key %q: %w", key.KeyId, err)
+	}
+
+	if key.Method == jwt.SigningMethodRS256 {
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+			key.SignKey = privateKey
+			key.VerifyKey = &privateKey.PublicKey
+			return key, nil
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("parsing jwt key %q: %w", key.KeyId, err)
+		}
+		key.VerifyKey = publicKey
+		return key, nil
+	}
+
+	if privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+		key.SignKey = privateKey
+		key.VerifyKey = privateKey.(ed25519.PrivateKey).Public()
+		return key, nil
+	}
+	publicKey, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("parsing jwt key %q: %w", key.KeyId, err)
+	}
+	key.VerifyKey = publicKey
+	return key, nil
+}
+
+// signClaims signs the claims with the active key and sets the kid header.
+func signClaims(claims jwt.MapClaims) (string, error) {
+	if keyRing == nil {
+		return "", ErrKeyRingNotInitialized
+	}
+	activeKey := keyRing.Keys[keyRing.ActiveKeyId]
+
+	token := jwt.NewWithClaims(activeKey.Method, claims)
+	token.Header["kid"] = activeKey.KeyId
+	return token.SignedString(activeKey.SignKey)
+}
+
+// verificationKey is the jwt.Keyfunc used for parsing. It only accepts tokens whose kid and algorithm match a key of the ring.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keyRing == nil {
+		return nil, ErrKeyRingNotInitialized
+	}
+	keyId, _ := token.Header["kid"].(string)
+	key, ok := keyRing.Keys[keyId]
+	if !ok {
+		return nil, ErrUnknownKeyId
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), keyId)
+	}
+	return key.VerifyKey, nil
+}
+
+// refreshVerificationKey is verificationKey for refresh tokens, which also accepts tokens without kid that were signed
+// with the legacy secret. Access tokens from before the key ring are refused, the client then renews them with its
+// refresh token.
+func refreshVerificationKey(token *jwt.Token) (interface{}, error) {
+	if keyRing == nil {
+		return nil, ErrKeyRingNotInitialized
+	}
+	if _, hasKeyId := token.Header["kid"]; hasKeyId || keyRing.LegacyKey == nil {
+		return verificationKey(token)
+	}
+	if token.Method.Alg() != keyRing.LegacyKey.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for legacy token", token.Method.Alg())
+	}
+	return keyRing.LegacyKey.VerifyKey, nil
+}
+
+// GetJWKS returns the public part of every asymmetric key in the ring, so other services can verify tokens on their own.
+// Shared HS256 secrets are never published.
+func GetJWKS() JWKSet {
+	jwks := JWKSet{Keys: []JWK{}}
+	if keyRing == nil {
+		return jwks
+	}
+
+	for _, key := range keyRing.Keys {
+		switch publicKey := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				KeyId:     key.KeyId,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "OKP",
+				KeyId:     key.KeyId,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+	return jwks
+}
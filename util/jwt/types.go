@@ -1,16 +1,70 @@
 package jwt
 
 type JWTUser struct {
-	Username string
-	UserId   string
+	Username  string
+	UserId    string
+	SessionId string
 }
 
 type JWTPayload struct {
-	UserId   string
-	UserName string
-	Exp      int64
+	UserId    string
+	UserName  string
+	TokenId   string
+	SessionId string
+	Purpose   string // set on tokens that are no access tokens, like refresh tokens and the two-factor challenge
+	Exp       int64
+
+	// set when the request was authenticated with a personal access token instead of a session
+	ApiTokenId       string   `json:"-"`
+	Scopes           []string `json:"-"`
+	LimitedToGroupId string   `json:"-"`
+}
+
+// IsApiToken reports whether the request was authenticated with a personal access token.
+func (p JWTPayload) IsApiToken() bool {
+	return p.ApiTokenId != ""
+}
+
+// HasScope reports whether the token was granted the scope. Sessions have every scope.
+func (p JWTPayload) HasScope(scope string) bool {
+	if !p.IsApiToken() {
+		return true
+	}
+	for _, tokenScope := range p.Scopes {
+		if tokenScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessGroup reports whether the token is limited to another group. Membership still has to be checked.
+func (p JWTPayload) CanAccessGroup(groupId string) bool {
+	return p.LimitedToGroupId == "" || p.LimitedToGroupId == groupId
+}
+
+// SessionInfo describes the device a refresh token was issued to.
+type SessionInfo struct {
+	DeviceName string
+	UserAgent  string
+	IpAddress  string
 }
 
 type JWTTokenResponse struct {
 	Token string `json:"token"`
 }
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
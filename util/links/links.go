@@ -0,0 +1,38 @@
+package links
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+const defaultBaseUrl = "https://enguete.app"
+
+// BaseUrl returns the url of the app for the current environment, configured with APP_BASE_URL.
+func BaseUrl() string {
+	baseUrl := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if baseUrl == "" {
+		return defaultBaseUrl
+	}
+	return baseUrl
+}
+
+func build(path string, token string) string {
+	return BaseUrl() + path + url.PathEscape(token)
+}
+
+// PasswordResetLink is the link sent with a forgot password mail.
+func PasswordResetLink(token string) string {
+	return build("/reset-password/", token)
+}
+
+// EmailVerificationLink is the link sent to confirm an email address.
+func EmailVerificationLink(token string) string {
+	return build("/verify-email/", token)
+}
+
+// InviteLink is the link that opens the join screen of the app for an invite token. It is also encoded in the QR code
+// of the invite.
+func InviteLink(inviteToken string) string {
+	return build("/invite/", inviteToken)
+}
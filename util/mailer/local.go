@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes every mail to the application log instead of sending it.
+type LogMailer struct{}
+
+func (LogMailer) Send(message Message) error {
+	log.Printf("📧 Mail to %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// FileMailer appends every mail to a file, so tests and local setups can read the links out of it.
+type FileMailer struct {
+	path  string
+	mutex *sync.Mutex
+}
+
+func NewFileMailer(path string) FileMailer {
+	return FileMailer{path: path, mutex: &sync.Mutex{}}
+}
+
+func (m FileMailer) Send(message Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("Date: " + time.Now().Format(time.RFC3339) + "\n" +
+		"To: " + message.To + "\n" +
+		"Subject: " + message.Subject + "\n\n" +
+		message.Body + "\n---\n")
+	return err
+}
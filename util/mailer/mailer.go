@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Mailer sends a single plain text mail. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(message Message) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+var defaultMailer Mailer = LogMailer{}
+
+var ErrMailerNotConfigured = errors.New("mailer is not configured")
+
+// InitMailer selects the mailer from the environment.
+//
+// MAIL_DRIVER is one of "smtp", "file" or "log". Without a driver the mails are only written to the log,
+// which is enough for local development.
+func InitMailer() error {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "", "log":
+		defaultMailer = LogMailer{}
+	case "file":
+		path := os.Getenv("MAIL_FILE_PATH")
+		if path == "" {
+			return fmt.Errorf("%w: MAIL_FILE_PATH is not set", ErrMailerNotConfigured)
+		}
+		defaultMailer = NewFileMailer(path)
+	case "smtp":
+		smtpMailer, err := NewSMTPMailerFromEnv()
+		if err != nil {
+			return err
+		}
+		defaultMailer = smtpMailer
+	default:
+		return fmt.Errorf("%w: unknown MAIL_DRIVER %q", ErrMailerNotConfigured, os.Getenv("MAIL_DRIVER"))
+	}
+	return nil
+}
+
+// SetMailer replaces the mailer used by Send.
+func SetMailer(mailer Mailer) {
+	defaultMailer = mailer
+}
+
+// Send sends the message with the configured mailer.
+func Send(message Message) error {
+	return defaultMailer.Send(message)
+}
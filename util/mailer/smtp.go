@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailerFromEnv reads MAIL_SMTP_HOST, MAIL_SMTP_PORT, MAIL_SMTP_USERNAME, MAIL_SMTP_PASSWORD and MAIL_FROM.
+func NewSMTPMailerFromEnv() (SMTPMailer, error) {
+	mailer := SMTPMailer{
+		Host:     os.Getenv("MAIL_SMTP_HOST"),
+		Port:     os.Getenv("MAIL_SMTP_PORT"),
+		Username: os.Getenv("MAIL_SMTP_USERNAME"),
+		Password: os.Getenv("MAIL_SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if mailer.Host == "" || mailer.From == "" {
+		return SMTPMailer{}, fmt.Errorf("%w: MAIL_SMTP_HOST and MAIL_FROM are required for the smtp driver", ErrMailerNotConfigured)
+	}
+	if mailer.Port == "" {
+		mailer.Port = "587"
+	}
+	return mailer, nil
+}
+
+func (m SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{message.To}, buildMessage(m.From, message))
+}
+
+func buildMessage(from string, message Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + message.Subject + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
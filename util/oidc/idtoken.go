@@ -0,0 +1,189 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the parts of the id token used to find or create the user.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type keySet struct {
+	keys     map[string]interface{}
+	loadedAt time.Time
+}
+
+// keyRefreshInterval limits how often the keys get reloaded when a token has an unknown kid.
+const keyRefreshInterval = time.Minute
+
+var ErrInvalidIdToken = errors.New("id token is invalid")
+
+func (p *Provider) verifyIdToken(ctx context.Context, rawIdToken string, nonce string) (Claims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIdToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		keyId, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, keyId)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIdToken, err)
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce does not match", ErrInvalidIdToken)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidIdToken)
+	}
+
+	// some providers send email_verified as string
+	emailVerified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	return Claims{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     emailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// getKey returns the signing key with the given id. Unknown ids reload the key set, as providers rotate their keys.
+func (p *Provider) getKey(ctx context.Context, keyId string) (interface{}, error) {
+	p.mutex.Lock()
+	keys := p.keys
+	p.mutex.Unlock()
+
+	if keys != nil {
+		if key, ok := keys.keys[keyId]; ok {
+			return key, nil
+		}
+		if time.Since(keys.loadedAt) < keyRefreshInterval {
+			return nil, fmt.Errorf("unknown key id %q", keyId)
+		}
+	}
+
+	keys, err := p.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", keyId)
+	}
+	return key, nil
+}
+
+func (p *Provider) loadKeys(ctx context.Context) (*keySet, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = getJSON(ctx, discovery.JwksUri, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &keySet{keys: map[string]interface{}{}, loadedAt: time.Now()}
+	for _, webKey := range document.Keys {
+		key, err := webKey.publicKey()
+		if err != nil {
+			// keys of other types, like encryption keys, are skipped
+			continue
+		}
+		keys.keys[webKey.KeyId] = key
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.mutex.Unlock()
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
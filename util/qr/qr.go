@@ -0,0 +1,50 @@
+package qr
+
+import (
+	"bytes"
+	"github.com/skip2/go-qrcode"
+	"strconv"
+)
+
+// DefaultSize is the width and height of a PNG in pixels, large enough to be scanned from a printed page.
+const DefaultSize = 512
+
+// recoveryLevel allows about 25% of the code to be damaged or covered, like a fridge magnet over a corner.
+const recoveryLevel = qrcode.High
+
+// PNG encodes the content as a black on white QR code with a width and height of size pixels.
+func PNG(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, recoveryLevel, size)
+}
+
+// SVG encodes the content as a black on white QR code. Every module is one unit of the view box, so the code scales
+// to any print size without getting blurry.
+func SVG(content string) ([]byte, error) {
+	code, err := qrcode.New(content, recoveryLevel)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := code.Bitmap()
+	dimension := strconv.Itoa(len(bitmap))
+
+	var svg bytes.Buffer
+	svg.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 ` + dimension + ` ` + dimension + `" shape-rendering="crispEdges">`)
+	svg.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/>`)
+	svg.WriteString(`<path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// merge the dark modules of a row into one rectangle
+			start := x
+			for x+1 < len(row) && row[x+1] {
+				x++
+			}
+			svg.WriteString("M" + strconv.Itoa(start) + " " + strconv.Itoa(y) + "h" + strconv.Itoa(x-start+1) + "v1h-" + strconv.Itoa(x-start+1) + "z")
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+	return svg.Bytes(), nil
+}
@@ -0,0 +1,265 @@
+package recurrence
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is the subset of an iCalendar RRULE (RFC 5545) that meal series support: FREQ=DAILY, WEEKLY or MONTHLY with
+// INTERVAL, BYDAY without ordinals, BYMONTHDAY, WKST and either COUNT or UNTIL.
+type Rule struct {
+	Frequency  string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int // negative days count from the end of the month, -1 is the last day
+	WeekStart  time.Weekday
+	Count      int       // 0 for no limit
+	Until      time.Time // zero for no end, inclusive
+}
+
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxPeriods stops rules that never match again, like BYMONTHDAY=31 with BYDAY=MO in a year without such a day.
+const maxPeriods = 10000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+var ErrUnsupportedRule = errors.New("recurrence rule uses an unsupported part")
+
+var dayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Parse reads a rule like "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR". The "RRULE:" prefix is optional. An UNTIL without
+// time zone is read in the location, a date without time includes the whole day.
+func Parse(rule string, location *time.Location) (Rule, error) {
+	parsed := Rule{Interval: 1, WeekStart: time.Monday}
+
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return parsed, ErrInvalidRule
+	}
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return parsed, ErrInvalidRule
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			parsed.Frequency = strings.ToUpper(value)
+			if parsed.Frequency != Daily && parsed.Frequency != Weekly && parsed.Frequency != Monthly {
+				return parsed, ErrUnsupportedRule
+			}
+		case "INTERVAL":
+			parsed.Interval, err = strconv.Atoi(value)
+			if err != nil || parsed.Interval < 1 || parsed.Interval > 366 {
+				return parsed, ErrInvalidRule
+			}
+		case "COUNT":
+			parsed.Count, err = strconv.Atoi(value)
+			if err != nil || parsed.Count < 1 || parsed.Count > 1000 {
+				return parsed, ErrInvalidRule
+			}
+		case "UNTIL":
+			parsed.Until, err = parseUntil(value, location)
+			if err != nil {
+				return parsed, ErrInvalidRule
+			}
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				weekday, ok := dayCodes[strings.ToUpper(code)]
+				if !ok {
+					// ordinals like 1MO or -1FR are not supported
+					return parsed, ErrUnsupportedRule
+				}
+				if !slices.Contains(parsed.ByDay, weekday) {
+					parsed.ByDay = append(parsed.ByDay, weekday)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, dayText := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(dayText)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return parsed, ErrInvalidRule
+				}
+				if !slices.Contains(parsed.ByMonthDay, day) {
+					parsed.ByMonthDay = append(parsed.ByMonthDay, day)
+				}
+			}
+		case "WKST":
+			weekday, ok := dayCodes[strings.ToUpper(value)]
+			if !ok {
+				return parsed, ErrInvalidRule
+			}
+			parsed.WeekStart = weekday
+		default:
+			return parsed, ErrUnsupportedRule
+		}
+	}
+
+	if parsed.Frequency == "" {
+		return parsed, ErrInvalidRule
+	}
+	if parsed.Count > 0 && !parsed.Until.IsZero() {
+		return parsed, ErrInvalidRule
+	}
+	if len(parsed.ByMonthDay) > 0 && parsed.Frequency != Monthly {
+		return parsed, ErrUnsupportedRule
+	}
+	return parsed, nil
+}
+
+func parseUntil(value string, location *time.Location) (time.Time, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return until, nil
+	}
+	if until, err := time.ParseInLocation("20060102T150405", value, location); err == nil {
+		return until, nil
+	}
+	until, err := time.ParseInLocation("20060102", value, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// String returns the rule in the RRULE format, UNTIL in UTC.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Frequency}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, weekday := range r.ByDay {
+			codes = append(codes, dayCode(weekday))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayCode(r.WeekStart))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+func dayCode(weekday time.Weekday) string {
+	for code, day := range dayCodes {
+		if day == weekday {
+			return code
+		}
+	}
+	return ""
+}
+
+// Occurrences returns the occurrences of the rule from start on that are in [from, to), without the ones on the dates
+// of exceptions ("2006-01-02" in the location of start). Every occurrence keeps the clock time of start in its
+// location, also across daylight saving time changes. Like in iCalendar, COUNT includes the exceptions.
+func (r Rule) Occurrences(start time.Time, from time.Time, to time.Time, exceptions []string) []time.Time {
+	occurrences := []time.Time{}
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, candidate := range r.candidatesOfPeriod(start, period) {
+			if candidate.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && candidate.After(r.Until) {
+				return occurrences
+			}
+			if !candidate.Before(to) {
+				return occurrences
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return occurrences
+			}
+			if !candidate.Before(from) && !slices.Contains(exceptions, candidate.Format(time.DateOnly)) {
+				occurrences = append(occurrences, candidate)
+			}
+		}
+	}
+	return occurrences
+}
+
+// candidatesOfPeriod returns the sorted times of the nth day, week or month of the rule that match its filters.
+func (r Rule) candidatesOfPeriod(start time.Time, period int) []time.Time {
+	location := start.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, location)
+	}
+
+	switch r.Frequency {
+	case Daily:
+		day := at(start.Year(), start.Month(), start.Day()+period*r.Interval)
+		if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, day.Weekday()) {
+			return nil
+		}
+		return []time.Time{day}
+
+	case Weekly:
+		byDay := r.ByDay
+		if len(byDay) == 0 {
+			byDay = []time.Weekday{start.Weekday()}
+		}
+		daysSinceWeekStart := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekBegin := start.Day() - daysSinceWeekStart + period*r.Interval*7
+
+		candidates := []time.Time{}
+		for offset := 0; offset < 7; offset++ {
+			day := at(start.Year(), start.Month(), weekBegin+offset)
+			if slices.Contains(byDay, day.Weekday()) {
+				candidates = append(candidates, day)
+			}
+		}
+		return candidates
+
+	case Monthly:
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(period*r.Interval), 1, 0, 0, 0, 0, location)
+		daysInMonth := firstOfMonth.AddDate(0, 1, -1).Day()
+
+		byMonthDay := r.ByMonthDay
+		if len(byMonthDay) == 0 && len(r.ByDay) == 0 {
+			byMonthDay = []int{start.Day()}
+		}
+
+		candidates := []time.Time{}
+		for day := 1; day <= daysInMonth; day++ {
+			candidate := at(firstOfMonth.Year(), firstOfMonth.Month(), day)
+			if len(byMonthDay) > 0 && !slices.Contains(byMonthDay, day) && !slices.Contains(byMonthDay, day-daysInMonth-1) {
+				continue
+			}
+			if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, candidate.Weekday()) {
+				continue
+			}
+			candidates = append(candidates, candidate)
+		}
+		return candidates
+	}
+	return nil
+}
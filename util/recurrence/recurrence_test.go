@@ -0,0 +1,223 @@
+package recurrence
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return location
+}
+
+func TestParse(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    Rule
+		wantErr error
+	}{
+		{
+			name: "weekdays",
+			rule: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+			want: Rule{Frequency: Weekly, Interval: 1, WeekStart: time.Monday, ByDay: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		},
+		{
+			name: "prefix, lower case and duplicates",
+			rule: "RRULE:freq=weekly;byday=mo,MO;interval=2;wkst=su",
+			want: Rule{Frequency: Weekly, Interval: 2, WeekStart: time.Sunday, ByDay: []time.Weekday{time.Monday}},
+		},
+		{
+			name: "last day of the month",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12",
+			want: Rule{Frequency: Monthly, Interval: 1, WeekStart: time.Monday, ByMonthDay: []int{-1}, Count: 12},
+		},
+		{
+			name: "until in utc",
+			rule: "FREQ=DAILY;UNTIL=20260301T170000Z",
+			want: Rule{Frequency: Daily, Interval: 1, WeekStart: time.Monday, Until: time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "until without time includes the whole day in the location",
+			rule: "FREQ=DAILY;UNTIL=20260301",
+			want: Rule{Frequency: Daily, Interval: 1, WeekStart: time.Monday, Until: time.Date(2026, 3, 1, 23, 59, 59, 0, berlin)},
+		},
+		{name: "empty", rule: "", wantErr: ErrInvalidRule},
+		{name: "without frequency", rule: "INTERVAL=2", wantErr: ErrInvalidRule},
+		{name: "part without value", rule: "FREQ=DAILY;COUNT=", wantErr: ErrInvalidRule},
+		{name: "yearly", rule: "FREQ=YEARLY", wantErr: ErrUnsupportedRule},
+		{name: "count and until", rule: "FREQ=DAILY;COUNT=3;UNTIL=20260301", wantErr: ErrInvalidRule},
+		{name: "interval zero", rule: "FREQ=DAILY;INTERVAL=0", wantErr: ErrInvalidRule},
+		{name: "count too high", rule: "FREQ=DAILY;COUNT=1001", wantErr: ErrInvalidRule},
+		{name: "byday with ordinal", rule: "FREQ=MONTHLY;BYDAY=-1FR", wantErr: ErrUnsupportedRule},
+		{name: "bymonthday zero", rule: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: ErrInvalidRule},
+		{name: "bymonthday out of range", rule: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: ErrInvalidRule},
+		{name: "bymonthday on a weekly rule", rule: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: ErrUnsupportedRule},
+		{name: "unknown part", rule: "FREQ=DAILY;BYHOUR=8", wantErr: ErrUnsupportedRule},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.rule, berlin)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %v", test.rule, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.rule, err)
+			}
+			if got.Frequency != test.want.Frequency || got.Interval != test.want.Interval || got.WeekStart != test.want.WeekStart ||
+				got.Count != test.want.Count || !got.Until.Equal(test.want.Until) ||
+				!slices.Equal(got.ByDay, test.want.ByDay) || !slices.Equal(got.ByMonthDay, test.want.ByMonthDay) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", test.rule, got, test.want)
+			}
+
+			reparsed, err := Parse(got.String(), berlin)
+			if err != nil {
+				t.Fatalf("Parse(%q) of String() error = %v", got.String(), err)
+			}
+			if reparsed.String() != got.String() {
+				t.Fatalf("String() is not stable: %q, then %q", got.String(), reparsed.String())
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	at := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name       string
+		rule       string
+		start      time.Time
+		from       time.Time
+		to         time.Time
+		exceptions []string
+		want       []time.Time
+	}{
+		{
+			name:  "daily with count",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: at(2026, 1, 1, 18),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 1, 18), at(2026, 1, 2, 18), at(2026, 1, 3, 18)},
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=DAILY;UNTIL=20260103",
+			start: at(2026, 1, 1, 18),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 1, 18), at(2026, 1, 2, 18), at(2026, 1, 3, 18)},
+		},
+		{
+			name:  "only the window",
+			rule:  "FREQ=DAILY",
+			start: at(2026, 1, 1, 18),
+			from:  at(2026, 1, 3, 0),
+			to:    at(2026, 1, 5, 18),
+			want:  []time.Time{at(2026, 1, 3, 18), at(2026, 1, 4, 18)},
+		},
+		{
+			name:  "weekly on two days",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			start: at(2026, 1, 5, 12),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 5, 12), at(2026, 1, 7, 12), at(2026, 1, 12, 12), at(2026, 1, 14, 12)},
+		},
+		{
+			name:  "every other week",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+			start: at(2026, 1, 5, 12),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 5, 12), at(2026, 1, 19, 12), at(2026, 2, 2, 12)},
+		},
+		{
+			name:  "weekly keeps the clock time across the change to summer time",
+			rule:  "FREQ=WEEKLY;COUNT=3",
+			start: at(2026, 3, 23, 18),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 3, 23, 18), at(2026, 3, 30, 18), at(2026, 4, 6, 18)},
+		},
+		{
+			name:  "weekly keeps the clock time across the change to winter time",
+			rule:  "FREQ=WEEKLY;BYDAY=SA;COUNT=2",
+			start: at(2026, 10, 24, 18),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 10, 24, 18), at(2026, 10, 31, 18)},
+		},
+		{
+			name:  "last day of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=4",
+			start: at(2026, 1, 31, 19),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 31, 19), at(2026, 2, 28, 19), at(2026, 3, 31, 19), at(2026, 4, 30, 19)},
+		},
+		{
+			name:  "months without the day are skipped",
+			rule:  "FREQ=MONTHLY;COUNT=3",
+			start: at(2026, 1, 31, 19),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2027, 1, 1, 0),
+			want:  []time.Time{at(2026, 1, 31, 19), at(2026, 3, 31, 19), at(2026, 5, 31, 19)},
+		},
+		{
+			name:       "exceptions count towards count",
+			rule:       "FREQ=DAILY;COUNT=4",
+			start:      at(2026, 1, 1, 18),
+			from:       at(2026, 1, 1, 0),
+			to:         at(2027, 1, 1, 0),
+			exceptions: []string{"2026-01-02"},
+			want:       []time.Time{at(2026, 1, 1, 18), at(2026, 1, 3, 18), at(2026, 1, 4, 18)},
+		},
+		{
+			name:       "exceptions use the date in the location of start",
+			rule:       "FREQ=DAILY;COUNT=2",
+			start:      at(2026, 1, 1, 0),
+			from:       at(2026, 1, 1, 0),
+			to:         at(2027, 1, 1, 0),
+			exceptions: []string{"2025-12-31"},
+			want:       []time.Time{at(2026, 1, 1, 0), at(2026, 1, 2, 0)},
+		},
+		{
+			name:  "no match at all",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31;BYDAY=MO",
+			start: at(2026, 1, 1, 18),
+			from:  at(2026, 1, 1, 0),
+			to:    at(2026, 3, 1, 0),
+			want:  []time.Time{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := Parse(test.rule, berlin)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.rule, err)
+			}
+			got := rule.Occurrences(test.start, test.from, test.to, test.exceptions)
+			if !slices.EqualFunc(got, test.want, time.Time.Equal) {
+				t.Fatalf("Occurrences() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
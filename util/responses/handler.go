@@ -48,6 +48,10 @@ func GenericNotAllowedToPerformActionError(w http.ResponseWriter) {
 	HttpErrorResponse(w, http.StatusForbidden, frontendErrors.NotAllowedToPerformActionError, "You are not allowed to perform this action")
 }
 
+func GenericApiTokenScopeError(w http.ResponseWriter) {
+	HttpErrorResponse(w, http.StatusForbidden, frontendErrors.ApiTokenScopeError, "The api token does not allow this action")
+}
+
 func GenericGroupDoesNotExistError(w http.ResponseWriter) {
 	HttpErrorResponse(w, http.StatusNotFound, frontendErrors.GroupDoesNotExistError, "The group does not exist")
 }
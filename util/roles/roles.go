@@ -1,5 +1,7 @@
 package roles
 
+import "slices"
+
 const (
 	CanUpdateMeal      = "can_update_meal"
 	CanDeleteMeal      = "can_delete_meal"
@@ -8,8 +10,9 @@ const (
 
 	CanForceMealPreferenceAndCooking = "can_force_meal_preference_and_cooking"
 
-	CanUpdateGroup = "can_update_group"
-	CanDeleteGroup = "can_delete_group"
+	CanUpdateGroup         = "can_update_group"
+	CanDeleteGroup         = "can_delete_group"
+	CanUpdateGroupPolicies = "can_update_group_policies"
 
 	CanBanUsers  = "can_ban_users"
 	CanUnbanUser = "can_unban_user"
@@ -19,12 +22,16 @@ const (
 	CanVoidInviteLinks   = "can_void_invite_links"
 	CanViewInviteLinks   = "can_view_invite_links"
 
+	CanManageJoinRequests = "can_manage_join_requests"
+
 	CanSendNotifications = "can_send_notifications"
 
 	CanPromoteToAdmins   = "can_promote_to_admin"
 	CanDemoteFromAdmins  = "can_demote_from_admin"
 	CanPromoteToManager  = "can_promote_to_manager"
 	CanDemoteFromManager = "can_demote_from_manager"
+
+	CanManageRoles = "can_manage_roles" // create, change and delete roles and assign roles that are not admin or manager
 )
 
 const (
@@ -33,6 +40,8 @@ const (
 	MemberRole  = "member"
 )
 
+// RolePermissions are the permissions of the default roles, every new group gets them seeded into group_roles.
+// The roles of an existing group are read from the database.
 var RolePermissions = map[string]map[string]bool{
 	CanUpdateMeal:      {AdminRole: true, ManagerRole: true, MemberRole: false},
 	CanDeleteMeal:      {AdminRole: true, ManagerRole: true, MemberRole: false},
@@ -44,6 +53,8 @@ var RolePermissions = map[string]map[string]bool{
 	CanUpdateGroup: {AdminRole: true, ManagerRole: true, MemberRole: false},
 	CanDeleteGroup: {AdminRole: true, ManagerRole: false, MemberRole: false},
 
+	CanUpdateGroupPolicies: {AdminRole: true, ManagerRole: false, MemberRole: false},
+
 	CanBanUsers:  {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanKickUsers: {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanUnbanUser: {AdminRole: true, ManagerRole: false, MemberRole: false},
@@ -52,46 +63,128 @@ var RolePermissions = map[string]map[string]bool{
 	CanVoidInviteLinks:   {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanViewInviteLinks:   {AdminRole: true, ManagerRole: true, MemberRole: false},
 
+	CanManageJoinRequests: {AdminRole: true, ManagerRole: true, MemberRole: false},
+
 	CanSendNotifications: {AdminRole: true, ManagerRole: true, MemberRole: false},
 
 	CanPromoteToAdmins:   {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanDemoteFromAdmins:  {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanPromoteToManager:  {AdminRole: true, ManagerRole: false, MemberRole: false},
 	CanDemoteFromManager: {AdminRole: true, ManagerRole: false, MemberRole: false},
+
+	CanManageRoles: {AdminRole: true, ManagerRole: false, MemberRole: false},
 }
 
-func CanPerformAction(roles []string, action string) bool {
-	canDoSpecificAction := RolePermissions[action]
-	if canDoSpecificAction == nil {
-		return false
-	}
-	for _, role := range roles {
-		if canDoSpecificAction[role] == true {
-			return true
+// DefaultRoles are the roles every group starts with. They can't be renamed or deleted.
+var DefaultRoles = []string{AdminRole, ManagerRole, MemberRole}
+
+// Scopes of personal access tokens. Every token can read the groups of its owner, the other scopes allow the
+// permissions listed in ScopePermissions on top of the roles the owner has in the group.
+const (
+	ScopeRead   = "read"
+	ScopeMeals  = "meals"
+	ScopeGroups = "groups"
+)
+
+// ScopePermissions lists the actions a token scope allows. Deleting a group, changing its policies, managing
+// admins and managing roles is never possible with a token.
+var ScopePermissions = map[string][]string{
+	ScopeRead: {},
+	ScopeMeals: {
+		CanCreateMeal,
+		CanUpdateMeal,
+		CanDeleteMeal,
+		CanChangeMealFlags,
+		CanForceMealPreferenceAndCooking,
+	},
+	ScopeGroups: {
+		CanUpdateGroup,
+		CanBanUsers,
+		CanUnbanUser,
+		CanKickUsers,
+		CanCreateInviteLinks,
+		CanVoidInviteLinks,
+		CanViewInviteLinks,
+		CanManageJoinRequests,
+		CanSendNotifications,
+		CanPromoteToManager,
+		CanDemoteFromManager,
+	},
+}
+
+func IsValidScope(scope string) bool {
+	_, ok := ScopePermissions[scope]
+	return ok
+}
+
+// ScopesAllowAction reports whether one of the token scopes allows the action.
+func ScopesAllowAction(scopes []string, action string) bool {
+	for _, scope := range scopes {
+		for _, permission := range ScopePermissions[scope] {
+			if permission == action {
+				return true
+			}
 		}
 	}
 	return false
 }
 
-func GetConstViaString(roleName string) string {
-	switch roleName {
-	case "admin":
-		return AdminRole
-	case "manager":
-		return ManagerRole
-	case "member":
-		return MemberRole
-	default:
-		return ""
-	}
+// CanPerformAction checks if the action is one of the permissions granted by the roles of a user.
+func CanPerformAction(permissions []string, action string) bool {
+	return slices.Contains(permissions, action)
+}
+
+func IsDefaultRole(role string) bool {
+	return slices.Contains(DefaultRoles, role)
+}
+
+func IsValidPermission(permission string) bool {
+	_, ok := RolePermissions[permission]
+	return ok
 }
 
-func GetAllAllowedActionsForRoles(roles []string) []string {
-	var allowedActions []string
+// AllPermissions returns every permission a role can grant, sorted by name.
+func AllPermissions() []string {
+	permissions := make([]string, 0, len(RolePermissions))
 	for permission := range RolePermissions {
-		if CanPerformAction(roles, permission) {
-			allowedActions = append(allowedActions, permission)
+		permissions = append(permissions, permission)
+	}
+	slices.Sort(permissions)
+	return permissions
+}
+
+// DefaultPermissionsOfRole returns the permissions a default role gets seeded with, sorted by name.
+func DefaultPermissionsOfRole(role string) []string {
+	permissions := []string{}
+	for _, permission := range AllPermissions() {
+		if RolePermissions[permission][role] {
+			permissions = append(permissions, permission)
 		}
 	}
-	return allowedActions
+	return permissions
+}
+
+// PromotePermission returns the permission needed to assign the role. Admin and manager have their own
+// permissions, every other role needs CanManageRoles.
+func PromotePermission(role string) string {
+	switch role {
+	case AdminRole:
+		return CanPromoteToAdmins
+	case ManagerRole:
+		return CanPromoteToManager
+	default:
+		return CanManageRoles
+	}
+}
+
+// DemotePermission returns the permission needed to take the role away, see PromotePermission.
+func DemotePermission(role string) string {
+	switch role {
+	case AdminRole:
+		return CanDemoteFromAdmins
+	case ManagerRole:
+		return CanDemoteFromManager
+	default:
+		return CanManageRoles
+	}
 }
@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs the job in the background once per interval, starting one interval after the call. A failing job is
+// logged and tried again at the next interval.
+func Every(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run(name, job)
+		}
+	}()
+}
+
+func run(name string, job func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("⚠️ Scheduled job %s panicked: %v", name, r)
+		}
+	}()
+
+	err := job()
+	if err != nil {
+		log.Printf("⚠️ Scheduled job %s failed: %v", name, err)
+	}
+}
@@ -0,0 +1,55 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the memory store drops old keys while updating.
+const pruneInterval = time.Minute * 10
+
+type MemoryStore struct {
+	mutex      sync.Mutex
+	attempts   map[string]Attempts
+	lastPruned time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempts{}, lastPruned: time.Now()}
+}
+
+func (s *MemoryStore) Update(key string, update func(attempts Attempts) Attempts) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPruned) > pruneInterval {
+		s.prune(now.Add(-keepAttemptsFor))
+		s.lastPruned = now
+	}
+
+	s.attempts[key] = update(s.attempts[key])
+	return nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune(before)
+	return nil
+}
+
+func (s *MemoryStore) prune(before time.Time) {
+	for key, attempts := range s.attempts {
+		if attempts.LastFailureAt.Before(before) && attempts.LockedUntil.Before(before) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package throttle
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) PostgresStore {
+	return PostgresStore{db: db}
+}
+
+// Update locks the row of the key for the update, a missing row is created first so there is always one to lock.
+func (s PostgresStore) Update(key string, update func(attempts Attempts) Attempts) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = updateWithTransaction(key, update, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateWithTransaction(key string, update func(attempts Attempts) Attempts, tx *sql.Tx) error {
+	insertQuery := `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES ($1, 0, 'epoch')
+		ON CONFLICT (attempt_key) DO NOTHING
+	`
+	_, err := tx.Exec(insertQuery, key)
+	if err != nil {
+		return err
+	}
+
+	selectQuery := `
+		SELECT failures, last_failure_at, COALESCE(locked_until, 'epoch'::timestamptz)
+		FROM login_attempts
+		WHERE attempt_key = $1
+		FOR UPDATE
+	`
+	var attempts Attempts
+	err = tx.QueryRow(selectQuery, key).Scan(&attempts.Failures, &attempts.LastFailureAt, &attempts.LockedUntil)
+	if err != nil {
+		return err
+	}
+
+	attempts = update(attempts)
+
+	updateQuery := `
+		UPDATE login_attempts
+		SET failures = $2, last_failure_at = $3, locked_until = NULLIF($4, 'epoch'::timestamptz)
+		WHERE attempt_key = $1
+	`
+	_, err = tx.Exec(updateQuery, key, attempts.Failures, attempts.LastFailureAt, attempts.LockedUntil)
+	return err
+}
+
+func (s PostgresStore) Reset(key string) error {
+	query := `DELETE FROM login_attempts WHERE attempt_key = $1`
+	_, err := s.db.Exec(query, key)
+	return err
+}
+
+func (s PostgresStore) Prune(before time.Time) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1
+		AND (locked_until IS NULL OR locked_until < $1)
+	`
+	_, err := s.db.Exec(query, before)
+	return err
+}
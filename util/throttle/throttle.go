@@ -0,0 +1,166 @@
+package throttle
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Attempts is the failure state stored for one key, e.g. an account or an ip address.
+type Attempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store keeps the attempt counters. Update has to be atomic, so that parallel requests can't slip past the limits.
+type Store interface {
+	// Update replaces the attempts of the key with the result of update. No other update of the key runs in between,
+	// update may be called with the zero Attempts for unknown keys.
+	Update(key string, update func(attempts Attempts) Attempts) error
+	Reset(key string) error
+	// Prune removes every key without a failure or lock after the given time.
+	Prune(before time.Time) error
+}
+
+// Policy describes how strict a Limiter is.
+//
+// The first FreeAttempts failures within Window have no delay. Every further failure doubles the time the next attempt
+// has to wait, starting at BaseDelay and capped at MaxDelay. After LockoutThreshold failures the key is locked
+// for LockoutDuration.
+type Policy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	Window           time.Duration
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	prefix string
+}
+
+func NewLimiter(store Store, prefix string, policy Policy) Limiter {
+	return Limiter{store: store, policy: policy, prefix: prefix}
+}
+
+// Reserve counts an attempt as failure before the credentials are checked, in the same store update that checks the
+// limit, so parallel attempts can't all pass the check before any of them is counted. It returns how long the key has
+// to wait, in that case nothing is counted. A successful attempt is given back with Release or Reset.
+func (l Limiter) Reserve(key string) (time.Duration, error) {
+	var retryAfter time.Duration
+	err := l.store.Update(l.prefix+key, func(attempts Attempts) Attempts {
+		now := time.Now()
+		retryAfter = l.policy.retryAfter(attempts, now)
+		if retryAfter > 0 {
+			return attempts
+		}
+
+		if now.Sub(attempts.LastFailureAt) > l.policy.Window {
+			attempts.Failures = 0
+		}
+		attempts.Failures++
+		attempts.LastFailureAt = now
+		if attempts.Failures >= l.policy.LockoutThreshold {
+			attempts.LockedUntil = now.Add(l.policy.LockoutDuration)
+		}
+		return attempts
+	})
+	return retryAfter, err
+}
+
+// Release takes back one reserved attempt, for keys like the ip address that shouldn't be reset by a single success.
+func (l Limiter) Release(key string) error {
+	return l.store.Update(l.prefix+key, func(attempts Attempts) Attempts {
+		if attempts.Failures > 0 {
+			attempts.Failures--
+		}
+		return attempts
+	})
+}
+
+func (l Limiter) Reset(key string) error {
+	return l.store.Reset(l.prefix + key)
+}
+
+func (p Policy) retryAfter(attempts Attempts, now time.Time) time.Duration {
+	if attempts.LockedUntil.After(now) {
+		return attempts.LockedUntil.Sub(now)
+	}
+	if now.Sub(attempts.LastFailureAt) > p.Window || attempts.Failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < attempts.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	wait := attempts.LastFailureAt.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+var SignInAccountLimiter Limiter
+var SignInIpLimiter Limiter
+
+var store Store
+
+var signInAccountPolicy = Policy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  time.Minute * 15,
+	Window:           time.Minute * 15,
+}
+
+// the ip limit is higher, as several users can share an address
+var signInIpPolicy = Policy{
+	FreeAttempts:     20,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 100,
+	LockoutDuration:  time.Minute * 15,
+	Window:           time.Minute * 15,
+}
+
+// keepAttemptsFor is how long a counter can still slow down a sign in.
+var keepAttemptsFor = max(signInAccountPolicy.Window, signInIpPolicy.Window, signInAccountPolicy.LockoutDuration, signInIpPolicy.LockoutDuration)
+
+// InitThrottle creates the sign in limiters with the store selected by THROTTLE_STORE.
+//
+// "memory" (default) keeps the counters in the process, which is enough for a single instance.
+// "postgres" shares them between all instances through the login_attempts table.
+func InitThrottle(db *sql.DB) error {
+	switch os.Getenv("THROTTLE_STORE") {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		store = NewPostgresStore(db)
+	default:
+		return fmt.Errorf("unknown THROTTLE_STORE %q", os.Getenv("THROTTLE_STORE"))
+	}
+
+	SignInAccountLimiter = NewLimiter(store, "signin:account:", signInAccountPolicy)
+	SignInIpLimiter = NewLimiter(store, "signin:ip:", signInIpPolicy)
+	return nil
+}
+
+// Prune drops the counters that can't slow down a sign in anymore. The memory store also does this while counting,
+// the postgres store relies on this being scheduled.
+func Prune() error {
+	if store == nil {
+		return nil
+	}
+	return store.Prune(time.Now().Add(-keepAttemptsFor))
+}
@@ -0,0 +1,147 @@
+package waitlist
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"slices"
+)
+
+var ErrMealNotFound = errors.New("meal not found")
+
+// LockMealWithTransaction locks the meal, so changes to its participants happen one after another, and returns its
+// limit.
+func LockMealWithTransaction(mealId string, tx *sql.Tx) (*int, error) {
+	query := `
+		SELECT max_participants
+		FROM meals
+		WHERE meal_id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	var maxParticipants *int
+	err := tx.QueryRow(query, mealId).Scan(&maxParticipants)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMealNotFound
+	}
+	return maxParticipants, err
+}
+
+// CountConfirmedSeatsWithTransaction counts the confirmed opt-ins and their guests.
+func CountConfirmedSeatsWithTransaction(mealId string, tx *sql.Tx) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(1 + guest_count), 0)
+		FROM meal_preferences
+		WHERE meal_id = $1
+		AND preference = 'opt-in'
+		AND waitlisted_at IS NULL
+		AND deleted_at IS NULL
+	`
+	var seats int
+	err := tx.QueryRow(query, mealId).Scan(&seats)
+	return seats, err
+}
+
+// PromoteWithTransaction confirms waiting opt-ins in the order they opted in, as long as they fit with their guests.
+// The first one that doesn't fit stops the promotion, so nobody gets skipped. Without a limit everyone is confirmed.
+// The caller has to hold the lock of LockMealWithTransaction.
+func PromoteWithTransaction(mealId string, maxParticipants *int, tx *sql.Tx) error {
+	query := `
+		SELECT preference_id, 1 + guest_count
+		FROM meal_preferences
+		WHERE meal_id = $1
+		AND waitlisted_at IS NOT NULL
+		AND deleted_at IS NULL
+		ORDER BY waitlisted_at, preference_id
+	`
+	rows, err := tx.Query(query, mealId)
+	if err != nil {
+		return err
+	}
+	type waitingParticipant struct {
+		preferenceId string
+		seats        int
+	}
+	var waitlist []waitingParticipant
+	for rows.Next() {
+		var waiting waitingParticipant
+		if err := rows.Scan(&waiting.preferenceId, &waiting.seats); err != nil {
+			rows.Close()
+			return err
+		}
+		waitlist = append(waitlist, waiting)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(waitlist) == 0 {
+		return nil
+	}
+
+	freeSeats := 0
+	if maxParticipants != nil {
+		seats, err := CountConfirmedSeatsWithTransaction(mealId, tx)
+		if err != nil {
+			return err
+		}
+		freeSeats = *maxParticipants - seats
+	}
+
+	var promotedIds []string
+	for _, waiting := range waitlist {
+		if maxParticipants != nil {
+			if waiting.seats > freeSeats {
+				break
+			}
+			freeSeats -= waiting.seats
+		}
+		promotedIds = append(promotedIds, waiting.preferenceId)
+	}
+	if len(promotedIds) == 0 {
+		return nil
+	}
+
+	query = `
+		UPDATE meal_preferences
+		SET waitlisted_at = NULL, updated_at = NOW()
+		WHERE preference_id = ANY ($1::uuid[])
+	`
+	_, err = tx.Exec(query, pq.Array(promotedIds))
+	return err
+}
+
+// PromoteMealsWithTransaction locks and promotes every meal, e.g. after preferences were removed in bulk. The meals
+// are locked in a fixed order, so two transactions can't deadlock each other. Deleted meals are skipped.
+func PromoteMealsWithTransaction(mealIds []string, tx *sql.Tx) error {
+	mealIds = slices.Clone(mealIds)
+	slices.Sort(mealIds)
+	for _, mealId := range slices.Compact(mealIds) {
+		maxParticipants, err := LockMealWithTransaction(mealId, tx)
+		if errors.Is(err, ErrMealNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = PromoteWithTransaction(mealId, maxParticipants, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanMealIds reads the meal ids returned by a query and closes the rows.
+func ScanMealIds(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var mealIds []string
+	for rows.Next() {
+		var mealId string
+		if err := rows.Scan(&mealId); err != nil {
+			return nil, err
+		}
+		mealIds = append(mealIds, mealId)
+	}
+	return mealIds, rows.Err()
+}